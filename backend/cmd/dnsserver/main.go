@@ -6,10 +6,15 @@ import (
 	"github.com/orion-tec/oriondns/config"
 	"github.com/orion-tec/oriondns/db"
 	"github.com/orion-tec/oriondns/internal/ai"
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
 	"github.com/orion-tec/oriondns/internal/blockeddomains"
 	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/clients"
 	"github.com/orion-tec/oriondns/internal/domains"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/schedules"
 	"github.com/orion-tec/oriondns/internal/stats"
+	"github.com/orion-tec/oriondns/internal/subscriptions"
 	"github.com/orion-tec/oriondns/server/dns"
 )
 
@@ -19,12 +24,19 @@ func main() {
 		fx.Provide(db.New),
 		fx.Provide(stats.New),
 		fx.Provide(blockeddomains.New),
+		fx.Provide(alloweddomains.New),
 		fx.Provide(dns.New),
 		fx.Provide(domains.New),
 		fx.Provide(ai.New),
 		fx.Provide(categories.New),
 		fx.Provide(categories.NewSyncer),
+		fx.Provide(clients.New),
+		fx.Provide(schedules.New),
+		fx.Provide(localrecords.New),
+		fx.Provide(subscriptions.New),
+		fx.Provide(subscriptions.NewSyncer),
 		fx.Invoke(func(s *dns.DNS) {}),
 		fx.Invoke(func(s categories.Syncer) {}),
+		fx.Invoke(func(s subscriptions.Syncer) {}),
 	).Run()
 }
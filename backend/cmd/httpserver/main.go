@@ -5,6 +5,12 @@ import (
 
 	"github.com/orion-tec/oriondns/config"
 	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/schedules"
 	"github.com/orion-tec/oriondns/internal/stats"
 	"github.com/orion-tec/oriondns/server/web"
 )
@@ -14,6 +20,12 @@ func main() {
 		fx.Provide(config.New),
 		fx.Provide(db.New),
 		fx.Provide(stats.New),
+		fx.Provide(clients.New),
+		fx.Provide(blockeddomains.New),
+		fx.Provide(alloweddomains.New),
+		fx.Provide(categories.New),
+		fx.Provide(schedules.New),
+		fx.Provide(localrecords.New),
 		fx.Provide(web.New),
 		fx.Invoke(func(s *web.HTTP) {}),
 	).Run()
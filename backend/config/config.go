@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +16,149 @@ type Config struct {
 		User string `yaml:"user"`
 		Name string `yaml:"name"`
 	} `yaml:"db"`
+	DNS struct {
+		Upstream struct {
+			// Servers are tried according to Strategy: strict, round_robin or fastest.
+			// Each is a plain host:port (UDP) or a udp://, tcp://, tls:// or https:// URL.
+			Servers             []string      `yaml:"servers"`
+			Strategy            string        `yaml:"strategy"`
+			Timeout             time.Duration `yaml:"timeout"`
+			HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+		} `yaml:"upstream"`
+		// Forwarding sends the queries under some domains to their own
+		// upstreams instead of the default ones, even in recursive mode. The
+		// most specific domain wins. Forwarded answers are not DNSSEC validated.
+		Forwarding struct {
+			Rules []struct {
+				// Domains are suffixes like corp.internal, or CIDRs like
+				// 192.168.0.0/16 standing for their reverse zones.
+				Domains []string `yaml:"domains"`
+				Servers []string `yaml:"servers"`
+				// Transport is udp (the default), tcp, tls or https, for the
+				// servers given as host:port rather than URLs.
+				Transport string `yaml:"transport"`
+				Strategy  string `yaml:"strategy"`
+			} `yaml:"rules"`
+		} `yaml:"forwarding"`
+		// PrivateReverse handles the RFC 6303 reverse zones of private and
+		// special use ranges, such as 168.192.in-addr.arpa, which are
+		// answered locally with NXDOMAIN unless Servers, a local resolver
+		// like the router, is set. Local records, authoritative zones and
+		// forwarding rules take precedence.
+		PrivateReverse struct {
+			Servers   []string `yaml:"servers"`
+			Transport string   `yaml:"transport"`
+		} `yaml:"private_reverse"`
+		// Recursion resolves queries iteratively from the root servers instead
+		// of forwarding them to the upstream servers.
+		Recursion struct {
+			Enabled bool `yaml:"enabled"`
+			// RootHints are root server addresses as ip or ip:port. The IANA
+			// root servers are used when empty.
+			RootHints []string      `yaml:"root_hints"`
+			Timeout   time.Duration `yaml:"timeout"`
+		} `yaml:"recursion"`
+		// DNSSEC validates answers, setting the AD bit on secure ones and
+		// answering SERVFAIL with an Extended DNS Error for bogus ones.
+		DNSSEC struct {
+			Enabled bool `yaml:"enabled"`
+			// TrustAnchors are DS or DNSKEY records in presentation format.
+			// The root KSKs are used when empty.
+			TrustAnchors []string `yaml:"trust_anchors"`
+		} `yaml:"dnssec"`
+		// Blocking sets how blocked queries are answered unless the matching
+		// rule overrides it.
+		Blocking struct {
+			// Response is nxdomain, refused, nodata, null_ip (the default) or
+			// sinkhole.
+			Response string `yaml:"response"`
+			// SinkholeIPv4 and SinkholeIPv6 answer A and AAAA queries in
+			// sinkhole mode; other query types get NODATA.
+			SinkholeIPv4 string        `yaml:"sinkhole_ipv4"`
+			SinkholeIPv6 string        `yaml:"sinkhole_ipv6"`
+			TTL          time.Duration `yaml:"ttl"`
+		} `yaml:"blocking"`
+		// Categories block domains by the categories the AI syncer assigned
+		// them, as set in the category_policies table.
+		Categories struct {
+			// Uncategorized is allow (the default) or block, for domains the
+			// syncer has not categorized yet. Local records and authoritative
+			// zones are never blocked as uncategorized.
+			Uncategorized string `yaml:"uncategorized"`
+		} `yaml:"categories"`
+		// Clients are matched to their group by source address, by the DoH
+		// path or by the client ID EDNS0 option.
+		Clients struct {
+			// EDNSOption is the EDNS0 option code carrying client IDs,
+			// 65001 by default.
+			EDNSOption uint16 `yaml:"edns_option"`
+		} `yaml:"clients"`
+		// SafeSearch rewrites Google, Bing, DuckDuckGo and YouTube to their
+		// safe search or restricted mode hosts. Groups can override it.
+		SafeSearch struct {
+			Enabled bool `yaml:"enabled"`
+		} `yaml:"safe_search"`
+		// Subscriptions are remote hosts, AdBlock or plain domain lists,
+		// downloaded every Interval.
+		Subscriptions struct {
+			Interval time.Duration `yaml:"interval"`
+			Timeout  time.Duration `yaml:"timeout"`
+		} `yaml:"subscriptions"`
+		// RPZ zones are response policy zones, transferred from a primary or
+		// read from a file. Their policies apply after the allowlist and
+		// before the block rules.
+		RPZ struct {
+			Zones []struct {
+				Name    string        `yaml:"name"`
+				Primary string        `yaml:"primary"`
+				File    string        `yaml:"file"`
+				Refresh time.Duration `yaml:"refresh"`
+				// TSIGKey and TSIGSecret sign transfers with HMAC-SHA256.
+				TSIGKey    string `yaml:"tsig_key"`
+				TSIGSecret string `yaml:"tsig_secret"`
+			} `yaml:"zones"`
+		} `yaml:"rpz"`
+		// Authoritative zones are served from RFC 1035 zone files, which are
+		// reloaded when they change on disk.
+		Authoritative struct {
+			Zones []struct {
+				Name string `yaml:"name"`
+				File string `yaml:"file"`
+				// AllowTransfer lists the IPs and CIDRs of the secondaries
+				// allowed to transfer the zone with AXFR over TCP.
+				AllowTransfer []string `yaml:"allow_transfer"`
+			} `yaml:"zones"`
+		} `yaml:"authoritative"`
+		Cache struct {
+			MaxEntries     int           `yaml:"max_entries"`
+			MaxNegativeTTL time.Duration `yaml:"max_negative_ttl"`
+			// StaleMaxAge enables RFC 8767 serve-stale when greater than zero.
+			StaleMaxAge time.Duration `yaml:"stale_max_age"`
+			StaleTTL    time.Duration `yaml:"stale_ttl"`
+			// PrefetchTopDomains is how many of the most used domains get
+			// refreshed before they expire. Zero disables prefetching.
+			PrefetchTopDomains int `yaml:"prefetch_top_domains"`
+		} `yaml:"cache"`
+		// TLS holds the certificate shared by the encrypted listeners. The
+		// files are reloaded when they change on disk.
+		TLS struct {
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+		} `yaml:"tls"`
+		DoT struct {
+			Enabled bool   `yaml:"enabled"`
+			Addr    string `yaml:"addr"`
+		} `yaml:"dot"`
+		// DoH serves RFC 8484 queries on /dns-query and /dns-query/{clientID}.
+		DoH struct {
+			Enabled bool   `yaml:"enabled"`
+			Addr    string `yaml:"addr"`
+		} `yaml:"doh"`
+		DoQ struct {
+			Enabled bool   `yaml:"enabled"`
+			Addr    string `yaml:"addr"`
+		} `yaml:"doq"`
+	} `yaml:"dns"`
 }
 
 func New() *Config {
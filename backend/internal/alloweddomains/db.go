@@ -0,0 +1,67 @@
+package alloweddomains
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/orion-tec/oriondns/db"
+)
+
+type allowedDomainsDB struct {
+	db *db.DB
+}
+
+// DB stores domains that are resolved even when a block rule matches them.
+type DB interface {
+	Insert(ctx context.Context, domain string, recursive bool) error
+	InsertRule(ctx context.Context, rule AllowedDomain) error
+	GetAll(ctx context.Context) ([]AllowedDomain, error)
+}
+
+func New(db *db.DB) DB {
+	return &allowedDomainsDB{db}
+}
+
+func (a *allowedDomainsDB) Insert(ctx context.Context, domain string, recursive bool) error {
+	_, err := a.db.Exec(ctx, `
+		INSERT INTO allowed_domains (domain, recursive)
+			VALUES ($1, $2)
+	`, domain, recursive)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertRule inserts a rule, scoped to a group when GroupID is set.
+func (a *allowedDomainsDB) InsertRule(ctx context.Context, rule AllowedDomain) error {
+	_, err := a.db.Exec(ctx, `
+		INSERT INTO allowed_domains (domain, recursive, group_id)
+			VALUES ($1, $2, $3)
+	`, rule.Domain, rule.Recursive, rule.GroupID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *allowedDomainsDB) GetAll(ctx context.Context) ([]AllowedDomain, error) {
+	rows, err := a.db.Query(ctx, `
+		SELECT id, domain, recursive, subscription_id, group_id, created_at, updated_at, deleted_at
+		FROM allowed_domains
+		WHERE deleted_at IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedDomains, err := pgx.CollectRows(rows, pgx.RowToStructByName[AllowedDomain])
+	if err != nil {
+		return nil, err
+	}
+
+	return allowedDomains, nil
+}
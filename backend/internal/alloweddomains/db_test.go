@@ -0,0 +1,75 @@
+package alloweddomains
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/testutil"
+)
+
+func TestAllowedDomainsDB_Insert(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	allowedDomainsDB := New(database)
+
+	ctx := context.Background()
+
+	err := allowedDomainsDB.Insert(ctx, "cdn.example.com", true)
+	require.NoError(t, err)
+
+	var recursive bool
+	err = pool.QueryRow(ctx, "SELECT recursive FROM allowed_domains WHERE domain = $1", "cdn.example.com").
+		Scan(&recursive)
+	require.NoError(t, err)
+	assert.True(t, recursive)
+}
+
+func TestAllowedDomainsDB_GetAll(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	allowedDomainsDB := New(database)
+
+	ctx := context.Background()
+
+	require.NoError(t, allowedDomainsDB.Insert(ctx, "cdn.example.com", true))
+	require.NoError(t, allowedDomainsDB.Insert(ctx, "login.example.com", false))
+	require.NoError(t, allowedDomainsDB.Insert(ctx, "gone.example.com", false))
+
+	_, err := pool.Exec(ctx, "UPDATE allowed_domains SET deleted_at = NOW() WHERE domain = $1", "gone.example.com")
+	require.NoError(t, err)
+
+	results, err := allowedDomainsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	domainMap := make(map[string]bool)
+	for _, result := range results {
+		domainMap[result.Domain] = result.Recursive
+	}
+
+	assert.True(t, domainMap["cdn.example.com"])
+	assert.False(t, domainMap["login.example.com"])
+}
+
+func TestAllowedDomainsDB_GetAll_Empty(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	allowedDomainsDB := New(database)
+
+	results, err := allowedDomainsDB.GetAll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
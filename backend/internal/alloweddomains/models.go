@@ -0,0 +1,18 @@
+package alloweddomains
+
+import "time"
+
+type AllowedDomain struct {
+	ID        int64
+	Domain    string
+	Recursive bool
+	// SubscriptionID is the list the rule was imported from, nil for rules
+	// added by hand.
+	SubscriptionID *int64
+	// GroupID scopes the rule to the clients of a group, nil for rules that
+	// apply to every client.
+	GroupID   *int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
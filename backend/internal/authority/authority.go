@@ -0,0 +1,197 @@
+package authority
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const reloadInterval = 10 * time.Second
+
+var (
+	ErrInvalidZone      = fmt.Errorf("invalid zone")
+	ErrNotAuthoritative = fmt.Errorf("not authoritative")
+	ErrTransferRefused  = fmt.Errorf("transfer refused")
+)
+
+type ZoneOptions struct {
+	Name string
+	// File is an RFC 1035 zone file, reloaded when it changes.
+	File string
+	// AllowTransfer lists the IPs and CIDRs of the secondaries allowed to
+	// transfer the zone with AXFR.
+	AllowTransfer []string
+}
+
+type Options struct {
+	Zones []ZoneOptions
+}
+
+// Authority serves zones from zone files.
+type Authority interface {
+	// Answer returns the authoritative answer to req, or false when its
+	// question is not within any of the zones.
+	Answer(req *dns.Msg) (*dns.Msg, bool)
+	// Serves reports whether name is within any of the zones.
+	Serves(name string) bool
+	// Transfer returns the records of zone for an AXFR requested by from,
+	// starting and ending with its SOA.
+	Transfer(zone string, from netip.Addr) ([]dns.RR, error)
+	Start()
+	Stop()
+}
+
+type authority struct {
+	// zones are sorted from the most to the least specific, so subzones
+	// hosted separately take precedence over their parents.
+	zones []*zone
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New loads the zone files, failing when any of them is invalid.
+func New(opts Options) (Authority, error) {
+	a := &authority{stop: make(chan struct{})}
+	for _, zo := range opts.Zones {
+		if zo.Name == "" || zo.File == "" {
+			return nil, fmt.Errorf("%w: %q needs a name and a file", ErrInvalidZone, zo.Name)
+		}
+
+		z := &zone{name: dns.CanonicalName(zo.Name), file: zo.File}
+		for _, allowed := range zo.AllowTransfer {
+			prefix, err := parsePrefix(allowed)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q allows transfers to %q", ErrInvalidZone, zo.Name, allowed)
+			}
+			z.allowTransfer = append(z.allowTransfer, prefix)
+		}
+
+		if _, err := z.reloadIfChanged(); err != nil {
+			return nil, fmt.Errorf("zone %s: %w", z.name, err)
+		}
+
+		a.zones = append(a.zones, z)
+	}
+
+	sort.SliceStable(a.zones, func(i, j int) bool {
+		return dns.CountLabel(a.zones[i].name) > dns.CountLabel(a.zones[j].name)
+	})
+
+	return a, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// find returns the most specific zone name falls within.
+func (a *authority) find(name string) (*zone, bool) {
+	name = dns.CanonicalName(name)
+	for _, z := range a.zones {
+		if dns.IsSubDomain(z.name, name) {
+			return z, true
+		}
+	}
+
+	return nil, false
+}
+
+func (a *authority) Serves(name string) bool {
+	_, ok := a.find(name)
+	return ok
+}
+
+func (a *authority) Answer(req *dns.Msg) (*dns.Msg, bool) {
+	if len(req.Question) == 0 {
+		return nil, false
+	}
+
+	q := req.Question[0]
+	z, ok := a.find(q.Name)
+	if !ok {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	z.data.Load().answer(m, q)
+	return m, true
+}
+
+func (a *authority) Transfer(name string, from netip.Addr) ([]dns.RR, error) {
+	name = dns.CanonicalName(name)
+	for _, z := range a.zones {
+		if z.name != name {
+			continue
+		}
+
+		if !z.transferAllowed(from) {
+			return nil, fmt.Errorf("%w: %s to %s", ErrTransferRefused, name, from)
+		}
+
+		data := z.data.Load()
+		rrs := make([]dns.RR, 0, len(data.rrs)+2)
+		rrs = append(rrs, data.soa)
+		rrs = append(rrs, data.rrs...)
+		return append(rrs, data.soa), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotAuthoritative, name)
+}
+
+// Start polls the zone files for changes until Stop is called.
+func (a *authority) Start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(reloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+			}
+
+			a.reload()
+		}
+	}()
+}
+
+func (a *authority) reload() {
+	for _, z := range a.zones {
+		if _, err := z.reloadIfChanged(); err != nil {
+			log.Printf("Failed to reload zone %s: %s\n", z.name, err.Error())
+		}
+	}
+}
+
+func (a *authority) Stop() {
+	close(a.stop)
+	a.wg.Wait()
+}
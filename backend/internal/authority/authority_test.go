@@ -0,0 +1,248 @@
+package authority
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testZone = `$TTL 3600
+@       IN SOA  ns1.corp.internal. admin.corp.internal. 1 3600 600 86400 300
+@       IN NS   ns1
+ns1     IN A    10.0.0.53
+www     IN A    10.0.0.80
+www     IN AAAA fd00::80
+web     IN CNAME www
+ext     IN CNAME example.com.
+chain   IN CNAME web
+*.apps  IN A    10.0.0.90
+a.b.c   IN TXT  "deep"
+lab     IN NS   ns.lab
+lab     IN DS   12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF
+ns.lab  IN A    10.0.1.53
+`
+
+func writeZone(t *testing.T, dir, content string) string {
+	t.Helper()
+
+	file := filepath.Join(dir, "corp.internal.zone")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+func newTestAuthority(t *testing.T) (*authority, string) {
+	t.Helper()
+
+	file := writeZone(t, t.TempDir(), testZone)
+	a, err := New(Options{Zones: []ZoneOptions{
+		{Name: "Corp.Internal", File: file, AllowTransfer: []string{"192.168.0.2", "10.1.0.0/16"}},
+	}})
+	require.NoError(t, err)
+
+	return a.(*authority), file
+}
+
+func query(t *testing.T, a Authority, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	resp, ok := a.Answer(req)
+	require.True(t, ok, name)
+	return resp
+}
+
+func TestNew_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := New(Options{Zones: []ZoneOptions{{Name: "corp.internal"}}})
+	assert.ErrorIs(t, err, ErrInvalidZone)
+
+	file := writeZone(t, dir, "www IN A 10.0.0.80\n")
+	_, err = New(Options{Zones: []ZoneOptions{{Name: "corp.internal", File: file}}})
+	assert.ErrorIs(t, err, ErrInvalidZone)
+
+	file = writeZone(t, dir, testZone+"www.example.com. IN A 10.0.0.1\n")
+	_, err = New(Options{Zones: []ZoneOptions{{Name: "corp.internal", File: file}}})
+	assert.ErrorIs(t, err, ErrInvalidZone)
+
+	file = writeZone(t, dir, testZone)
+	_, err = New(Options{Zones: []ZoneOptions{{Name: "corp.internal", File: file, AllowTransfer: []string{"any"}}}})
+	assert.ErrorIs(t, err, ErrInvalidZone)
+
+	_, err = New(Options{Zones: []ZoneOptions{{Name: "corp.internal", File: filepath.Join(dir, "missing")}}})
+	assert.Error(t, err)
+}
+
+func TestAuthority_Answer(t *testing.T) {
+	a, _ := newTestAuthority(t)
+
+	resp := query(t, a, "WWW.corp.internal.", dns.TypeA)
+	assert.True(t, resp.Authoritative)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "WWW.corp.internal.", resp.Answer[0].Header().Name)
+	assert.Equal(t, "10.0.0.80", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query(t, a, "corp.internal.", dns.TypeNS)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "ns1.corp.internal.", resp.Answer[0].(*dns.NS).Ns)
+
+	resp = query(t, a, "chain.corp.internal.", dns.TypeAAAA)
+	require.Len(t, resp.Answer, 3)
+	assert.Equal(t, "web.corp.internal.", resp.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "www.corp.internal.", resp.Answer[1].(*dns.CNAME).Target)
+	assert.Equal(t, "fd00::80", resp.Answer[2].(*dns.AAAA).AAAA.String())
+
+	// Out of zone targets are left to the client.
+	resp = query(t, a, "ext.corp.internal.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "example.com.", resp.Answer[0].(*dns.CNAME).Target)
+
+	resp = query(t, a, "api.apps.corp.internal.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "api.apps.corp.internal.", resp.Answer[0].Header().Name)
+	assert.Equal(t, "10.0.0.90", resp.Answer[0].(*dns.A).A.String())
+}
+
+func TestAuthority_Answer_Negative(t *testing.T) {
+	a, _ := newTestAuthority(t)
+
+	resp := query(t, a, "missing.corp.internal.", dns.TypeA)
+	assert.True(t, resp.Authoritative)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	require.Len(t, resp.Ns, 1)
+	soa := resp.Ns[0].(*dns.SOA)
+	assert.Equal(t, "corp.internal.", soa.Hdr.Name)
+	assert.Equal(t, uint32(300), soa.Hdr.Ttl)
+
+	resp = query(t, a, "www.corp.internal.", dns.TypeMX)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	require.Len(t, resp.Ns, 1)
+	assert.IsType(t, &dns.SOA{}, resp.Ns[0])
+
+	// Empty non-terminals exist, and stop wildcards below them.
+	resp = query(t, a, "b.c.corp.internal.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+
+	resp = query(t, a, "apps.corp.internal.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+
+	resp = query(t, a, "x.b.c.corp.internal.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+}
+
+func TestAuthority_Answer_Delegation(t *testing.T) {
+	a, _ := newTestAuthority(t)
+
+	for _, name := range []string{"lab.corp.internal.", "host.lab.corp.internal."} {
+		resp := query(t, a, name, dns.TypeA)
+		assert.False(t, resp.Authoritative, name)
+		assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+		assert.Empty(t, resp.Answer)
+		require.Len(t, resp.Ns, 1)
+		assert.Equal(t, "ns.lab.corp.internal.", resp.Ns[0].(*dns.NS).Ns)
+		require.Len(t, resp.Extra, 1)
+		assert.Equal(t, "10.0.1.53", resp.Extra[0].(*dns.A).A.String())
+	}
+
+	// DS records are served by the parent.
+	resp := query(t, a, "lab.corp.internal.", dns.TypeDS)
+	assert.True(t, resp.Authoritative)
+	require.Len(t, resp.Answer, 1)
+	assert.IsType(t, &dns.DS{}, resp.Answer[0])
+}
+
+func TestAuthority_Answer_OutOfZone(t *testing.T) {
+	a, _ := newTestAuthority(t)
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	_, ok := a.Answer(req)
+	assert.False(t, ok)
+
+	req.SetQuestion("notcorp.internal.", dns.TypeA)
+	_, ok = a.Answer(req)
+	assert.False(t, ok)
+}
+
+func TestAuthority_Transfer(t *testing.T) {
+	a, _ := newTestAuthority(t)
+
+	rrs, err := a.Transfer("corp.internal.", netip.MustParseAddr("192.168.0.2"))
+	require.NoError(t, err)
+	require.Len(t, rrs, 14)
+	assert.IsType(t, &dns.SOA{}, rrs[0])
+	assert.IsType(t, &dns.SOA{}, rrs[len(rrs)-1])
+
+	_, err = a.Transfer("corp.internal.", netip.MustParseAddr("::ffff:10.1.2.3"))
+	assert.NoError(t, err)
+
+	_, err = a.Transfer("corp.internal.", netip.MustParseAddr("192.168.0.3"))
+	assert.ErrorIs(t, err, ErrTransferRefused)
+
+	_, err = a.Transfer("other.internal.", netip.MustParseAddr("192.168.0.2"))
+	assert.ErrorIs(t, err, ErrNotAuthoritative)
+}
+
+func TestAuthority_Reload(t *testing.T) {
+	a, file := newTestAuthority(t)
+
+	updated := testZone + "new IN A 10.0.0.100\n"
+	require.NoError(t, os.WriteFile(file, []byte(updated), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(file, later, later))
+
+	a.reload()
+	resp := query(t, a, "new.corp.internal.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+
+	// A broken file keeps the loaded zone.
+	require.NoError(t, os.WriteFile(file, []byte("garbage IN A\n"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(file, later, later))
+
+	a.reload()
+	resp = query(t, a, "new.corp.internal.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+
+	// An older copy put back is loaded too.
+	require.NoError(t, os.WriteFile(file, []byte(testZone), 0o600))
+	earlier := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(file, earlier, earlier))
+
+	a.reload()
+	resp = query(t, a, "new.corp.internal.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+}
+
+func TestAuthority_MostSpecificZone(t *testing.T) {
+	dir := t.TempDir()
+	parentFile := filepath.Join(dir, "parent.zone")
+	childFile := filepath.Join(dir, "child.zone")
+	require.NoError(t, os.WriteFile(parentFile, []byte(testZone), 0o600))
+	require.NoError(t, os.WriteFile(childFile, []byte(`$TTL 60
+@    IN SOA ns.lab.corp.internal. admin.corp.internal. 7 3600 600 86400 60
+host IN A   10.0.1.10
+`), 0o600))
+
+	a, err := New(Options{Zones: []ZoneOptions{
+		{Name: "corp.internal", File: parentFile},
+		{Name: "lab.corp.internal", File: childFile},
+	}})
+	require.NoError(t, err)
+
+	resp := query(t, a, "host.lab.corp.internal.", dns.TypeA)
+	assert.True(t, resp.Authoritative)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.1.10", resp.Answer[0].(*dns.A).A.String())
+}
@@ -0,0 +1,253 @@
+package authority
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEs bounds the CNAME chains followed within a zone.
+const maxCNAMEs = 8
+
+// zoneData is a loaded copy of a zone, replaced whole on reload.
+type zoneData struct {
+	soa *dns.SOA
+	// records holds the records by lower cased owner name.
+	records map[string][]dns.RR
+	// names holds every owner name along with the empty non-terminals
+	// between them and the apex.
+	names map[string]struct{}
+	// rrs holds every record but the SOA in file order, for transfers.
+	rrs []dns.RR
+}
+
+type zone struct {
+	name          string
+	file          string
+	allowTransfer []netip.Prefix
+
+	// modTime and size are those of the file the loaded copy came from.
+	modTime time.Time
+	size    int64
+	data    atomic.Pointer[zoneData]
+}
+
+// reloadIfChanged loads the zone file when its modification time or size
+// differ from the loaded copy's, so older copies put back are loaded too. On
+// error the loaded copy is kept.
+func (z *zone) reloadIfChanged() (bool, error) {
+	info, err := os.Stat(z.file)
+	if err != nil {
+		return false, err
+	}
+
+	if z.data.Load() != nil && info.ModTime().Equal(z.modTime) && info.Size() == z.size {
+		return false, nil
+	}
+
+	data, err := loadZone(z.name, z.file)
+	if err != nil {
+		return false, err
+	}
+
+	z.data.Store(data)
+	z.modTime = info.ModTime()
+	z.size = info.Size()
+	log.Printf("Loaded zone %s serial %d with %d records\n", z.name, data.soa.Serial, len(data.rrs)+1)
+	return true, nil
+}
+
+func loadZone(name, file string) (*zoneData, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := &zoneData{
+		records: make(map[string][]dns.RR),
+		names:   make(map[string]struct{}),
+	}
+
+	zp := dns.NewZoneParser(f, name, file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+		if !dns.IsSubDomain(name, owner) {
+			return nil, fmt.Errorf("%w: %s is outside of %s", ErrInvalidZone, rr.Header().Name, name)
+		}
+
+		if soa, ok := rr.(*dns.SOA); ok {
+			if owner != name || data.soa != nil {
+				return nil, fmt.Errorf("%w: unexpected SOA at %s", ErrInvalidZone, rr.Header().Name)
+			}
+			data.soa = soa
+		} else {
+			data.rrs = append(data.rrs, rr)
+		}
+
+		data.records[owner] = append(data.records[owner], rr)
+		for n := owner; n != name; n = parent(n) {
+			data.names[n] = struct{}{}
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	if data.soa == nil {
+		return nil, fmt.Errorf("%w: %s has no SOA record", ErrInvalidZone, file)
+	}
+	data.names[name] = struct{}{}
+
+	return data, nil
+}
+
+// transferAllowed reports whether from may transfer the zone.
+func (z *zone) transferAllowed(from netip.Addr) bool {
+	from = from.Unmap()
+	for _, prefix := range z.allowTransfer {
+		if prefix.Contains(from) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// answer fills m with the answer to q, following RFC 1034, section 4.3.2:
+// names below a delegation get a referral with glue, CNAMEs are followed
+// within the zone, wildcards are expanded and missing names or types get
+// the SOA for negative caching.
+func (zd *zoneData) answer(m *dns.Msg, q dns.Question) {
+	name := strings.ToLower(q.Name)
+	owner := q.Name
+
+	for i := 0; i < maxCNAMEs; i++ {
+		if ns, ok := zd.delegation(name, q.Qtype); ok {
+			// Answers collected before the referral stay authoritative.
+			m.Authoritative = len(m.Answer) > 0
+			m.Ns = ns
+			m.Extra = append(m.Extra, zd.glue(ns)...)
+			return
+		}
+
+		rrs, ok := zd.records[name]
+		if !ok {
+			if _, ok := zd.names[name]; ok {
+				m.Ns = []dns.RR{zd.negativeSOA()}
+				return
+			}
+
+			if rrs, ok = zd.records["*."+zd.closestEncloser(name)]; !ok {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = []dns.RR{zd.negativeSOA()}
+				return
+			}
+		}
+
+		if answer := matching(rrs, owner, q.Qtype); len(answer) > 0 {
+			m.Answer = append(m.Answer, answer...)
+			return
+		}
+
+		cnames := matching(rrs, owner, dns.TypeCNAME)
+		if len(cnames) == 0 {
+			m.Ns = []dns.RR{zd.negativeSOA()}
+			return
+		}
+
+		cname := cnames[0].(*dns.CNAME)
+		m.Answer = append(m.Answer, cname)
+		if !dns.IsSubDomain(zd.soa.Hdr.Name, strings.ToLower(cname.Target)) {
+			return
+		}
+		name, owner = strings.ToLower(cname.Target), cname.Target
+	}
+}
+
+// delegation returns the NS records of the zone cut at or above name, if
+// any. DS records at a cut belong to the zone, so they are not referred.
+func (zd *zoneData) delegation(name string, qtype uint16) ([]dns.RR, bool) {
+	apex := zd.soa.Hdr.Name
+	var cut []dns.RR
+	for n := name; n != apex && dns.IsSubDomain(apex, n); n = parent(n) {
+		if n == name && qtype == dns.TypeDS {
+			continue
+		}
+		if ns := matching(zd.records[n], n, dns.TypeNS); len(ns) > 0 {
+			// The topmost cut wins, names below it belong to the child.
+			cut = ns
+		}
+	}
+
+	return cut, cut != nil
+}
+
+// glue returns the addresses of the name servers in ns that are in the
+// zone.
+func (zd *zoneData) glue(ns []dns.RR) []dns.RR {
+	var glue []dns.RR
+	for _, rr := range ns {
+		target := strings.ToLower(rr.(*dns.NS).Ns)
+		if !dns.IsSubDomain(zd.soa.Hdr.Name, target) {
+			continue
+		}
+
+		glue = append(glue, matching(zd.records[target], target, dns.TypeA)...)
+		glue = append(glue, matching(zd.records[target], target, dns.TypeAAAA)...)
+	}
+
+	return glue
+}
+
+// closestEncloser returns the longest existing ancestor of name.
+func (zd *zoneData) closestEncloser(name string) string {
+	for n := parent(name); n != "."; n = parent(n) {
+		if _, ok := zd.names[n]; ok {
+			return n
+		}
+	}
+
+	return zd.soa.Hdr.Name
+}
+
+// negativeSOA returns the SOA for negative answers, whose TTL is the
+// lower of its own and its minimum (RFC 2308, section 3).
+func (zd *zoneData) negativeSOA() dns.RR {
+	soa := dns.Copy(zd.soa).(*dns.SOA)
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+	return soa
+}
+
+// matching returns copies of the records of rrs matching qtype, owned by
+// owner.
+func matching(rrs []dns.RR, owner string, qtype uint16) []dns.RR {
+	var res []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != qtype && qtype != dns.TypeANY {
+			continue
+		}
+
+		rr = dns.Copy(rr)
+		rr.Header().Name = owner
+		res = append(res, rr)
+	}
+
+	return res
+}
+
+// parent returns name without its first label.
+func parent(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+
+	return name[off:]
+}
@@ -14,7 +14,9 @@ type blockedDomainsDB struct {
 
 type DB interface {
 	Insert(ctx context.Context, domain string, recursive bool) error
+	InsertRule(ctx context.Context, rule BlockedDomain) error
 	GetAll(ctx context.Context) ([]BlockedDomain, error)
+	SetResponse(ctx context.Context, id int64, response, sinkholeIPv4, sinkholeIPv6 string) error
 }
 
 func New(db *db.DB) DB {
@@ -33,9 +35,34 @@ func (b *blockedDomainsDB) Insert(ctx context.Context, domain string, recursive
 	return nil
 }
 
+// InsertRule inserts a rule with all of its settings. An empty Kind inserts
+// a domain rule.
+func (b *blockedDomainsDB) InsertRule(ctx context.Context, rule BlockedDomain) error {
+	if rule.Kind == "" {
+		rule.Kind = KindDomain
+	}
+	if rule.QTypes == nil {
+		rule.QTypes = []string{}
+	}
+
+	_, err := b.db.Exec(ctx, `
+		INSERT INTO blocked_domains (
+			domain, recursive, kind, qtypes, response, sinkhole_ipv4, sinkhole_ipv6, group_id, schedule_id
+		)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, rule.Domain, rule.Recursive, rule.Kind, rule.QTypes, rule.Response, rule.SinkholeIPv4, rule.SinkholeIPv6,
+		rule.GroupID, rule.ScheduleID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (b *blockedDomainsDB) GetAll(ctx context.Context) ([]BlockedDomain, error) {
 	rows, err := b.db.Query(ctx, `
-		SELECT id, domain, recursive, created_at, updated_at, deleted_at
+		SELECT id, domain, recursive, kind, qtypes, response, sinkhole_ipv4, sinkhole_ipv6,
+			subscription_id, group_id, schedule_id, created_at, updated_at, deleted_at
 		FROM blocked_domains
 	`)
 	if err != nil {
@@ -49,3 +76,18 @@ func (b *blockedDomainsDB) GetAll(ctx context.Context) ([]BlockedDomain, error)
 
 	return blockedDomains, nil
 }
+
+func (b *blockedDomainsDB) SetResponse(
+	ctx context.Context, id int64, response, sinkholeIPv4, sinkholeIPv6 string,
+) error {
+	_, err := b.db.Exec(ctx, `
+		UPDATE blocked_domains
+		SET response = $2, sinkhole_ipv4 = $3, sinkhole_ipv6 = $4, updated_at = NOW()
+		WHERE id = $1
+	`, id, response, sinkholeIPv4, sinkholeIPv6)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -105,3 +105,66 @@ func TestBlockedDomainsDB_GetAll_Empty(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, results)
 }
+
+func TestBlockedDomainsDB_SetResponse(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	blockedDomainsDB := New(database)
+
+	ctx := context.Background()
+
+	err := blockedDomainsDB.Insert(ctx, "malware.com", false)
+	require.NoError(t, err)
+
+	results, err := blockedDomainsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Response)
+
+	err = blockedDomainsDB.SetResponse(ctx, results[0].ID, ResponseSinkhole, "192.0.2.1", "2001:db8::1")
+	require.NoError(t, err)
+
+	results, err = blockedDomainsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, ResponseSinkhole, results[0].Response)
+	assert.Equal(t, "192.0.2.1", results[0].SinkholeIPv4)
+	assert.Equal(t, "2001:db8::1", results[0].SinkholeIPv6)
+}
+
+func TestBlockedDomainsDB_InsertRule(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	blockedDomainsDB := New(database)
+
+	ctx := context.Background()
+
+	err := blockedDomainsDB.InsertRule(ctx, BlockedDomain{
+		Domain: `^track[0-9]+\.`,
+		Kind:   KindRegex,
+		QTypes: []string{"A", "AAAA"},
+	})
+	require.NoError(t, err)
+	err = blockedDomainsDB.InsertRule(ctx, BlockedDomain{Domain: "malware.com"})
+	require.NoError(t, err)
+
+	results, err := blockedDomainsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	rules := make(map[string]BlockedDomain)
+	for _, result := range results {
+		rules[result.Domain] = result
+	}
+
+	assert.Equal(t, KindRegex, rules[`^track[0-9]+\.`].Kind)
+	assert.Equal(t, []string{"A", "AAAA"}, rules[`^track[0-9]+\.`].QTypes)
+	assert.Equal(t, KindDomain, rules["malware.com"].Kind)
+	assert.Empty(t, rules["malware.com"].QTypes)
+}
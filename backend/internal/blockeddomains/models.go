@@ -2,11 +2,47 @@ package blockeddomains
 
 import "time"
 
+// Responses a blocked query can be answered with.
+const (
+	ResponseNXDomain = "nxdomain"
+	ResponseRefused  = "refused"
+	ResponseNoData   = "nodata"
+	ResponseNullIP   = "null_ip"
+	ResponseSinkhole = "sinkhole"
+)
+
+// Kinds of rules. Domain rules match Domain itself, glob rules treat it as
+// a pattern where * and ? match within a label, and regex rules as an
+// anchored regular expression over the name without its trailing dot.
+const (
+	KindDomain = "domain"
+	KindGlob   = "glob"
+	KindRegex  = "regex"
+)
+
 type BlockedDomain struct {
 	ID        int64
 	Domain    string
 	Recursive bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt *time.Time
+	Kind      string
+	// QTypes restricts the rule to these query types, like "A" or "HTTPS".
+	// An empty list matches every type.
+	QTypes []string
+	// Response overrides the server default when set. SinkholeIPv4 and
+	// SinkholeIPv6 override the default sinkhole addresses.
+	Response     string
+	SinkholeIPv4 string
+	SinkholeIPv6 string
+	// SubscriptionID is the list the rule was imported from, nil for rules
+	// added by hand.
+	SubscriptionID *int64
+	// GroupID scopes the rule to the clients of a group, nil for rules that
+	// apply to every client.
+	GroupID *int64
+	// ScheduleID limits the rule to the times its schedule is active, nil
+	// for rules that always apply.
+	ScheduleID *int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  *time.Time
 }
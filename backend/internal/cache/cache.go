@@ -0,0 +1,325 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultMaxEntries     = 10000
+	defaultMaxNegativeTTL = time.Hour
+	// RFC 8767 recommends 30 seconds for records served stale.
+	defaultStaleTTL = 30 * time.Second
+
+	// An entry is due for prefetch once less than 1/prefetchRatio of its
+	// lifetime remains.
+	prefetchRatio = 10
+)
+
+// Key identifies a cached answer. Names are stored lower case so lookups are
+// case insensitive. CD is part of the key so answers fetched with checking
+// disabled are never served to clients that expect validated data.
+type Key struct {
+	Name   string
+	Qtype  uint16
+	Qclass uint16
+	DO     bool
+	CD     bool
+}
+
+type Options struct {
+	MaxEntries int
+	// MaxNegativeTTL caps how long NXDOMAIN and NODATA answers are cached.
+	MaxNegativeTTL time.Duration
+	// StaleMaxAge is how long expired entries are kept to be served while
+	// the upstream is unreachable. Zero disables serve-stale.
+	StaleMaxAge time.Duration
+	StaleTTL    time.Duration
+}
+
+type Cache interface {
+	// Get returns a copy of the cached answer for req with the TTLs decremented
+	// by the time spent in the cache and the ID set to match req.
+	Get(req *dns.Msg) (*dns.Msg, bool)
+	// GetStale returns an expired answer for req with its TTLs set to the
+	// stale TTL, as long as it is within the stale window.
+	GetStale(req *dns.Msg) (*dns.Msg, bool)
+	// ShouldPrefetch reports whether the entry for req is close to expiring
+	// and has not been handed out for prefetch yet.
+	ShouldPrefetch(req *dns.Msg) bool
+	Set(req, resp *dns.Msg)
+	Len() int
+}
+
+type entry struct {
+	key         Key
+	msg         *dns.Msg
+	storedAt    time.Time
+	expiresAt   time.Time
+	prefetching bool
+}
+
+type cache struct {
+	mu         sync.Mutex
+	entries    map[Key]*list.Element
+	lru        *list.List
+	maxEntries int
+	// Ceiling for negative answers, in seconds.
+	maxNegativeTTL uint32
+	staleMaxAge    time.Duration
+	staleTTL       uint32
+
+	now func() time.Time
+}
+
+func New(opts Options) Cache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultMaxEntries
+	}
+	if opts.MaxNegativeTTL <= 0 {
+		opts.MaxNegativeTTL = defaultMaxNegativeTTL
+	}
+	if opts.StaleTTL <= 0 {
+		opts.StaleTTL = defaultStaleTTL
+	}
+
+	return &cache{
+		entries:        make(map[Key]*list.Element),
+		lru:            list.New(),
+		maxEntries:     opts.MaxEntries,
+		maxNegativeTTL: uint32(opts.MaxNegativeTTL / time.Second),
+		staleMaxAge:    opts.StaleMaxAge,
+		staleTTL:       uint32(opts.StaleTTL / time.Second),
+		now:            time.Now,
+	}
+}
+
+func KeyFromMsg(msg *dns.Msg) (Key, bool) {
+	if len(msg.Question) == 0 {
+		return Key{}, false
+	}
+
+	q := msg.Question[0]
+	key := Key{
+		Name:   strings.ToLower(q.Name),
+		Qtype:  q.Qtype,
+		Qclass: q.Qclass,
+		CD:     msg.CheckingDisabled,
+	}
+	if opt := msg.IsEdns0(); opt != nil {
+		key.DO = opt.Do()
+	}
+
+	return key, true
+}
+
+func (c *cache) Get(req *dns.Msg) (*dns.Msg, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	e, ok := c.lookup(req, now)
+	if !ok || !now.Before(e.expiresAt) {
+		return nil, false
+	}
+
+	elapsed := uint32(now.Sub(e.storedAt) / time.Second)
+	return prepare(e.msg, req, func(ttl uint32) uint32 {
+		if ttl > elapsed {
+			return ttl - elapsed
+		}
+		return 0
+	}), true
+}
+
+func (c *cache) GetStale(req *dns.Msg) (*dns.Msg, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.staleMaxAge <= 0 {
+		return nil, false
+	}
+
+	e, ok := c.lookup(req, c.now())
+	if !ok {
+		return nil, false
+	}
+
+	return prepare(e.msg, req, func(ttl uint32) uint32 {
+		return min(ttl, c.staleTTL)
+	}), true
+}
+
+func (c *cache) ShouldPrefetch(req *dns.Msg) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	e, ok := c.lookup(req, now)
+	if !ok || e.prefetching || !now.Before(e.expiresAt) {
+		return false
+	}
+
+	lifetime := e.expiresAt.Sub(e.storedAt)
+	if e.expiresAt.Sub(now) > lifetime/prefetchRatio {
+		return false
+	}
+
+	e.prefetching = true
+	return true
+}
+
+// lookup returns the entry for req, including expired entries that are still
+// within the stale window. Entries past it are dropped. Callers must hold mu.
+func (c *cache) lookup(req *dns.Msg, now time.Time) (*entry, bool) {
+	key, ok := KeyFromMsg(req)
+	if !ok {
+		return nil, false
+	}
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !now.Before(e.expiresAt.Add(c.staleMaxAge)) {
+		c.remove(el)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+func (c *cache) Set(req, resp *dns.Msg) {
+	key, ok := KeyFromMsg(req)
+	if !ok {
+		return
+	}
+
+	msg := resp.Copy()
+	ttl, ok := c.cacheableTTL(msg)
+	if !ok {
+		return
+	}
+
+	now := c.now()
+	e := &entry{
+		key:       key,
+		msg:       msg,
+		storedAt:  now,
+		expiresAt: now.Add(time.Duration(ttl) * time.Second),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
+
+// cacheableTTL returns how long msg can be cached. Positive answers live as
+// long as their lowest record TTL, negative ones follow RFC 2308.
+func (c *cache) cacheableTTL(msg *dns.Msg) (uint32, bool) {
+	if msg.Truncated {
+		return 0, false
+	}
+
+	switch {
+	case msg.Rcode == dns.RcodeNameError, msg.Rcode == dns.RcodeSuccess && len(msg.Answer) == 0:
+		return c.negativeTTL(msg)
+	case msg.Rcode == dns.RcodeSuccess:
+		ttl, found := minTTL(msg)
+		if !found || ttl == 0 {
+			return 0, false
+		}
+		return ttl, true
+	}
+
+	return 0, false
+}
+
+// negativeTTL takes the lower of the SOA TTL and its MINIMUM field, capped by
+// the configured ceiling. The SOA TTL is rewritten to match so clients cache
+// the answer for the same time. Answers without a SOA are not cached.
+func (c *cache) negativeTTL(msg *dns.Msg) (uint32, bool) {
+	for _, rr := range msg.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+
+		ttl := min(soa.Hdr.Ttl, soa.Minttl, c.maxNegativeTTL)
+		if ttl == 0 {
+			return 0, false
+		}
+
+		soa.Hdr.Ttl = ttl
+		return ttl, true
+	}
+
+	return 0, false
+}
+
+func minTTL(msg *dns.Msg) (uint32, bool) {
+	var ttl uint32
+	found := false
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+
+	return ttl, found
+}
+
+// prepare builds the answer served to req from a cached message, adjusting
+// every record TTL with ttlFn.
+func prepare(cached, req *dns.Msg, ttlFn func(ttl uint32) uint32) *dns.Msg {
+	msg := cached.Copy()
+	msg.Id = req.Id
+	msg.Question = append([]dns.Question(nil), req.Question...)
+
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+			h.Ttl = ttlFn(h.Ttl)
+		}
+	}
+
+	return msg
+}
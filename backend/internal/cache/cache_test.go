@@ -0,0 +1,331 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func newTestCache(maxEntries int) (*cache, *testClock) {
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(Options{MaxEntries: maxEntries}).(*cache)
+	c.now = clock.now
+	return c, clock
+}
+
+func request(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	return m
+}
+
+func answer(req *dns.Msg, records ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	for _, r := range records {
+		rr, _ := dns.NewRR(r)
+		m.Answer = append(m.Answer, rr)
+	}
+	return m
+}
+
+func TestKeyFromMsg(t *testing.T) {
+	req := request("Example.COM.", dns.TypeAAAA)
+	key, ok := KeyFromMsg(req)
+	require.True(t, ok)
+	assert.Equal(t, Key{Name: "example.com.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET}, key)
+
+	req.SetEdns0(4096, true)
+	key, ok = KeyFromMsg(req)
+	require.True(t, ok)
+	assert.True(t, key.DO)
+
+	req.CheckingDisabled = true
+	key, ok = KeyFromMsg(req)
+	require.True(t, ok)
+	assert.True(t, key.CD)
+
+	_, ok = KeyFromMsg(new(dns.Msg))
+	assert.False(t, ok)
+}
+
+func TestCache_Get_RewritesIDAndDecrementsTTL(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1", "example.com. 100 IN A 10.0.0.2"))
+
+	clock.t = clock.t.Add(40 * time.Second)
+
+	clientReq := request("EXAMPLE.com.", dns.TypeA)
+	resp, ok := c.Get(clientReq)
+	require.True(t, ok)
+	assert.Equal(t, clientReq.Id, resp.Id)
+	assert.Equal(t, "EXAMPLE.com.", resp.Question[0].Name)
+	assert.Equal(t, uint32(260), resp.Answer[0].Header().Ttl)
+	assert.Equal(t, uint32(60), resp.Answer[1].Header().Ttl)
+}
+
+func TestCache_Get_ExpiresAtLowestTTL(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1", "example.com. 100 IN A 10.0.0.2"))
+
+	clock.t = clock.t.Add(100 * time.Second)
+
+	_, ok := c.Get(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCache_Get_DoesNotMutateCachedEntry(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1"))
+
+	resp, ok := c.Get(req)
+	require.True(t, ok)
+	resp.Answer[0].Header().Ttl = 1
+
+	resp, ok = c.Get(req)
+	require.True(t, ok)
+	assert.Equal(t, uint32(300), resp.Answer[0].Header().Ttl)
+}
+
+func TestCache_Key_SeparatesTypeAndDNSSECBits(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1"))
+
+	_, ok := c.Get(request("example.com.", dns.TypeAAAA))
+	assert.False(t, ok)
+
+	withDO := request("example.com.", dns.TypeA)
+	withDO.SetEdns0(4096, true)
+	_, ok = c.Get(withDO)
+	assert.False(t, ok)
+
+	withCD := request("example.com.", dns.TypeA)
+	withCD.CheckingDisabled = true
+	_, ok = c.Get(withCD)
+	assert.False(t, ok)
+}
+
+func TestCache_Set_SkipsUncacheable(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+
+	servfail := new(dns.Msg)
+	servfail.SetRcode(req, dns.RcodeServerFailure)
+	c.Set(req, servfail)
+
+	truncated := answer(req, "example.com. 300 IN A 10.0.0.1")
+	truncated.Truncated = true
+	c.Set(req, truncated)
+
+	c.Set(req, answer(req, "example.com. 0 IN A 10.0.0.1"))
+
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCache_Set_IgnoresOPTRecordTTL(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	resp := answer(req, "example.com. 300 IN A 10.0.0.1")
+	resp.SetEdns0(4096, true)
+	c.Set(req, resp)
+
+	cached, ok := c.Get(req)
+	require.True(t, ok)
+	require.NotNil(t, cached.IsEdns0())
+	assert.True(t, cached.IsEdns0().Do())
+}
+
+func negativeAnswer(req *dns.Msg, rcode int, soa string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetRcode(req, rcode)
+	rr, _ := dns.NewRR(soa)
+	m.Ns = append(m.Ns, rr)
+	return m
+}
+
+func TestCache_NegativeCaching_NXDOMAIN(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	req := request("typo.example.com.", dns.TypeA)
+	// SOA TTL 3600, MINIMUM 300: the lower of both is used.
+	c.Set(req, negativeAnswer(req, dns.RcodeNameError,
+		"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300"))
+
+	clock.t = clock.t.Add(100 * time.Second)
+
+	resp, ok := c.Get(req)
+	require.True(t, ok)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, uint32(200), resp.Ns[0].Header().Ttl)
+
+	clock.t = clock.t.Add(200 * time.Second)
+	_, ok = c.Get(req)
+	assert.False(t, ok)
+}
+
+func TestCache_NegativeCaching_NODATA(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("example.com.", dns.TypeAAAA)
+	c.Set(req, negativeAnswer(req, dns.RcodeSuccess,
+		"example.com. 60 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300"))
+
+	resp, ok := c.Get(req)
+	require.True(t, ok)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	assert.Equal(t, uint32(60), resp.Ns[0].Header().Ttl)
+}
+
+func TestCache_NegativeCaching_Ceiling(t *testing.T) {
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(Options{MaxEntries: 10, MaxNegativeTTL: 30 * time.Second}).(*cache)
+	c.now = clock.now
+
+	req := request("typo.example.com.", dns.TypeA)
+	c.Set(req, negativeAnswer(req, dns.RcodeNameError,
+		"example.com. 86400 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 86400"))
+
+	resp, ok := c.Get(req)
+	require.True(t, ok)
+	assert.Equal(t, uint32(30), resp.Ns[0].Header().Ttl)
+
+	clock.t = clock.t.Add(30 * time.Second)
+	_, ok = c.Get(req)
+	assert.False(t, ok)
+}
+
+func TestCache_NegativeCaching_WithoutSOA(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("typo.example.com.", dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetRcode(req, dns.RcodeNameError)
+	c.Set(req, resp)
+
+	// A NOERROR answer with only NS records is a referral, not NODATA.
+	referral := new(dns.Msg)
+	referral.SetReply(req)
+	ns, _ := dns.NewRR("example.com. 3600 IN NS ns1.example.com.")
+	referral.Ns = append(referral.Ns, ns)
+	c.Set(req, referral)
+
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCache_GetStale(t *testing.T) {
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(Options{MaxEntries: 10, StaleMaxAge: time.Hour}).(*cache)
+	c.now = clock.now
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1", "example.com. 10 IN A 10.0.0.2"))
+
+	clock.t = clock.t.Add(10 * time.Minute)
+
+	_, ok := c.Get(req)
+	assert.False(t, ok)
+
+	resp, ok := c.GetStale(req)
+	require.True(t, ok)
+	assert.Equal(t, req.Id, resp.Id)
+	assert.Equal(t, uint32(30), resp.Answer[0].Header().Ttl)
+	assert.Equal(t, uint32(10), resp.Answer[1].Header().Ttl)
+
+	clock.t = clock.t.Add(time.Hour)
+	_, ok = c.GetStale(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCache_GetStale_Disabled(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1"))
+
+	clock.t = clock.t.Add(10 * time.Minute)
+
+	_, ok := c.GetStale(req)
+	assert.False(t, ok)
+}
+
+func TestCache_ShouldPrefetch(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1"))
+
+	assert.False(t, c.ShouldPrefetch(req))
+
+	clock.t = clock.t.Add(280 * time.Second)
+	assert.True(t, c.ShouldPrefetch(req))
+	// Only one caller gets to refresh the entry.
+	assert.False(t, c.ShouldPrefetch(req))
+
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1"))
+	assert.False(t, c.ShouldPrefetch(req))
+
+	assert.False(t, c.ShouldPrefetch(request("missing.com.", dns.TypeA)))
+}
+
+func TestCache_LRUEviction(t *testing.T) {
+	c, _ := newTestCache(2)
+
+	first := request("first.com.", dns.TypeA)
+	second := request("second.com.", dns.TypeA)
+	third := request("third.com.", dns.TypeA)
+
+	c.Set(first, answer(first, "first.com. 300 IN A 10.0.0.1"))
+	c.Set(second, answer(second, "second.com. 300 IN A 10.0.0.2"))
+
+	// Touch first so second becomes the least recently used entry.
+	_, ok := c.Get(first)
+	require.True(t, ok)
+
+	c.Set(third, answer(third, "third.com. 300 IN A 10.0.0.3"))
+
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get(first)
+	assert.True(t, ok)
+	_, ok = c.Get(second)
+	assert.False(t, ok)
+	_, ok = c.Get(third)
+	assert.True(t, ok)
+}
+
+func TestCache_Set_ReplacesExisting(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	req := request("example.com.", dns.TypeA)
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.1"))
+	c.Set(req, answer(req, "example.com. 300 IN A 10.0.0.2"))
+
+	assert.Equal(t, 1, c.Len())
+	resp, ok := c.Get(req)
+	require.True(t, ok)
+	assert.Equal(t, "10.0.0.2", resp.Answer[0].(*dns.A).A.String())
+}
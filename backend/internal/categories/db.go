@@ -15,6 +15,9 @@ type categoriesDB struct {
 type DB interface {
 	GetAll(ctx context.Context) ([]Category, error)
 	Insert(ctx context.Context, domain string, categories []string) error
+	GetDomainCategories(ctx context.Context) ([]DomainCategory, error)
+	GetPolicies(ctx context.Context) ([]Policy, error)
+	SetPolicy(ctx context.Context, category string, blocked bool, scheduleID *int64) error
 }
 
 func New(db *db.DB) DB {
@@ -57,3 +60,51 @@ func (b *categoriesDB) GetAll(ctx context.Context) ([]Category, error) {
 
 	return categories, nil
 }
+
+func (b *categoriesDB) GetDomainCategories(ctx context.Context) ([]DomainCategory, error) {
+	rows, err := b.db.Query(ctx, `
+		SELECT domain, category
+		FROM domain_categories
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	domainCategories, err := pgx.CollectRows(rows, pgx.RowToStructByName[DomainCategory])
+	if err != nil {
+		return nil, err
+	}
+
+	return domainCategories, nil
+}
+
+func (b *categoriesDB) GetPolicies(ctx context.Context) ([]Policy, error) {
+	rows, err := b.db.Query(ctx, `
+		SELECT id, category, blocked, schedule_id, created_at, updated_at
+		FROM category_policies
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := pgx.CollectRows(rows, pgx.RowToStructByName[Policy])
+	if err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func (b *categoriesDB) SetPolicy(ctx context.Context, category string, blocked bool, scheduleID *int64) error {
+	_, err := b.db.Exec(ctx, `
+		INSERT INTO category_policies (category, blocked, schedule_id)
+			VALUES ($1, $2, $3)
+		ON CONFLICT (category) DO UPDATE
+			SET blocked = EXCLUDED.blocked, schedule_id = EXCLUDED.schedule_id, updated_at = CURRENT_TIMESTAMP
+	`, category, blocked, scheduleID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package categories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/domains"
+	"github.com/orion-tec/oriondns/internal/testutil"
+)
+
+func TestCategoriesDB_GetDomainCategories(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	categoriesDB := New(database)
+	domainsDB := domains.New(database)
+
+	ctx := context.Background()
+
+	require.NoError(t, domainsDB.Insert(ctx, "casino.example.com"))
+	require.NoError(t, categoriesDB.Insert(ctx, "casino.example.com", []string{"gambling", "games"}))
+
+	results, err := categoriesDB.GetDomainCategories(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []DomainCategory{
+		{Domain: "casino.example.com", Category: "gambling"},
+		{Domain: "casino.example.com", Category: "games"},
+	}, results)
+}
+
+func TestCategoriesDB_SetPolicy(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	categoriesDB := New(database)
+
+	ctx := context.Background()
+
+	var scheduleID int64
+	err := pool.QueryRow(ctx, `INSERT INTO schedules (name) VALUES ('evenings') RETURNING id`).Scan(&scheduleID)
+	require.NoError(t, err)
+
+	require.NoError(t, categoriesDB.SetPolicy(ctx, "gambling", true, nil))
+	require.NoError(t, categoriesDB.SetPolicy(ctx, "adult", true, nil))
+	require.NoError(t, categoriesDB.SetPolicy(ctx, "adult", false, nil))
+	require.NoError(t, categoriesDB.SetPolicy(ctx, "games", true, &scheduleID))
+
+	policies, err := categoriesDB.GetPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	blocked := make(map[string]bool)
+	for _, p := range policies {
+		blocked[p.Category] = p.Blocked
+		if p.Category == "games" {
+			require.NotNil(t, p.ScheduleID)
+			assert.Equal(t, scheduleID, *p.ScheduleID)
+		} else {
+			assert.Nil(t, p.ScheduleID)
+		}
+	}
+
+	assert.True(t, blocked["gambling"])
+	assert.False(t, blocked["adult"])
+	assert.True(t, blocked["games"])
+}
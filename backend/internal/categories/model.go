@@ -1,5 +1,25 @@
 package categories
 
+import "time"
+
 type Category struct {
 	Category string
 }
+
+// DomainCategory is a category the syncer assigned to a domain.
+type DomainCategory struct {
+	Domain   string
+	Category string
+}
+
+// Policy sets whether the domains of a category are blocked.
+type Policy struct {
+	ID       int64
+	Category string
+	Blocked  bool
+	// ScheduleID limits the block to the times its schedule is active, nil
+	// for blocks that always apply.
+	ScheduleID *int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,185 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/orion-tec/oriondns/db"
+)
+
+var (
+	ErrNotFound  = fmt.Errorf("not found")
+	ErrNameTaken = fmt.Errorf("name already in use")
+)
+
+type clientsDB struct {
+	db *db.DB
+}
+
+type DB interface {
+	InsertGroup(ctx context.Context, group Group) (int64, error)
+	GetGroups(ctx context.Context) ([]Group, error)
+	UpdateGroup(ctx context.Context, group Group) error
+	DeleteGroup(ctx context.Context, id int64) error
+	InsertClient(ctx context.Context, client Client) (int64, error)
+	GetClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, id int64) error
+}
+
+func New(db *db.DB) DB {
+	return &clientsDB{db}
+}
+
+func (c *clientsDB) InsertGroup(ctx context.Context, group Group) (int64, error) {
+	if group.Upstreams == nil {
+		group.Upstreams = []string{}
+	}
+	if group.BlockedCategories == nil {
+		group.BlockedCategories = []string{}
+	}
+
+	var id int64
+	err := c.db.QueryRow(ctx, `
+		INSERT INTO client_groups (name, upstreams, blocked_categories, schedule_id, safe_search)
+			VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, group.Name, group.Upstreams, group.BlockedCategories, group.ScheduleID, group.SafeSearch).Scan(&id)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return id, nil
+}
+
+func (c *clientsDB) GetGroups(ctx context.Context) ([]Group, error) {
+	rows, err := c.db.Query(ctx, `
+		SELECT id, name, upstreams, blocked_categories, schedule_id, safe_search, created_at, updated_at, deleted_at
+		FROM client_groups
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := pgx.CollectRows(rows, pgx.RowToStructByName[Group])
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (c *clientsDB) UpdateGroup(ctx context.Context, group Group) error {
+	if group.Upstreams == nil {
+		group.Upstreams = []string{}
+	}
+	if group.BlockedCategories == nil {
+		group.BlockedCategories = []string{}
+	}
+
+	tag, err := c.db.Exec(ctx, `
+		UPDATE client_groups
+		SET name = $2, upstreams = $3, blocked_categories = $4, schedule_id = $5, safe_search = $6,
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, group.ID, group.Name, group.Upstreams, group.BlockedCategories, group.ScheduleID, group.SafeSearch)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteGroup deletes the group along with its clients and the rules
+// scoped to it.
+func (c *clientsDB) DeleteGroup(ctx context.Context, id int64) error {
+	tag, err := c.db.Exec(ctx, `
+		DELETE FROM client_groups
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *clientsDB) InsertClient(ctx context.Context, client Client) (int64, error) {
+	var id int64
+	err := c.db.QueryRow(ctx, `
+		INSERT INTO clients (group_id, name, kind, value)
+			VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, client.GroupID, client.Name, client.Kind, client.Value).Scan(&id)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return id, nil
+}
+
+func (c *clientsDB) GetClients(ctx context.Context) ([]Client, error) {
+	rows, err := c.db.Query(ctx, `
+		SELECT c.id, c.group_id, c.name, c.kind, c.value, c.created_at, c.updated_at, c.deleted_at
+		FROM clients c
+			JOIN client_groups g ON g.id = c.group_id
+		WHERE c.deleted_at IS NULL AND g.deleted_at IS NULL
+		ORDER BY c.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := pgx.CollectRows(rows, pgx.RowToStructByName[Client])
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (c *clientsDB) DeleteClient(ctx context.Context, id int64) error {
+	tag, err := c.db.Exec(ctx, `
+		DELETE FROM clients
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// mapError maps unique violations on the group name to ErrNameTaken and
+// foreign key violations, on the group of a client or the schedule of a
+// group, to ErrNotFound.
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return ErrNameTaken
+		case "23503":
+			return ErrNotFound
+		}
+	}
+
+	return err
+}
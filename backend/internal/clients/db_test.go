@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/testutil"
+)
+
+func TestClient_Validate(t *testing.T) {
+	tests := []struct {
+		client Client
+		valid  bool
+	}{
+		{Client{Kind: KindIP, Value: "192.168.0.10"}, true},
+		{Client{Kind: KindIP, Value: "2001:db8::1"}, true},
+		{Client{Kind: KindIP, Value: "192.168.0.0/24"}, false},
+		{Client{Kind: KindCIDR, Value: "192.168.0.0/24"}, true},
+		{Client{Kind: KindCIDR, Value: "192.168.0.10"}, false},
+		{Client{Kind: KindClientID, Value: "kids-tablet"}, true},
+		{Client{Kind: KindClientID, Value: "kids tablet"}, false},
+		{Client{Kind: "mac", Value: "00:11:22:33:44:55"}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.client.Validate()
+		if tt.valid {
+			assert.NoError(t, err, tt.client.Value)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidClient, tt.client.Value)
+		}
+	}
+}
+
+func TestClientsDB_Groups(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	clientsDB := New(database)
+
+	ctx := context.Background()
+
+	id, err := clientsDB.InsertGroup(ctx, Group{Name: "kids", BlockedCategories: []string{"games"}})
+	require.NoError(t, err)
+
+	_, err = clientsDB.InsertGroup(ctx, Group{Name: "kids"})
+	assert.ErrorIs(t, err, ErrNameTaken)
+
+	safeSearch := true
+	err = clientsDB.UpdateGroup(ctx, Group{
+		ID:         id,
+		Name:       "children",
+		Upstreams:  []string{"9.9.9.9:53"},
+		SafeSearch: &safeSearch,
+	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, clientsDB.UpdateGroup(ctx, Group{ID: id + 1, Name: "other"}), ErrNotFound)
+
+	missingSchedule := int64(1000)
+	err = clientsDB.UpdateGroup(ctx, Group{ID: id, Name: "children", ScheduleID: &missingSchedule})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	groups, err := clientsDB.GetGroups(ctx)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "children", groups[0].Name)
+	assert.Equal(t, []string{"9.9.9.9:53"}, groups[0].Upstreams)
+	assert.Empty(t, groups[0].BlockedCategories)
+	require.NotNil(t, groups[0].SafeSearch)
+	assert.True(t, *groups[0].SafeSearch)
+
+	require.NoError(t, clientsDB.DeleteGroup(ctx, id))
+	assert.ErrorIs(t, clientsDB.DeleteGroup(ctx, id), ErrNotFound)
+}
+
+func TestClientsDB_Clients(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	clientsDB := New(database)
+
+	ctx := context.Background()
+
+	groupID, err := clientsDB.InsertGroup(ctx, Group{Name: "kids"})
+	require.NoError(t, err)
+
+	_, err = clientsDB.InsertClient(ctx, Client{GroupID: groupID, Name: "tablet", Kind: KindIP, Value: "192.168.0.10"})
+	require.NoError(t, err)
+
+	_, err = clientsDB.InsertClient(ctx, Client{GroupID: groupID + 1, Kind: KindIP, Value: "192.168.0.11"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	cs, err := clientsDB.GetClients(ctx)
+	require.NoError(t, err)
+	require.Len(t, cs, 1)
+	assert.Equal(t, "tablet", cs[0].Name)
+
+	// Deleting the group deletes its clients.
+	require.NoError(t, clientsDB.DeleteGroup(ctx, groupID))
+	cs, err = clientsDB.GetClients(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, cs)
+}
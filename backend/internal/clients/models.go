@@ -0,0 +1,77 @@
+package clients
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// Kinds of client identifiers. Client IDs come from the DoH path or from
+// an EDNS0 option set by the client.
+const (
+	KindIP       = "ip"
+	KindCIDR     = "cidr"
+	KindClientID = "client_id"
+)
+
+var (
+	ErrInvalidClient = fmt.Errorf("invalid client")
+
+	clientIDRegexp = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+)
+
+// Group holds the settings shared by its clients. Blocked and allowed
+// domains can also be scoped to a group.
+type Group struct {
+	ID   int64
+	Name string
+	// Upstreams replace the server upstreams for the group when set.
+	Upstreams []string
+	// BlockedCategories are blocked for the group on top of the global
+	// category policies.
+	BlockedCategories []string
+	// ScheduleID limits BlockedCategories to the times its schedule is
+	// active, nil when they always apply.
+	ScheduleID *int64
+	// SafeSearch overrides whether safe search is enforced for the group,
+	// nil to follow the server setting.
+	SafeSearch *bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  *time.Time
+}
+
+// Client identifies the devices of a group by source IP, CIDR or client ID.
+type Client struct {
+	ID        int64
+	GroupID   int64
+	Name      string
+	Kind      string
+	Value     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// Validate checks that Value is well formed for Kind.
+func (c Client) Validate() error {
+	var ok bool
+	switch c.Kind {
+	case KindIP:
+		ok = net.ParseIP(c.Value) != nil
+	case KindCIDR:
+		_, _, err := net.ParseCIDR(c.Value)
+		ok = err == nil
+	case KindClientID:
+		ok = clientIDRegexp.MatchString(c.Value)
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidClient, c.Kind)
+	}
+
+	if !ok {
+		return fmt.Errorf("%w: bad %s %q", ErrInvalidClient, c.Kind, c.Value)
+	}
+
+	return nil
+}
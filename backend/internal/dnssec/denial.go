@@ -0,0 +1,184 @@
+package dnssec
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// provesInsecureDelegation reports whether ns proves that name is a
+// delegation without DS records, either directly or through NSEC3 opt-out.
+func provesInsecureDelegation(name string, ns []dns.RR) bool {
+	for _, rr := range ns {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			if strings.EqualFold(rr.Hdr.Name, name) {
+				return isUnsignedCut(rr.TypeBitMap)
+			}
+		case *dns.NSEC3:
+			if rr.Match(name) {
+				return isUnsignedCut(rr.TypeBitMap)
+			}
+		}
+	}
+
+	return optOutCovers(name, ns)
+}
+
+func isUnsignedCut(types []uint16) bool {
+	return hasType(types, dns.TypeNS) && !hasType(types, dns.TypeDS) && !hasType(types, dns.TypeSOA)
+}
+
+// provesNODATA reports whether ns proves that name exists without records of
+// qtype.
+func provesNODATA(name string, qtype uint16, ns []dns.RR) bool {
+	for _, rr := range ns {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			if strings.EqualFold(rr.Hdr.Name, name) {
+				return !hasType(rr.TypeBitMap, qtype) && !hasType(rr.TypeBitMap, dns.TypeCNAME)
+			}
+		case *dns.NSEC3:
+			if rr.Match(name) {
+				return !hasType(rr.TypeBitMap, qtype) && !hasType(rr.TypeBitMap, dns.TypeCNAME)
+			}
+		}
+	}
+
+	// DS queries for unsigned delegations may fall in an opt-out span.
+	return qtype == dns.TypeDS && optOutCovers(name, ns)
+}
+
+// provesNXDOMAIN reports whether ns proves that name does not exist: an NSEC
+// covering it, or an NSEC3 closest encloser proof (RFC 5155, section 7.2.1).
+func provesNXDOMAIN(name string, ns []dns.RR) bool {
+	for _, rr := range ns {
+		if nsec, ok := rr.(*dns.NSEC); ok && nsecCovers(nsec, name) {
+			return true
+		}
+	}
+
+	_, ok := closestEncloser(name, ns)
+	return ok
+}
+
+// provesWildcard reports whether ns proves that name, answered from a
+// wildcard with the given label count, does not exist itself.
+func provesWildcard(name string, labels uint8, ns []dns.RR) bool {
+	for _, rr := range ns {
+		if nsec, ok := rr.(*dns.NSEC); ok && nsecCovers(nsec, name) {
+			return true
+		}
+	}
+
+	return nsec3Covers(nextCloser(name, int(labels)), ns)
+}
+
+// closestEncloser finds the deepest ancestor of name matched by an NSEC3
+// whose next closer name is covered by another NSEC3.
+func closestEncloser(name string, ns []dns.RR) (string, bool) {
+	labels := dns.CountLabel(name)
+	for i := labels - 1; i >= 0; i-- {
+		ce := ancestor(name, i)
+		if !nsec3Matches(ce, ns) {
+			continue
+		}
+
+		return ce, nsec3Covers(nextCloser(name, i), ns)
+	}
+
+	return "", false
+}
+
+// optOutCovers reports whether name falls into an NSEC3 opt-out span below
+// a proven closest encloser.
+func optOutCovers(name string, ns []dns.RR) bool {
+	labels := dns.CountLabel(name)
+	for i := labels - 1; i >= 0; i-- {
+		if !nsec3Matches(ancestor(name, i), ns) {
+			continue
+		}
+
+		next := nextCloser(name, i)
+		for _, rr := range ns {
+			if nsec3, ok := rr.(*dns.NSEC3); ok && nsec3.Flags&1 == 1 && nsec3.Cover(next) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+func nsec3Matches(name string, ns []dns.RR) bool {
+	for _, rr := range ns {
+		if nsec3, ok := rr.(*dns.NSEC3); ok && nsec3.Match(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nsec3Covers(name string, ns []dns.RR) bool {
+	for _, rr := range ns {
+		if nsec3, ok := rr.(*dns.NSEC3); ok && nsec3.Cover(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ancestor returns the last n labels of name.
+func ancestor(name string, n int) string {
+	if n == 0 {
+		return "."
+	}
+
+	idx := dns.Split(name)
+	return name[idx[len(idx)-n]:]
+}
+
+// nextCloser returns the ancestor of name one label longer than the closest
+// encloser with n labels.
+func nextCloser(name string, n int) string {
+	return ancestor(name, min(n+1, dns.CountLabel(name)))
+}
+
+// nsecCovers reports whether name sorts strictly between the owner and the
+// next name of nsec, the last NSEC of a zone wrapping around to the apex.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if canonicalCompare(owner, next) < 0 {
+		return canonicalCompare(owner, name) < 0 && canonicalCompare(name, next) < 0
+	}
+
+	return canonicalCompare(owner, name) < 0 || canonicalCompare(name, next) < 0
+}
+
+// canonicalCompare orders names as defined in RFC 4034, section 6.1: label
+// by label from the right, case insensitively.
+func canonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := strings.Compare(la[len(la)-i], lb[len(lb)-i]); c != 0 {
+			return c
+		}
+	}
+
+	return len(la) - len(lb)
+}
+
+func hasType(types []uint16, t uint16) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+
+	return false
+}
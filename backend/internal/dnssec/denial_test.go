@@ -0,0 +1,84 @@
+package dnssec
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// nsec3 returns an NSEC3 record for name in zone spanning to the hash of next.
+func nsec3(name, zone, next string, optOut bool, types ...uint16) *dns.NSEC3 {
+	owner := dns.HashName(name, dns.SHA1, 0, "") + "." + zone
+	rr := &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET},
+		Hash:       dns.SHA1,
+		NextDomain: dns.HashName(next, dns.SHA1, 0, ""),
+		TypeBitMap: types,
+	}
+	if optOut {
+		rr.Flags = 1
+	}
+	return rr
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	ordered := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.",
+		"z.example.", "*.z.example."}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		assert.Negative(t, canonicalCompare(ordered[i], ordered[i+1]), "%s < %s", ordered[i], ordered[i+1])
+		assert.Positive(t, canonicalCompare(ordered[i+1], ordered[i]))
+	}
+	assert.Zero(t, canonicalCompare("Example.COM.", "example.com."))
+}
+
+func TestNSECCovers(t *testing.T) {
+	nsec := mustRR("b.example.com. 300 IN NSEC d.example.com. A").(*dns.NSEC)
+	assert.True(t, nsecCovers(nsec, "c.example.com."))
+	assert.True(t, nsecCovers(nsec, "x.b.example.com."))
+	assert.False(t, nsecCovers(nsec, "b.example.com."))
+	assert.False(t, nsecCovers(nsec, "e.example.com."))
+
+	last := mustRR("y.example.com. 300 IN NSEC example.com. A").(*dns.NSEC)
+	assert.True(t, nsecCovers(last, "z.example.com."))
+	assert.False(t, nsecCovers(last, "a.example.com."))
+}
+
+func TestProvesNXDOMAIN_NSEC3(t *testing.T) {
+	// A single NSEC3 matching the apex and spanning the whole hash ring.
+	apex := nsec3("example.com.", "example.com.", "example.com.", false, dns.TypeSOA, dns.TypeNS)
+	assert.True(t, provesNXDOMAIN("missing.example.com.", []dns.RR{apex}))
+
+	// Without a record matching the closest encloser there is no proof.
+	other := nsec3("www.example.com.", "example.com.", "www.example.com.", false, dns.TypeA)
+	assert.False(t, provesNXDOMAIN("missing.example.com.", []dns.RR{other}))
+}
+
+func TestProvesNODATA(t *testing.T) {
+	nsec := mustRR("www.example.com. 300 IN NSEC z.example.com. A RRSIG NSEC")
+	assert.True(t, provesNODATA("www.example.com.", dns.TypeAAAA, []dns.RR{nsec}))
+	assert.False(t, provesNODATA("www.example.com.", dns.TypeA, []dns.RR{nsec}))
+
+	withCNAME := mustRR("alias.example.com. 300 IN NSEC z.example.com. CNAME RRSIG NSEC")
+	assert.False(t, provesNODATA("alias.example.com.", dns.TypeAAAA, []dns.RR{withCNAME}))
+
+	match := nsec3("www.example.com.", "example.com.", "www.example.com.", false, dns.TypeA)
+	assert.True(t, provesNODATA("www.example.com.", dns.TypeAAAA, []dns.RR{match}))
+}
+
+func TestProvesInsecureDelegation(t *testing.T) {
+	cut := mustRR("child.example.com. 300 IN NSEC d.example.com. NS RRSIG NSEC")
+	assert.True(t, provesInsecureDelegation("child.example.com.", []dns.RR{cut}))
+
+	signedCut := mustRR("child.example.com. 300 IN NSEC d.example.com. NS DS RRSIG NSEC")
+	assert.False(t, provesInsecureDelegation("child.example.com.", []dns.RR{signedCut}))
+
+	notCut := mustRR("child.example.com. 300 IN NSEC d.example.com. A RRSIG NSEC")
+	assert.False(t, provesInsecureDelegation("child.example.com.", []dns.RR{notCut}))
+
+	apex := nsec3("example.com.", "example.com.", "example.com.", false, dns.TypeSOA, dns.TypeNS)
+	optOut := nsec3("example.com.", "example.com.", "example.com.", true, dns.TypeSOA, dns.TypeNS)
+	assert.False(t, provesInsecureDelegation("child.example.com.", []dns.RR{apex}))
+	assert.True(t, provesInsecureDelegation("child.example.com.", []dns.RR{optOut}))
+}
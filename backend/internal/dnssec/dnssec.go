@@ -0,0 +1,231 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+const (
+	// maxKeyTTL caps how long validated keys and insecure proofs are reused.
+	maxKeyTTL = time.Hour
+	// bogusKeyTTL keeps a broken zone from being refetched on every query.
+	bogusKeyTTL = time.Minute
+)
+
+var ErrInvalidTrustAnchor = fmt.Errorf("trust anchor must be a DS or DNSKEY record")
+
+// DefaultTrustAnchors are the DS records of the root KSK-2017 and KSK-2024.
+var DefaultTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+type Options struct {
+	// TrustAnchors are DS or DNSKEY records in presentation format.
+	// DefaultTrustAnchors is used when empty.
+	TrustAnchors []string
+}
+
+// validator checks answers from the wrapped pool against the chain of trust
+// starting at the trust anchors.
+type validator struct {
+	pool    upstream.Pool
+	anchors map[string][]dns.RR
+
+	mu   sync.Mutex
+	keys map[string]zoneKeys
+	now  func() time.Time
+}
+
+type zoneKeys struct {
+	keys      []*dns.DNSKEY
+	err       error
+	expiresAt time.Time
+}
+
+// New wraps pool so every answer is validated. Validated answers get the AD
+// bit, bogus ones are replaced by SERVFAIL with an Extended DNS Error.
+func New(pool upstream.Pool, opts Options) (upstream.Pool, error) {
+	if len(opts.TrustAnchors) == 0 {
+		opts.TrustAnchors = DefaultTrustAnchors
+	}
+
+	anchors := make(map[string][]dns.RR)
+	for _, ta := range opts.TrustAnchors {
+		rr, err := dns.NewRR(ta)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTrustAnchor, err)
+		}
+
+		switch rr.(type) {
+		case *dns.DS, *dns.DNSKEY:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTrustAnchor, ta)
+		}
+
+		zone := strings.ToLower(rr.Header().Name)
+		anchors[zone] = append(anchors[zone], rr)
+	}
+
+	return &validator{
+		pool:    pool,
+		anchors: anchors,
+		keys:    make(map[string]zoneKeys),
+		now:     time.Now,
+	}, nil
+}
+
+func (v *validator) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	// Clients setting CD validate themselves and want the raw data.
+	if req.CheckingDisabled || len(req.Question) != 1 {
+		return v.pool.Exchange(ctx, req)
+	}
+
+	clientOpt := req.IsEdns0()
+	clientDO := clientOpt != nil && clientOpt.Do()
+
+	q := req.Copy()
+	q.CheckingDisabled = true
+	if opt := q.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		q.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	resp, err := v.pool.Exchange(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return resp, nil
+	}
+
+	err = v.validate(ctx, req.Question[0], resp)
+	var bogus *bogusError
+	switch {
+	case err == nil:
+		resp.AuthenticatedData = clientDO || req.AuthenticatedData
+	case errors.Is(err, errInsecure):
+		resp.AuthenticatedData = false
+	case errors.As(err, &bogus):
+		log.Printf("DNSSEC validation failed for %s: %s\n", req.Question[0].Name, bogus.Error())
+		return bogusResponse(req, bogus), nil
+	default:
+		return nil, err
+	}
+
+	resp.CheckingDisabled = false
+	if !clientDO {
+		stripDNSSEC(resp, req.Question[0].Qtype, clientOpt != nil)
+	}
+
+	return resp, nil
+}
+
+func (v *validator) Stats() []upstream.Stats {
+	return v.pool.Stats()
+}
+
+func (v *validator) Start() {
+	v.pool.Start()
+}
+
+func (v *validator) Stop() {
+	v.pool.Stop()
+}
+
+// bogusResponse is the SERVFAIL sent in place of an answer that failed
+// validation, carrying the reason as an RFC 8914 Extended DNS Error.
+func bogusResponse(req *dns.Msg, bogus *bogusError) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+	m.RecursionAvailable = true
+
+	// OPT records are only sent to clients that used EDNS themselves.
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+		respOpt := m.IsEdns0()
+		respOpt.Option = append(respOpt.Option, &dns.EDNS0_EDE{InfoCode: bogus.code, ExtraText: bogus.reason})
+	}
+
+	return m
+}
+
+// stripDNSSEC removes the records that were only added because the validator
+// asked for them with the DO bit.
+func stripDNSSEC(msg *dns.Msg, qtype uint16, edns bool) {
+	keep := func(rrs []dns.RR) []dns.RR {
+		res := rrs[:0]
+		for _, rr := range rrs {
+			switch rr.Header().Rrtype {
+			case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+				if rr.Header().Rrtype != qtype {
+					continue
+				}
+			}
+			res = append(res, rr)
+		}
+		return res
+	}
+
+	msg.Answer = keep(msg.Answer)
+	msg.Ns = keep(msg.Ns)
+
+	extra := msg.Extra[:0]
+	for _, rr := range msg.Extra {
+		if opt, ok := rr.(*dns.OPT); ok {
+			if !edns {
+				continue
+			}
+			opt.SetDo(false)
+		}
+		if rr.Header().Rrtype == dns.TypeRRSIG {
+			continue
+		}
+		extra = append(extra, rr)
+	}
+	msg.Extra = extra
+}
+
+// query fetches the records the chain of trust is built from.
+func (v *validator) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.CheckingDisabled = true
+	m.SetEdns0(dns.DefaultMsgSize, true)
+
+	resp, err := v.pool.Exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("%s %s answered %s", name, dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode])
+	}
+
+	return resp, nil
+}
+
+// anchorFor returns the deepest trust anchor zone enclosing name, or an empty
+// string when no anchor covers it.
+func (v *validator) anchorFor(name string) string {
+	name = strings.ToLower(dns.Fqdn(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if _, ok := v.anchors[name[off:]]; ok {
+			return name[off:]
+		}
+	}
+	if _, ok := v.anchors["."]; ok {
+		return "."
+	}
+
+	return ""
+}
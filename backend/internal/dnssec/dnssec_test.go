@@ -0,0 +1,378 @@
+package dnssec
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+func mustRR(record string) dns.RR {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+// zoneSigner holds the single key a test zone is signed with.
+type zoneSigner struct {
+	zone string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newZoneSigner(t *testing.T, zone string) *zoneSigner {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+
+	return &zoneSigner{zone: zone, key: key, priv: priv.(crypto.Signer)}
+}
+
+func (s *zoneSigner) ds() *dns.DS {
+	return s.key.ToDS(dns.SHA256)
+}
+
+// sign returns rrset followed by its signature, valid for an hour either way.
+func (s *zoneSigner) sign(t *testing.T, rrset ...dns.RR) []dns.RR {
+	now := time.Now()
+	return s.signValid(t, now.Add(-time.Hour), now.Add(time.Hour), rrset...)
+}
+
+func (s *zoneSigner) signValid(t *testing.T, inception, expiration time.Time, rrset ...dns.RR) []dns.RR {
+	hdr := rrset[0].Header()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: hdr.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: hdr.Ttl},
+		KeyTag:     s.key.KeyTag(),
+		SignerName: s.zone,
+		Algorithm:  s.key.Algorithm,
+		Inception:  uint32(inception.Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	require.NoError(t, sig.Sign(s.priv, rrset))
+
+	return append(append([]dns.RR{}, rrset...), sig)
+}
+
+// testPool answers from canned responses keyed by name and type.
+type testPool struct {
+	mu        sync.Mutex
+	responses map[string]*dns.Msg
+	queries   map[string]int
+}
+
+func newTestPool() *testPool {
+	return &testPool{responses: make(map[string]*dns.Msg), queries: make(map[string]int)}
+}
+
+func poolKey(name string, qtype uint16) string {
+	return strings.ToLower(name) + "/" + dns.TypeToString[qtype]
+}
+
+func (p *testPool) answer(name string, qtype uint16, answer ...[]dns.RR) {
+	m := new(dns.Msg)
+	for _, rrs := range answer {
+		m.Answer = append(m.Answer, rrs...)
+	}
+	p.responses[poolKey(name, qtype)] = m
+}
+
+func (p *testPool) negative(name string, qtype uint16, rcode int, ns ...[]dns.RR) {
+	m := new(dns.Msg)
+	m.Rcode = rcode
+	for _, rrs := range ns {
+		m.Ns = append(m.Ns, rrs...)
+	}
+	p.responses[poolKey(name, qtype)] = m
+}
+
+func (p *testPool) Exchange(_ context.Context, req *dns.Msg) (*dns.Msg, error) {
+	q := req.Question[0]
+	key := poolKey(q.Name, q.Qtype)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queries[key]++
+
+	canned, ok := p.responses[key]
+	if !ok {
+		return nil, fmt.Errorf("unexpected query %s", key)
+	}
+
+	resp := canned.Copy()
+	resp.Id = req.Id
+	resp.Response = true
+	resp.Question = req.Question
+	resp.CheckingDisabled = req.CheckingDisabled
+	if opt := req.IsEdns0(); opt != nil {
+		resp.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+	return resp, nil
+}
+
+func (p *testPool) queryCount(name string, qtype uint16) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queries[poolKey(name, qtype)]
+}
+
+func (p *testPool) Stats() []upstream.Stats { return nil }
+func (p *testPool) Start()                  {}
+func (p *testPool) Stop()                   {}
+
+func soa(zone string) dns.RR {
+	return mustRR(zone + " 300 IN SOA ns1." + zone + " admin." + zone + " 1 7200 3600 1209600 300")
+}
+
+// newTestZones builds example.com., anchored by its DS, with a signed child
+// sub.example.com. and an unsigned child unsigned.example.com.
+func newTestZones(t *testing.T) (*testPool, *zoneSigner) {
+	p := newTestPool()
+	example := newZoneSigner(t, "example.com.")
+	sub := newZoneSigner(t, "sub.example.com.")
+
+	p.answer("example.com.", dns.TypeDNSKEY, example.sign(t, example.key))
+	p.answer("www.example.com.", dns.TypeA, example.sign(t, mustRR("www.example.com. 300 IN A 10.0.0.1")))
+	p.answer("alias.example.com.", dns.TypeA,
+		example.sign(t, mustRR("alias.example.com. 300 IN CNAME www.sub.example.com.")),
+		sub.sign(t, mustRR("www.sub.example.com. 300 IN A 10.0.0.2")))
+
+	// Record changed after signing.
+	tampered := example.sign(t, mustRR("bad.example.com. 300 IN A 10.0.0.1"))
+	tampered[0] = mustRR("bad.example.com. 300 IN A 10.6.6.6")
+	p.answer("bad.example.com.", dns.TypeA, tampered)
+
+	now := time.Now()
+	p.answer("expired.example.com.", dns.TypeA,
+		example.signValid(t, now.Add(-48*time.Hour), now.Add(-24*time.Hour),
+			mustRR("expired.example.com. 300 IN A 10.0.0.1")))
+
+	// Signatures stripped from an answer inside the signed zone.
+	p.answer("nosig.example.com.", dns.TypeA, []dns.RR{mustRR("nosig.example.com. 300 IN A 10.0.0.1")})
+	p.negative("nosig.example.com.", dns.TypeDS, dns.RcodeSuccess,
+		example.sign(t, soa("example.com.")),
+		example.sign(t, mustRR("nosig.example.com. 300 IN NSEC sub.example.com. A RRSIG NSEC")))
+
+	p.negative("missing.example.com.", dns.TypeA, dns.RcodeNameError,
+		example.sign(t, soa("example.com.")),
+		example.sign(t, mustRR("mail.example.com. 300 IN NSEC nosig.example.com. A RRSIG NSEC")))
+	p.negative("gone.example.com.", dns.TypeA, dns.RcodeNameError, example.sign(t, soa("example.com.")))
+	p.negative("www.example.com.", dns.TypeAAAA, dns.RcodeSuccess,
+		example.sign(t, soa("example.com.")),
+		example.sign(t, mustRR("www.example.com. 300 IN NSEC example.com. A RRSIG NSEC")))
+
+	p.answer("sub.example.com.", dns.TypeDS, example.sign(t, sub.ds()))
+	p.answer("sub.example.com.", dns.TypeDNSKEY, sub.sign(t, sub.key))
+	p.answer("www.sub.example.com.", dns.TypeA, sub.sign(t, mustRR("www.sub.example.com. 300 IN A 10.0.0.2")))
+
+	p.negative("unsigned.example.com.", dns.TypeDS, dns.RcodeSuccess,
+		example.sign(t, soa("example.com.")),
+		example.sign(t, mustRR("unsigned.example.com. 300 IN NSEC www.example.com. NS RRSIG NSEC")))
+	p.answer("www.unsigned.example.com.", dns.TypeA, []dns.RR{mustRR("www.unsigned.example.com. 300 IN A 10.0.0.3")})
+	p.negative("www.unsigned.example.com.", dns.TypeDS, dns.RcodeSuccess, []dns.RR{soa("unsigned.example.com.")})
+
+	p.answer("www.example.org.", dns.TypeA, []dns.RR{mustRR("www.example.org. 300 IN A 10.0.0.4")})
+
+	return p, example
+}
+
+func newTestValidator(t *testing.T) (*validator, *testPool) {
+	p, example := newTestZones(t)
+
+	v, err := New(p, Options{TrustAnchors: []string{example.ds().String()}})
+	require.NoError(t, err)
+
+	return v.(*validator), p
+}
+
+func request(name string, qtype uint16, do bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(1232, do)
+	return m
+}
+
+func extendedError(t *testing.T, resp *dns.Msg) *dns.EDNS0_EDE {
+	t.Helper()
+	require.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+
+	opt := resp.IsEdns0()
+	require.NotNil(t, opt)
+	for _, o := range opt.Option {
+		if ede, ok := o.(*dns.EDNS0_EDE); ok {
+			return ede
+		}
+	}
+	require.Fail(t, "no extended dns error")
+	return nil
+}
+
+func TestValidator_SecureAnswer(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	resp, err := v.Exchange(context.Background(), request("www.example.com.", dns.TypeA, true))
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.True(t, resp.AuthenticatedData)
+	assert.Len(t, resp.Answer, 2, "signatures are kept for DO clients")
+}
+
+func TestValidator_SecureAnswer_StripsSignaturesWithoutDO(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	req := request("www.example.com.", dns.TypeA, false)
+	req.AuthenticatedData = true
+
+	resp, err := v.Exchange(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, resp.AuthenticatedData)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, dns.TypeA, resp.Answer[0].Header().Rrtype)
+	assert.False(t, resp.IsEdns0().Do())
+}
+
+func TestValidator_ChainOfTrustThroughChild(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	resp, err := v.Exchange(context.Background(), request("www.sub.example.com.", dns.TypeA, true))
+	require.NoError(t, err)
+	assert.True(t, resp.AuthenticatedData)
+
+	resp, err = v.Exchange(context.Background(), request("alias.example.com.", dns.TypeA, true))
+	require.NoError(t, err)
+	assert.True(t, resp.AuthenticatedData)
+}
+
+func TestValidator_InsecureAnswers(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	for _, name := range []string{"www.unsigned.example.com.", "www.example.org."} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := v.Exchange(context.Background(), request(name, dns.TypeA, true))
+			require.NoError(t, err)
+			assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+			assert.False(t, resp.AuthenticatedData)
+			assert.Len(t, resp.Answer, 1)
+		})
+	}
+}
+
+func TestValidator_NegativeAnswers(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	resp, err := v.Exchange(context.Background(), request("missing.example.com.", dns.TypeA, true))
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	assert.True(t, resp.AuthenticatedData)
+
+	resp, err = v.Exchange(context.Background(), request("www.example.com.", dns.TypeAAAA, true))
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	assert.True(t, resp.AuthenticatedData)
+}
+
+func TestValidator_BogusAnswers(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	testCases := []struct {
+		name string
+		code uint16
+	}{
+		{"bad.example.com.", dns.ExtendedErrorCodeDNSBogus},
+		{"expired.example.com.", dns.ExtendedErrorCodeSignatureExpired},
+		{"nosig.example.com.", dns.ExtendedErrorCodeRRSIGsMissing},
+		{"gone.example.com.", dns.ExtendedErrorCodeNSECMissing},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := request(tc.name, dns.TypeA, true)
+			resp, err := v.Exchange(context.Background(), req)
+			require.NoError(t, err)
+
+			assert.Equal(t, req.Id, resp.Id)
+			assert.Empty(t, resp.Answer)
+			assert.Equal(t, tc.code, extendedError(t, resp).InfoCode)
+		})
+	}
+}
+
+func TestValidator_BogusWithoutEDNS(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	req := new(dns.Msg)
+	req.SetQuestion("bad.example.com.", dns.TypeA)
+
+	resp, err := v.Exchange(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	assert.Nil(t, resp.IsEdns0())
+}
+
+func TestValidator_CheckingDisabledPassesThrough(t *testing.T) {
+	v, _ := newTestValidator(t)
+
+	req := request("bad.example.com.", dns.TypeA, true)
+	req.CheckingDisabled = true
+
+	resp, err := v.Exchange(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.False(t, resp.AuthenticatedData)
+	assert.Len(t, resp.Answer, 2)
+}
+
+func TestValidator_UntrustedKey(t *testing.T) {
+	p, _ := newTestZones(t)
+	other := newZoneSigner(t, "example.com.")
+
+	v, err := New(p, Options{TrustAnchors: []string{other.ds().String()}})
+	require.NoError(t, err)
+
+	resp, err := v.Exchange(context.Background(), request("www.example.com.", dns.TypeA, true))
+	require.NoError(t, err)
+	assert.Equal(t, dns.ExtendedErrorCodeDNSKEYMissing, extendedError(t, resp).InfoCode)
+}
+
+func TestValidator_CachesKeys(t *testing.T) {
+	v, p := newTestValidator(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := v.Exchange(context.Background(), request("www.sub.example.com.", dns.TypeA, true))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, p.queryCount("example.com.", dns.TypeDNSKEY))
+	assert.Equal(t, 1, p.queryCount("sub.example.com.", dns.TypeDS))
+
+	v.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, _ = v.Exchange(context.Background(), request("www.sub.example.com.", dns.TypeA, true))
+	assert.Equal(t, 2, p.queryCount("example.com.", dns.TypeDNSKEY))
+}
+
+func TestNew_TrustAnchors(t *testing.T) {
+	v, err := New(newTestPool(), Options{})
+	require.NoError(t, err)
+	assert.Len(t, v.(*validator).anchors["."], len(DefaultTrustAnchors))
+
+	_, err = New(newTestPool(), Options{TrustAnchors: []string{"example.com. IN A 10.0.0.1"}})
+	assert.ErrorIs(t, err, ErrInvalidTrustAnchor)
+
+	_, err = New(newTestPool(), Options{TrustAnchors: []string{"not a record"}})
+	assert.ErrorIs(t, err, ErrInvalidTrustAnchor)
+}
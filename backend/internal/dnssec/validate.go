@@ -0,0 +1,453 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	// errInsecure marks data that is provably outside any chain of trust.
+	errInsecure = errors.New("insecure")
+	// errNoDelegation marks a name inside a signed zone that is not a cut.
+	errNoDelegation = errors.New("not a delegation")
+)
+
+// bogusError is a validation failure, with the Extended DNS Error code that
+// best describes it.
+type bogusError struct {
+	code   uint16
+	reason string
+}
+
+func (e *bogusError) Error() string {
+	return e.reason
+}
+
+func bogus(code uint16, format string, args ...any) error {
+	return &bogusError{code: code, reason: fmt.Sprintf(format, args...)}
+}
+
+// validate returns nil when resp is secure, errInsecure when it is provably
+// unsigned, or a bogusError.
+func (v *validator) validate(ctx context.Context, q dns.Question, resp *dns.Msg) error {
+	if v.anchorFor(q.Name) == "" {
+		return errInsecure
+	}
+
+	insecure := false
+	check := func(err error) error {
+		if errors.Is(err, errInsecure) {
+			insecure = true
+			return nil
+		}
+		return err
+	}
+
+	answerSigs := signatures(resp.Answer)
+	for _, rrset := range rrsets(resp.Answer) {
+		if err := check(v.verifyRRset(ctx, rrset, answerSigs)); err != nil {
+			return err
+		}
+	}
+
+	target, found := finalTarget(resp.Answer, q.Name, q.Qtype)
+	if found && !insecure {
+		// Answers synthesized from a wildcard must prove the name itself
+		// does not exist.
+		if labels, expanded := wildcardLabels(answerSigs); expanded {
+			if err := check(v.verifyAuthority(ctx, target, resp.Ns)); err != nil {
+				return err
+			}
+			if !insecure && !provesWildcard(target, labels, resp.Ns) {
+				return bogus(dns.ExtendedErrorCodeNSECMissing, "missing proof for wildcard answer %s", target)
+			}
+		}
+	}
+
+	if !found && !insecure {
+		if err := check(v.verifyAuthority(ctx, target, resp.Ns)); err != nil {
+			return err
+		}
+		if !insecure {
+			var proven bool
+			if resp.Rcode == dns.RcodeNameError {
+				proven = provesNXDOMAIN(target, resp.Ns)
+			} else {
+				proven = provesNODATA(target, q.Qtype, resp.Ns)
+			}
+			if !proven {
+				return bogus(dns.ExtendedErrorCodeNSECMissing, "missing denial of existence for %s", target)
+			}
+		}
+	}
+
+	if insecure {
+		return errInsecure
+	}
+	return nil
+}
+
+// verifyAuthority checks the SOA and NSEC or NSEC3 records proving name
+// does not exist. An empty authority section has to be proven insecure.
+func (v *validator) verifyAuthority(ctx context.Context, name string, ns []dns.RR) error {
+	sigs := signatures(ns)
+	sets := rrsets(ns)
+	if len(sets) == 0 {
+		return v.insecureProof(ctx, name)
+	}
+
+	for _, rrset := range sets {
+		// Delegation NS sets are not signed by the parent.
+		if rrset[0].Header().Rrtype == dns.TypeNS {
+			continue
+		}
+		if err := v.verifyRRset(ctx, rrset, sigs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyRRset checks that one of the signatures covering rrset was made by a
+// validated key of its signer.
+func (v *validator) verifyRRset(ctx context.Context, rrset []dns.RR, sigs []*dns.RRSIG) error {
+	hdr := rrset[0].Header()
+	name := strings.ToLower(hdr.Name)
+
+	var covering []*dns.RRSIG
+	for _, sig := range sigs {
+		if sig.TypeCovered == hdr.Rrtype && strings.EqualFold(sig.Hdr.Name, name) {
+			covering = append(covering, sig)
+		}
+	}
+	if len(covering) == 0 {
+		return v.insecureProof(ctx, name)
+	}
+
+	lastErr := bogus(dns.ExtendedErrorCodeDNSBogus, "no valid signature for %s %s", name, dns.TypeToString[hdr.Rrtype])
+	for _, sig := range covering {
+		signer := strings.ToLower(sig.SignerName)
+		if !dns.IsSubDomain(signer, name) {
+			continue
+		}
+
+		keys, err := v.zoneKeys(ctx, signer)
+		if err != nil {
+			return err
+		}
+
+		if err := v.verifySignature(sig, keys, rrset); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+
+	return lastErr
+}
+
+func (v *validator) verifySignature(sig *dns.RRSIG, keys []*dns.DNSKEY, rrset []dns.RR) error {
+	now := v.now()
+	if !sig.ValidityPeriod(now) {
+		if int64(sig.Inception) > now.Unix() {
+			return bogus(dns.ExtendedErrorCodeSignatureNotYetValid, "signature for %s is not yet valid", sig.Hdr.Name)
+		}
+		return bogus(dns.ExtendedErrorCodeSignatureExpired, "signature for %s has expired", sig.Hdr.Name)
+	}
+
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+			continue
+		}
+		if err := sig.Verify(key, rrset); err == nil {
+			return nil
+		}
+	}
+
+	return bogus(dns.ExtendedErrorCodeDNSBogus, "signature verification failed for %s %s",
+		sig.Hdr.Name, dns.TypeToString[sig.TypeCovered])
+}
+
+// zoneKeys returns the validated DNSKEY set of zone, cached by its TTL.
+func (v *validator) zoneKeys(ctx context.Context, zone string) ([]*dns.DNSKEY, error) {
+	v.mu.Lock()
+	cached, ok := v.keys[zone]
+	v.mu.Unlock()
+	if ok && v.now().Before(cached.expiresAt) {
+		return cached.keys, cached.err
+	}
+
+	keys, ttl, err := v.fetchKeys(ctx, zone)
+
+	var bogusErr *bogusError
+	switch {
+	case err == nil:
+		ttl = min(ttl, maxKeyTTL)
+	case errors.Is(err, errInsecure):
+		ttl = maxKeyTTL
+	case errors.As(err, &bogusErr):
+		ttl = bogusKeyTTL
+	default:
+		// Lookup failures are not cached.
+		return nil, err
+	}
+
+	v.mu.Lock()
+	v.keys[zone] = zoneKeys{keys: keys, err: err, expiresAt: v.now().Add(ttl)}
+	v.mu.Unlock()
+
+	return keys, err
+}
+
+func (v *validator) fetchKeys(ctx context.Context, zone string) ([]*dns.DNSKEY, time.Duration, error) {
+	anchor := v.anchorFor(zone)
+	if anchor == "" {
+		return nil, 0, errInsecure
+	}
+
+	var trusted []dns.RR
+	if anchor == zone {
+		trusted = v.anchors[zone]
+	} else {
+		ds, err := v.dsStatus(ctx, zone)
+		if errors.Is(err, errNoDelegation) {
+			return nil, 0, bogus(dns.ExtendedErrorCodeDNSBogus, "signer %s is not a zone", zone)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		trusted = ds
+	}
+
+	resp, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rrset []dns.RR
+	var keys []*dns.DNSKEY
+	for _, rr := range resp.Answer {
+		if key, ok := rr.(*dns.DNSKEY); ok && strings.EqualFold(key.Hdr.Name, zone) {
+			rrset = append(rrset, key)
+			if key.Flags&dns.ZONE != 0 {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(rrset) == 0 {
+		return nil, 0, bogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY records for %s", zone)
+	}
+
+	var lastErr error = bogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY of %s matches its trust anchor", zone)
+	for _, rr := range rrset {
+		key := rr.(*dns.DNSKEY)
+		if !matchesAnchor(key, trusted) {
+			continue
+		}
+		if key.Flags&dns.ZONE == 0 {
+			lastErr = bogus(dns.ExtendedErrorCodeNoZoneKeyBitSet, "DNSKEY %d of %s is not a zone key", key.KeyTag(), zone)
+			continue
+		}
+
+		for _, sig := range signatures(resp.Answer) {
+			if sig.TypeCovered != dns.TypeDNSKEY || sig.KeyTag != key.KeyTag() {
+				continue
+			}
+			if err := v.verifySignature(sig, []*dns.DNSKEY{key}, rrset); err != nil {
+				lastErr = err
+				continue
+			}
+
+			return keys, time.Duration(rrset[0].Header().Ttl) * time.Second, nil
+		}
+	}
+
+	return nil, 0, lastErr
+}
+
+func matchesAnchor(key *dns.DNSKEY, trusted []dns.RR) bool {
+	for _, rr := range trusted {
+		switch anchor := rr.(type) {
+		case *dns.DNSKEY:
+			if anchor.KeyTag() == key.KeyTag() && anchor.Algorithm == key.Algorithm &&
+				anchor.PublicKey == key.PublicKey {
+				return true
+			}
+		case *dns.DS:
+			ds := key.ToDS(anchor.DigestType)
+			if ds != nil && ds.KeyTag == anchor.KeyTag && ds.Algorithm == anchor.Algorithm &&
+				strings.EqualFold(ds.Digest, anchor.Digest) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// dsStatus returns the validated DS set of name, errInsecure when name is
+// provably an unsigned delegation, or errNoDelegation when name sits inside
+// a signed zone.
+func (v *validator) dsStatus(ctx context.Context, name string) ([]dns.RR, error) {
+	resp, err := v.query(ctx, name, dns.TypeDS)
+	if err != nil {
+		return nil, err
+	}
+
+	// The DS set is signed by the parent, never by name itself.
+	var sigs []*dns.RRSIG
+	for _, sig := range signatures(append(resp.Answer, resp.Ns...)) {
+		signer := strings.ToLower(sig.SignerName)
+		if signer != name && dns.IsSubDomain(signer, name) {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	var ds []dns.RR
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == dns.TypeDS && strings.EqualFold(rr.Header().Name, name) {
+			ds = append(ds, rr)
+		}
+	}
+
+	if len(sigs) == 0 {
+		return nil, v.unsignedDS(ctx, name)
+	}
+
+	if len(ds) > 0 {
+		if err := v.verifyRRset(ctx, ds, sigs); err != nil {
+			return nil, err
+		}
+		return ds, nil
+	}
+
+	for _, rrset := range rrsets(resp.Ns) {
+		if rrset[0].Header().Rrtype == dns.TypeNS {
+			continue
+		}
+		if err := v.verifyRRset(ctx, rrset, sigs); err != nil {
+			return nil, err
+		}
+	}
+
+	if provesInsecureDelegation(name, resp.Ns) {
+		return nil, errInsecure
+	}
+
+	return nil, errNoDelegation
+}
+
+// unsignedDS handles a DS answer for name that came without signatures, which
+// is only legitimate when the parent itself is insecure.
+func (v *validator) unsignedDS(ctx context.Context, name string) error {
+	anchor := v.anchorFor(name)
+	if anchor == "" {
+		return errInsecure
+	}
+	if name == anchor {
+		return bogus(dns.ExtendedErrorCodeRRSIGsMissing, "no signatures for trust anchor %s", name)
+	}
+
+	off, _ := dns.NextLabel(name, 0)
+	return v.insecureProof(ctx, name[off:])
+}
+
+// insecureProof is called for unsigned data at name. It returns errInsecure
+// when name is provably below an unsigned delegation, bogus otherwise.
+func (v *validator) insecureProof(ctx context.Context, name string) error {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	anchor := v.anchorFor(name)
+	if anchor == "" {
+		return errInsecure
+	}
+	if name == anchor {
+		return bogus(dns.ExtendedErrorCodeRRSIGsMissing, "no signatures for trust anchor %s", name)
+	}
+
+	_, err := v.dsStatus(ctx, name)
+	if err == nil || errors.Is(err, errNoDelegation) {
+		return bogus(dns.ExtendedErrorCodeRRSIGsMissing, "missing signatures for %s in a signed zone", name)
+	}
+
+	return err
+}
+
+// rrsets groups records by owner, type and class, leaving out signatures and
+// OPT pseudo records.
+func rrsets(rrs []dns.RR) [][]dns.RR {
+	var res [][]dns.RR
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeRRSIG || hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%d/%d", strings.ToLower(hdr.Name), hdr.Rrtype, hdr.Class)
+		if i, ok := index[key]; ok {
+			res[i] = append(res[i], rr)
+			continue
+		}
+		index[key] = len(res)
+		res = append(res, []dns.RR{rr})
+	}
+
+	return res
+}
+
+func signatures(rrs []dns.RR) []*dns.RRSIG {
+	var sigs []*dns.RRSIG
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	return sigs
+}
+
+// finalTarget follows the CNAME chain for name and reports whether the answer
+// holds records of qtype for its target.
+func finalTarget(answer []dns.RR, name string, qtype uint16) (string, bool) {
+	target := strings.ToLower(name)
+	for i := 0; i <= len(answer); i++ {
+		next := ""
+		for _, rr := range answer {
+			hdr := rr.Header()
+			if !strings.EqualFold(hdr.Name, target) {
+				continue
+			}
+			if hdr.Rrtype == qtype {
+				return target, true
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				next = strings.ToLower(cname.Target)
+			}
+		}
+		if next == "" {
+			break
+		}
+		target = next
+	}
+
+	return target, false
+}
+
+// wildcardLabels reports whether an answer record was expanded from a
+// wildcard, returning the label count of the wildcard owner.
+func wildcardLabels(sigs []*dns.RRSIG) (uint8, bool) {
+	for _, sig := range sigs {
+		if int(sig.Labels) < dns.CountLabel(sig.Hdr.Name) {
+			return sig.Labels, true
+		}
+	}
+
+	return 0, false
+}
@@ -19,6 +19,7 @@ type DB interface {
 	GetAll(ctx context.Context) ([]Domain, error)
 	GetByDomain(ctx context.Context, domain string) (*Domain, error)
 	GetDomainsWithoutCategory(ctx context.Context) ([]Domain, error)
+	GetMostUsed(ctx context.Context, limit int) ([]Domain, error)
 }
 
 func New(db *db.DB) DB {
@@ -46,6 +47,25 @@ func (b *domainsDB) GetDomainsWithoutCategory(ctx context.Context) ([]Domain, er
 	return domains, nil
 }
 
+func (b *domainsDB) GetMostUsed(ctx context.Context, limit int) ([]Domain, error) {
+	rows, err := b.db.Query(ctx, `
+		SELECT domain, used_count, created_at, updated_at
+		FROM domains
+		ORDER BY used_count DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := pgx.CollectRows(rows, pgx.RowToStructByName[Domain])
+	if err != nil {
+		return nil, err
+	}
+
+	return domains, nil
+}
+
 func (b *domainsDB) GetByDomain(ctx context.Context, domain string) (*Domain, error) {
 	row, err := b.db.Query(ctx, `
 		SELECT domain, used_count, created_at, updated_at
@@ -159,3 +159,30 @@ func TestDomainsDB_GetDomainsWithoutCategory(t *testing.T) {
 	assert.Equal(t, "google.com", results[0].Domain)
 	assert.Equal(t, "facebook.com", results[1].Domain)
 }
+
+func TestDomainsDB_GetMostUsed(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	domainsDB := New(database)
+
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `
+		INSERT INTO domains (domain, used_count) VALUES 
+		('google.com', 100),
+		('facebook.com', 50),
+		('youtube.com', 75)
+	`)
+	require.NoError(t, err)
+
+	results, err := domainsDB.GetMostUsed(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "google.com", results[0].Domain)
+	assert.Equal(t, 100, results[0].UsedCount)
+	assert.Equal(t, "youtube.com", results[1].Domain)
+}
@@ -0,0 +1,46 @@
+package dto
+
+type GroupRequest struct {
+	Name              string   `json:"name"`
+	Upstreams         []string `json:"upstreams"`
+	BlockedCategories []string `json:"blockedCategories"`
+	ScheduleID        *int64   `json:"scheduleId"`
+	// SafeSearch overrides the server setting when set.
+	SafeSearch *bool `json:"safeSearch"`
+}
+
+type GroupResponse struct {
+	ID                int64    `json:"id"`
+	Name              string   `json:"name"`
+	Upstreams         []string `json:"upstreams"`
+	BlockedCategories []string `json:"blockedCategories"`
+	ScheduleID        *int64   `json:"scheduleId"`
+	SafeSearch        *bool    `json:"safeSearch"`
+}
+
+type ClientRequest struct {
+	GroupID int64  `json:"groupId"`
+	Name    string `json:"name"`
+	// Kind is ip, cidr or client_id.
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type ClientResponse struct {
+	ID      int64  `json:"id"`
+	GroupID int64  `json:"groupId"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Value   string `json:"value"`
+}
+
+type GroupRuleRequest struct {
+	Domain    string `json:"domain"`
+	Recursive bool   `json:"recursive"`
+	// ScheduleID only applies to blocked domains.
+	ScheduleID *int64 `json:"scheduleId"`
+}
+
+type IDResponse struct {
+	ID int64 `json:"id"`
+}
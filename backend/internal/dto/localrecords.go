@@ -0,0 +1,20 @@
+package dto
+
+type LocalRecordRequest struct {
+	// Name may start with "*." to cover every name below the rest of it.
+	Name string `json:"name"`
+	// Type is A, AAAA, CNAME, TXT, SRV, PTR or MX.
+	Type string `json:"type"`
+	// Value is the record data in zone file format.
+	Value string `json:"value"`
+	// TTL is in seconds, 300 when zero.
+	TTL int32 `json:"ttl"`
+}
+
+type LocalRecordResponse struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   int32  `json:"ttl"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+type ScheduleRequest struct {
+	Name     string `json:"name"`
+	Timezone string `json:"timezone"`
+	// Days are "mon" to "sun", empty for every day.
+	Days []string `json:"days"`
+	// Windows are "HH:MM-HH:MM" ranges, empty for the whole day.
+	Windows []string `json:"windows"`
+}
+
+type ScheduleResponse struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Timezone string   `json:"timezone"`
+	Days     []string `json:"days"`
+	Windows  []string `json:"windows"`
+}
+
+type CategoryPolicyRequest struct {
+	Blocked    bool   `json:"blocked"`
+	ScheduleID *int64 `json:"scheduleId"`
+}
@@ -23,3 +23,28 @@ type GetServerUsageByTimeRangeResponse struct {
 	TimeRange time.Time `json:"timeRange"`
 	Count     int64     `json:"count"`
 }
+
+type GetMostActiveClientsRequest struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type GetMostActiveClientsResponse struct {
+	Client string `json:"client"`
+	// Hostname is the PTR name of the client, empty when unknown.
+	Hostname string `json:"hostname"`
+	Count    int64  `json:"count"`
+}
+
+type GetUpstreamStatsResponse struct {
+	// Pool is "default" for the upstream servers, "forwarding" for the
+	// servers of the forwarding rules and the private reverse zones, or
+	// "group " followed by the names of the client groups using the servers.
+	Pool         string    `json:"pool"`
+	Address      string    `json:"address"`
+	Healthy      bool      `json:"healthy"`
+	Queries      int64     `json:"queries"`
+	Errors       int64     `json:"errors"`
+	AvgLatencyMs float64   `json:"avgLatencyMs"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,102 @@
+package localrecords
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/orion-tec/oriondns/db"
+)
+
+var ErrNotFound = fmt.Errorf("not found")
+
+type localRecordsDB struct {
+	db *db.DB
+}
+
+// DB stores the records answered by the server itself.
+type DB interface {
+	Insert(ctx context.Context, record Record) (int64, error)
+	GetAll(ctx context.Context) ([]Record, error)
+	Update(ctx context.Context, record Record) error
+	Delete(ctx context.Context, id int64) error
+}
+
+func New(db *db.DB) DB {
+	return &localRecordsDB{db}
+}
+
+func (l *localRecordsDB) Insert(ctx context.Context, record Record) (int64, error) {
+	if record.TTL <= 0 {
+		record.TTL = DefaultTTL
+	}
+
+	var id int64
+	err := l.db.QueryRow(ctx, `
+		INSERT INTO local_records (name, type, value, ttl)
+			VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, record.Name, record.Type, record.Value, record.TTL).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (l *localRecordsDB) GetAll(ctx context.Context) ([]Record, error) {
+	rows, err := l.db.Query(ctx, `
+		SELECT id, name, type, value, ttl, created_at, updated_at, deleted_at
+		FROM local_records
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := pgx.CollectRows(rows, pgx.RowToStructByName[Record])
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (l *localRecordsDB) Update(ctx context.Context, record Record) error {
+	if record.TTL <= 0 {
+		record.TTL = DefaultTTL
+	}
+
+	tag, err := l.db.Exec(ctx, `
+		UPDATE local_records
+		SET name = $2, type = $3, value = $4, ttl = $5, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, record.ID, record.Name, record.Type, record.Value, record.TTL)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (l *localRecordsDB) Delete(ctx context.Context, id int64) error {
+	tag, err := l.db.Exec(ctx, `
+		DELETE FROM local_records
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package localrecords
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/testutil"
+)
+
+func TestRecord_RR(t *testing.T) {
+	rr, err := Record{Name: "nas.home.lan", Type: TypeA, Value: "192.168.0.10"}.RR()
+	require.NoError(t, err)
+	assert.Equal(t, "nas.home.lan.", rr.Header().Name)
+	assert.Equal(t, uint32(DefaultTTL), rr.Header().Ttl)
+
+	rr, err = Record{Name: "home.lan", Type: TypeTXT, Value: `say "hi"`, TTL: 60}.RR()
+	require.NoError(t, err)
+	// TXT strings are kept escaped, as in zone files.
+	assert.Equal(t, []string{`say \"hi\"`}, rr.(*dns.TXT).Txt)
+	assert.Equal(t, uint32(60), rr.Header().Ttl)
+
+	// Zone file syntax in TXT values is kept as text.
+	rr, err = Record{Name: "home.lan", Type: TypeTXT, Value: "a\nhome.lan. 60 IN A 10.0.0.1 ; b"}.RR()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`a\010home.lan. 60 IN A 10.0.0.1 ; b`}, rr.(*dns.TXT).Txt)
+	assert.Equal(t, "home.lan.\t300\tIN\tTXT\t\"a\\010home.lan. 60 IN A 10.0.0.1 ; b\"", rr.String())
+
+	rr, err = Record{Name: "_sip._tcp.office", Type: TypeSRV, Value: "10 5 5060 sip.office."}.RR()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(5060), rr.(*dns.SRV).Port)
+
+	rr, err = Record{Name: "*.printers.office", Type: TypeMX, Value: "10 mail.office"}.RR()
+	require.NoError(t, err)
+	assert.Equal(t, "*.printers.office.", rr.Header().Name)
+	assert.Equal(t, "mail.office.", rr.(*dns.MX).Mx)
+
+	for _, r := range []Record{
+		{Type: TypeA, Value: "192.168.0.10"},
+		{Name: "nas.home.lan", Type: "NS", Value: "ns.home.lan."},
+		{Name: "nas.home.lan", Type: TypeA, Value: "fe80::1"},
+		{Name: "nas.home.lan", Type: TypeMX, Value: "mail.home.lan."},
+		{Name: "nas.home.lan", Type: TypeA, Value: ""},
+		{Name: "nas.home.lan 60 IN A 10.0.0.1\nx", Type: TypeA, Value: "192.168.0.10"},
+		{Name: "nas;.home.lan", Type: TypeA, Value: "192.168.0.10"},
+		{Name: "nas.home.lan", Type: TypeA, Value: "192.168.0.10\nnas.home.lan. A 10.0.0.1"},
+		{Name: "nas.home.lan", Type: TypeCNAME, Value: "a.home.lan. ; comment"},
+		{Name: "nas.home.lan", Type: TypeMX, Value: "10 mail.home.lan. 20"},
+		{Name: "nas.home.lan", Type: TypeSRV, Value: "10 5 70000 sip.office."},
+		{Name: "nas.home.lan", Type: TypeTXT, Value: ""},
+	} {
+		assert.ErrorIs(t, r.Validate(), ErrInvalidRecord, "%+v", r)
+	}
+}
+
+func TestLocalRecordsDB(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	localRecordsDB := New(database)
+
+	ctx := context.Background()
+
+	id, err := localRecordsDB.Insert(ctx, Record{Name: "nas.home.lan", Type: TypeA, Value: "192.168.0.10"})
+	require.NoError(t, err)
+
+	records, err := localRecordsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int32(DefaultTTL), records[0].TTL)
+
+	err = localRecordsDB.Update(ctx, Record{ID: id, Name: "nas.home.lan", Type: TypeA, Value: "192.168.0.11", TTL: 60})
+	require.NoError(t, err)
+	assert.ErrorIs(t, localRecordsDB.Update(ctx, Record{ID: id + 1, Name: "x", Type: TypeA}), ErrNotFound)
+
+	records, err = localRecordsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "192.168.0.11", records[0].Value)
+	assert.Equal(t, int32(60), records[0].TTL)
+
+	require.NoError(t, localRecordsDB.Delete(ctx, id))
+	assert.ErrorIs(t, localRecordsDB.Delete(ctx, id), ErrNotFound)
+}
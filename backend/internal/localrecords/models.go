@@ -0,0 +1,181 @@
+package localrecords
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Types of records that can be served locally.
+const (
+	TypeA     = "A"
+	TypeAAAA  = "AAAA"
+	TypeCNAME = "CNAME"
+	TypeTXT   = "TXT"
+	TypeSRV   = "SRV"
+	TypePTR   = "PTR"
+	TypeMX    = "MX"
+)
+
+const DefaultTTL = 300
+
+var ErrInvalidRecord = fmt.Errorf("invalid record")
+
+// Record is a record answered by the server itself. Name may start with a
+// "*." label to answer every name below the rest of it that has no records
+// of its own.
+type Record struct {
+	ID   int64
+	Name string
+	Type string
+	// Value is the record data, like "192.168.0.10" for A records,
+	// "10 mail.home.lan." for MX records or "10 5 5060 sip.home.lan." for SRV
+	// records. TXT values are the text itself, without quotes.
+	Value     string
+	TTL       int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// RR builds the record, checking every field strictly so values never
+// change its meaning. TXT values are taken literally, and a zero TTL is
+// replaced by DefaultTTL.
+func (r Record) RR() (dns.RR, error) {
+	name := strings.TrimSpace(r.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidRecord)
+	}
+	if !validName(strings.TrimPrefix(name, "*."), false) {
+		return nil, fmt.Errorf("%w: bad name %q", ErrInvalidRecord, r.Name)
+	}
+
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: dns.Fqdn(name), Rrtype: rrtype, Class: dns.ClassINET, Ttl: uint32(ttl)}
+	}
+	bad := fmt.Errorf("%w: bad %s record %q", ErrInvalidRecord, r.Type, r.Value)
+
+	value := strings.TrimSpace(r.Value)
+	fields := strings.Fields(value)
+	switch r.Type {
+	case TypeA, TypeAAAA:
+		addr, err := netip.ParseAddr(value)
+		if err != nil || addr.Zone() != "" || addr.Is4() != (r.Type == TypeA) {
+			return nil, bad
+		}
+		if r.Type == TypeA {
+			return &dns.A{Hdr: hdr(dns.TypeA), A: addr.AsSlice()}, nil
+		}
+		return &dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: addr.AsSlice()}, nil
+	case TypeCNAME, TypePTR:
+		if !validName(value, false) {
+			return nil, bad
+		}
+		if r.Type == TypeCNAME {
+			return &dns.CNAME{Hdr: hdr(dns.TypeCNAME), Target: dns.Fqdn(value)}, nil
+		}
+		return &dns.PTR{Hdr: hdr(dns.TypePTR), Ptr: dns.Fqdn(value)}, nil
+	case TypeMX:
+		// "." is the null MX of RFC 7505.
+		if len(fields) != 2 || !validName(fields[1], true) {
+			return nil, bad
+		}
+		pref, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, bad
+		}
+		return &dns.MX{Hdr: hdr(dns.TypeMX), Preference: uint16(pref), Mx: dns.Fqdn(fields[1])}, nil
+	case TypeSRV:
+		if len(fields) != 4 || !validName(fields[3], true) {
+			return nil, bad
+		}
+		var nums [3]uint16
+		for i := range nums {
+			n, err := strconv.ParseUint(fields[i], 10, 16)
+			if err != nil {
+				return nil, bad
+			}
+			nums[i] = uint16(n)
+		}
+		return &dns.SRV{
+			Hdr:      hdr(dns.TypeSRV),
+			Priority: nums[0],
+			Weight:   nums[1],
+			Port:     nums[2],
+			Target:   dns.Fqdn(fields[3]),
+		}, nil
+	case TypeTXT:
+		if value == "" {
+			return nil, bad
+		}
+		return &dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: txtStrings(value)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidRecord, r.Type)
+}
+
+// validName reports whether name is made of letters, digits, hyphens and
+// underscores, with an optional trailing dot. root allows "." itself.
+func validName(name string, root bool) bool {
+	if name == "." {
+		return root
+	}
+
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// txtStrings splits value into the strings of a TXT record, of at most 255
+// bytes each, escaped as the dns package keeps them.
+func txtStrings(value string) []string {
+	var res []string
+	for len(value) > 0 {
+		n := min(len(value), 255)
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			switch c := value[i]; {
+			case c == '"' || c == '\\':
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+			case c < ' ' || c > '~':
+				fmt.Fprintf(&sb, "\\%03d", c)
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		res = append(res, sb.String())
+		value = value[n:]
+	}
+
+	return res
+}
+
+// Validate checks that the record can be parsed.
+func (r Record) Validate() error {
+	_, err := r.RR()
+	return err
+}
@@ -0,0 +1,98 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	maxPatternLen = 512
+	// maxPatternInsts bounds the compiled program size. Go regexps run in
+	// time linear in the input, but the constant grows with the program, and
+	// nested repetitions like (a{100}){100} expand to huge programs.
+	maxPatternInsts = 4096
+)
+
+var ErrInvalidPattern = fmt.Errorf("invalid pattern")
+
+// CompileGlob compiles a glob over domain names, where * matches any run of
+// characters and ? a single character, both within one label. With
+// subdomains set the glob also matches every name below a match. Patterns
+// match normalized names, see Normalize.
+func CompileGlob(glob string, subdomains bool) (*regexp.Regexp, error) {
+	glob = Normalize(glob)
+	if glob == "" {
+		return nil, fmt.Errorf("%w: empty glob", ErrInvalidPattern)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if subdomains {
+		b.WriteString(`(?:[^.]+\.)*`)
+	}
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(`[^.]*`)
+		case '?':
+			b.WriteString(`[^.]`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return compile(b.String())
+}
+
+// GlobSuffix returns the labels of glob right of the last label holding a
+// wildcard. Every name the glob matches falls under the suffix.
+func GlobSuffix(glob string) string {
+	glob = Normalize(glob)
+	i := strings.LastIndexAny(glob, "*?")
+	if i < 0 {
+		return glob
+	}
+
+	dot := strings.IndexByte(glob[i:], '.')
+	if dot < 0 {
+		return ""
+	}
+
+	return glob[i+dot+1:]
+}
+
+// CompileRegexp compiles a case insensitive regular expression over
+// normalized domain names. It must be anchored with a leading ^ or a
+// trailing $ so a rule cannot accidentally match anywhere in a name.
+func CompileRegexp(pattern string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(pattern, "^") && !strings.HasSuffix(pattern, "$") {
+		return nil, fmt.Errorf("%w: %q is not anchored", ErrInvalidPattern, pattern)
+	}
+
+	return compile("(?i)" + pattern)
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > maxPatternLen {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidPattern, maxPatternLen)
+	}
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPattern, err)
+	}
+
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPattern, err)
+	}
+
+	if len(prog.Inst) > maxPatternInsts {
+		return nil, fmt.Errorf("%w: %q is too complex", ErrInvalidPattern, pattern)
+	}
+
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,77 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileGlob(t *testing.T) {
+	testCases := []struct {
+		glob       string
+		subdomains bool
+		name       string
+		match      bool
+	}{
+		{"ads*.example.com", false, "ads.example.com", true},
+		{"ads*.example.com", false, "ads42.example.com", true},
+		{"ads*.example.com", false, "x.ads42.example.com", false},
+		{"ads*.example.com", false, "ads.x.example.com", false},
+		{"ads*.example.com", false, "bads.example.com", false},
+		{"ads*.example.com", true, "x.ads42.example.com", true},
+		{"ad?.example.com", false, "ad1.example.com", true},
+		{"ad?.example.com", false, "ad12.example.com", false},
+		{"*.example.com", false, "www.example.com", true},
+		{"*.example.com", false, "a.b.example.com", false},
+		{"Track*.Example.COM.", false, "tracker.example.com", true},
+		{"a+b.example.com", false, "a+b.example.com", true},
+		{"a+b.example.com", false, "aab.example.com", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.glob+" "+tc.name, func(t *testing.T) {
+			re, err := CompileGlob(tc.glob, tc.subdomains)
+			require.NoError(t, err)
+			assert.Equal(t, tc.match, re.MatchString(tc.name))
+		})
+	}
+
+	_, err := CompileGlob(".", false)
+	assert.ErrorIs(t, err, ErrInvalidPattern)
+}
+
+func TestGlobSuffix(t *testing.T) {
+	assert.Equal(t, "example.com", GlobSuffix("ads*.example.com"))
+	assert.Equal(t, "example.com", GlobSuffix("a.b?.example.com."))
+	assert.Equal(t, "com", GlobSuffix("*.*.com"))
+	assert.Equal(t, "ads.example.com", GlobSuffix("ads.example.com"))
+	assert.Equal(t, "", GlobSuffix("ads.*"))
+}
+
+func TestCompileRegexp(t *testing.T) {
+	re, err := CompileRegexp(`^track[0-9]+\.`)
+	require.NoError(t, err)
+	assert.True(t, re.MatchString("track42.example.com"))
+	assert.True(t, re.MatchString("TRACK42.example.com"))
+	assert.False(t, re.MatchString("x.track42.example.com"))
+	assert.False(t, re.MatchString("tracker.example.com"))
+
+	re, err = CompileRegexp(`\.doubleclick\.net$`)
+	require.NoError(t, err)
+	assert.True(t, re.MatchString("ad.doubleclick.net"))
+}
+
+func TestCompileRegexp_Rejects(t *testing.T) {
+	for _, pattern := range []string{
+		`track[0-9]+`,
+		`^(track`,
+		`^((a{100}){100}){100}$`,
+		`^(a{1000}){10}$`,
+		"^" + strings.Repeat("a", maxPatternLen),
+	} {
+		_, err := CompileRegexp(pattern)
+		assert.ErrorIs(t, err, ErrInvalidPattern, pattern)
+	}
+}
@@ -0,0 +1,164 @@
+package matcher
+
+import "strings"
+
+// Trie matches domain names against rules for exact names and whole subtrees.
+// Labels are stored from the TLD down, so a lookup visits at most one node per
+// label of the queried name and subtree rules only match on label boundaries.
+//
+// A Trie is not safe for concurrent writes. Build it off the hot path and
+// publish it once complete; lookups on a published Trie need no locking.
+type Trie[T any] struct {
+	root node[T]
+	len  int
+}
+
+type node[T any] struct {
+	children map[string]*node[T]
+	exact    *T
+	subtree  *T
+}
+
+func New[T any]() *Trie[T] {
+	return &Trie[T]{}
+}
+
+// Normalize lower cases domain and strips surrounding dots and spaces, so
+// "Example.COM.", ".example.com" and "example.com" are the same rule.
+func Normalize(domain string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+}
+
+// Insert adds a rule for domain. With subdomains set, the rule matches domain
+// and every name below it. A later rule for the same domain and kind replaces
+// the earlier one.
+func (t *Trie[T]) Insert(domain string, subdomains bool, value T) {
+	domain = Normalize(domain)
+	if domain == "" {
+		return
+	}
+
+	n := &t.root
+	for domain != "" {
+		var label string
+		label, domain = lastLabel(domain)
+
+		child, ok := n.children[label]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*node[T])
+			}
+			child = &node[T]{}
+			n.children[label] = child
+		}
+		n = child
+	}
+
+	if subdomains {
+		if n.subtree == nil {
+			t.len++
+		}
+		n.subtree = &value
+		return
+	}
+
+	if n.exact == nil {
+		t.len++
+	}
+	n.exact = &value
+}
+
+// Get returns the value of the rule for domain and kind, if any.
+func (t *Trie[T]) Get(domain string, subdomains bool) (T, bool) {
+	domain = Normalize(domain)
+
+	var value *T
+	if n := t.find(domain); n != nil {
+		value = n.exact
+		if subdomains {
+			value = n.subtree
+		}
+	}
+
+	if value == nil {
+		var zero T
+		return zero, false
+	}
+
+	return *value, true
+}
+
+// Match returns the value of the most specific rule matching name: an exact
+// rule for name itself, otherwise the subtree rule of its closest ancestor.
+func (t *Trie[T]) Match(name string) (T, bool) {
+	var res T
+	var found bool
+	t.Walk(name, func(value T) bool {
+		res, found = value, true
+		return false
+	})
+
+	return res, found
+}
+
+// Walk calls fn with the values of the rules matching name, most specific
+// first, until fn returns false.
+func (t *Trie[T]) Walk(name string, fn func(T) bool) {
+	name = Normalize(name)
+
+	var stack [16]*node[T]
+	path := stack[:0]
+
+	n := &t.root
+	for name != "" {
+		var label string
+		label, name = lastLabel(name)
+
+		child, ok := n.children[label]
+		if !ok {
+			break
+		}
+		n = child
+		path = append(path, n)
+
+		if name == "" && n.exact != nil && !fn(*n.exact) {
+			return
+		}
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].subtree != nil && !fn(*path[i].subtree) {
+			return
+		}
+	}
+}
+
+// Len returns the number of rules in the trie.
+func (t *Trie[T]) Len() int {
+	return t.len
+}
+
+func (t *Trie[T]) find(domain string) *node[T] {
+	n := &t.root
+	for domain != "" {
+		var label string
+		label, domain = lastLabel(domain)
+
+		child, ok := n.children[label]
+		if !ok {
+			return nil
+		}
+		n = child
+	}
+
+	return n
+}
+
+func lastLabel(name string) (string, string) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return name, ""
+	}
+
+	return name[i+1:], name[:i]
+}
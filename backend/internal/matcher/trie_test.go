@@ -0,0 +1,129 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, domain := range []string{"example.com", "Example.COM.", ".example.com", " example.com. "} {
+		assert.Equal(t, "example.com", Normalize(domain), domain)
+	}
+}
+
+func TestTrie_Match(t *testing.T) {
+	trie := New[string]()
+	trie.Insert("malware.com.", false, "exact")
+	trie.Insert(".ads.example.com", true, "ads")
+	trie.Insert("evil.com", true, "evil")
+	trie.Insert("deep.ads.example.com", false, "deep")
+
+	testCases := []struct {
+		name  string
+		want  string
+		match bool
+	}{
+		{"malware.com.", "exact", true},
+		{"MALWARE.com", "exact", true},
+		{"www.malware.com.", "", false},
+		{"ads.example.com.", "ads", true},
+		{"tracker.ads.example.com.", "ads", true},
+		{"a.b.c.ads.example.com.", "ads", true},
+		{"deep.ads.example.com.", "deep", true},
+		{"x.deep.ads.example.com.", "ads", true},
+		{"example.com.", "", false},
+		{"safe.example.com.", "", false},
+		{"evil.com.", "evil", true},
+		{"sub.evil.com.", "evil", true},
+		{"notevil.com.", "", false},
+		{"evil.com.org.", "", false},
+		{"com.", "", false},
+		{".", "", false},
+		{"", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := trie.Match(tc.name)
+			assert.Equal(t, tc.match, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestTrie_MostSpecificSubtreeWins(t *testing.T) {
+	trie := New[string]()
+	trie.Insert("example.com", true, "outer")
+	trie.Insert("inner.example.com", true, "inner")
+
+	got, _ := trie.Match("a.inner.example.com")
+	assert.Equal(t, "inner", got)
+
+	got, _ = trie.Match("a.example.com")
+	assert.Equal(t, "outer", got)
+}
+
+func TestTrie_Len(t *testing.T) {
+	trie := New[int]()
+	trie.Insert("example.com", false, 1)
+	trie.Insert("example.com", true, 2)
+	trie.Insert("Example.com.", false, 3)
+	trie.Insert("", true, 4)
+
+	assert.Equal(t, 2, trie.Len())
+
+	got, _ := trie.Match("example.com")
+	assert.Equal(t, 3, got)
+}
+
+func BenchmarkTrie_Match(b *testing.B) {
+	trie := New[int]()
+	for i := 0; i < 1_000_000; i++ {
+		trie.Insert(fmt.Sprintf("host%d.tracker%d.example.com", i, i%1000), i%2 == 0, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Match("a.b.host4242.tracker242.example.com.")
+	}
+}
+
+func TestTrie_Get(t *testing.T) {
+	trie := New[string]()
+	trie.Insert("example.com", true, "subtree")
+
+	got, ok := trie.Get("Example.com.", true)
+	assert.True(t, ok)
+	assert.Equal(t, "subtree", got)
+
+	_, ok = trie.Get("example.com", false)
+	assert.False(t, ok)
+	_, ok = trie.Get("com", true)
+	assert.False(t, ok)
+	_, ok = trie.Get("missing.example.com", true)
+	assert.False(t, ok)
+}
+
+func TestTrie_Walk(t *testing.T) {
+	trie := New[string]()
+	trie.Insert("com", true, "com")
+	trie.Insert("example.com", true, "example subtree")
+	trie.Insert("a.example.com", false, "a exact")
+	trie.Insert("a.example.com", true, "a subtree")
+
+	var visited []string
+	trie.Walk("a.example.com.", func(v string) bool {
+		visited = append(visited, v)
+		return true
+	})
+	assert.Equal(t, []string{"a exact", "a subtree", "example subtree", "com"}, visited)
+
+	visited = nil
+	trie.Walk("b.example.com.", func(v string) bool {
+		visited = append(visited, v)
+		return len(visited) < 1
+	})
+	assert.Equal(t, []string{"example subtree"}, visited)
+}
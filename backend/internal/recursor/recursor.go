@@ -0,0 +1,439 @@
+package recursor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+const (
+	defaultTimeout = 2 * time.Second
+
+	// Limits that keep a misconfigured or malicious hierarchy from making the
+	// resolver loop forever.
+	maxReferrals = 30
+	maxCNAMEs    = 10
+	maxDepth     = 5
+
+	// maxDelegations bounds the delegations kept, so resolving many unique
+	// zones does not grow memory without limit.
+	maxDelegations = 10000
+)
+
+var (
+	ErrNoServers   = fmt.Errorf("no name server answered")
+	ErrLame        = fmt.Errorf("lame delegation")
+	ErrMaxDepth    = fmt.Errorf("maximum resolution depth exceeded")
+	ErrCNAMELoop   = fmt.Errorf("cname chain too long")
+	ErrBadQuestion = fmt.Errorf("query must have exactly one question")
+)
+
+// DefaultRootHints are the IPv4 addresses of a.root-servers.net through
+// m.root-servers.net.
+var DefaultRootHints = []string{
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+type Options struct {
+	// RootHints are root server addresses as ip or ip:port. DefaultRootHints
+	// is used when empty.
+	RootHints []string
+	// Timeout applies to every query sent to an authoritative server.
+	Timeout time.Duration
+}
+
+type recursor struct {
+	rootHints []string
+	client    *dns.Client
+	tcpClient *dns.Client
+
+	// serverAddr turns the address of a name server learned from a referral
+	// into the address queried, so tests can map them to local ports.
+	serverAddr func(ip string) string
+
+	mu          sync.Mutex
+	delegations map[string]delegation
+	now         func() time.Time
+}
+
+type delegation struct {
+	servers   []string
+	expiresAt time.Time
+}
+
+// New returns an iterative resolver that starts at the root hints and follows
+// referrals itself. It implements upstream.Pool so it can replace forwarding.
+func New(opts Options) upstream.Pool {
+	if len(opts.RootHints) == 0 {
+		opts.RootHints = DefaultRootHints
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	rootHints := make([]string, len(opts.RootHints))
+	for i, hint := range opts.RootHints {
+		rootHints[i] = withDefaultPort(hint)
+	}
+
+	return &recursor{
+		rootHints:   rootHints,
+		client:      &dns.Client{Net: "udp", Timeout: opts.Timeout},
+		tcpClient:   &dns.Client{Net: "tcp", Timeout: opts.Timeout},
+		serverAddr:  withDefaultPort,
+		delegations: make(map[string]delegation),
+		now:         time.Now,
+	}
+}
+
+func withDefaultPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+
+	return net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+}
+
+func (r *recursor) Exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	if len(req.Question) != 1 {
+		return nil, ErrBadQuestion
+	}
+
+	do := false
+	if opt := req.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+
+	result, err := r.resolve(ctx, req.Question[0], do, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	resp.SetRcode(req, result.Rcode)
+	resp.RecursionAvailable = true
+	resp.Answer = result.Answer
+	resp.Ns = result.Ns
+	if opt := req.IsEdns0(); opt != nil {
+		resp.SetEdns0(opt.UDPSize(), do)
+	}
+
+	return resp, nil
+}
+
+// Stats is empty as the resolver talks to whichever servers the hierarchy
+// points it to.
+func (r *recursor) Stats() []upstream.Stats {
+	return nil
+}
+
+func (r *recursor) Start() {}
+
+func (r *recursor) Stop() {}
+
+// resolve answers q, chasing CNAMEs that lead out of the answering zone.
+// Records outside of that zone are dropped rather than trusted, so their
+// names are resolved from their own zones.
+func (r *recursor) resolve(ctx context.Context, q dns.Question, do bool, depth int) (*dns.Msg, error) {
+	if depth > maxDepth {
+		return nil, ErrMaxDepth
+	}
+
+	result := new(dns.Msg)
+	name := q.Name
+	for i := 0; i < maxCNAMEs; i++ {
+		resp, zone, err := r.iterate(ctx, dns.Question{Name: name, Qtype: q.Qtype, Qclass: q.Qclass}, do, depth)
+		if err != nil {
+			return nil, err
+		}
+		resp.Answer = inBailiwick(resp.Answer, zone)
+		resp.Ns = inBailiwick(resp.Ns, zone)
+
+		result.Rcode = resp.Rcode
+		result.Answer = append(result.Answer, resp.Answer...)
+
+		target, ok := unresolvedCNAME(resp.Answer, name, q.Qtype)
+		if !ok {
+			if len(resp.Answer) == 0 || resp.Rcode == dns.RcodeNameError {
+				result.Ns = resp.Ns
+			}
+			return result, nil
+		}
+
+		name = target
+	}
+
+	return nil, ErrCNAMELoop
+}
+
+// iterate follows referrals from the closest known delegation of q.Name until
+// a server answers authoritatively, returning the answer and its zone.
+func (r *recursor) iterate(ctx context.Context, q dns.Question, do bool, depth int) (*dns.Msg, string, error) {
+	// DS records live on the parent side of a zone cut.
+	start := q.Name
+	if q.Qtype == dns.TypeDS && q.Name != "." {
+		off, _ := dns.NextLabel(q.Name, 0)
+		start = q.Name[off:]
+	}
+	zone, servers := r.closestDelegation(start)
+
+	for i := 0; i < maxReferrals; i++ {
+		resp, err := r.queryServers(ctx, servers, q, do)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if resp.Rcode == dns.RcodeNameError || len(resp.Answer) > 0 || resp.Authoritative {
+			return resp, zone, nil
+		}
+
+		child, nsNames, ttl := referral(resp, zone, q.Name)
+		if child == "" || q.Qtype == dns.TypeDS && strings.EqualFold(child, q.Name) {
+			return nil, "", fmt.Errorf("%w: %s for %s", ErrLame, zone, q.Name)
+		}
+
+		servers = r.glue(resp, zone, nsNames)
+		if len(servers) == 0 {
+			servers = r.lookupServers(ctx, nsNames, depth)
+		}
+		if len(servers) == 0 {
+			return nil, "", fmt.Errorf("%w: no address for the name servers of %s", ErrNoServers, child)
+		}
+
+		r.storeDelegation(child, servers, ttl)
+		zone = child
+	}
+
+	return nil, "", fmt.Errorf("%w: too many referrals for %s", ErrMaxDepth, q.Name)
+}
+
+func (r *recursor) queryServers(ctx context.Context, servers []string, q dns.Question, do bool) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(q.Name, q.Qtype)
+	msg.Question[0].Qclass = q.Qclass
+	msg.RecursionDesired = false
+	msg.SetEdns0(dns.DefaultMsgSize, do)
+
+	lastErr := ErrNoServers
+	for _, server := range servers {
+		resp, _, err := r.client.ExchangeContext(ctx, msg, server)
+		if err == nil && resp.Truncated {
+			resp, _, err = r.tcpClient.ExchangeContext(ctx, msg, server)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%w: %w", ErrNoServers, err)
+			continue
+		}
+
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("%w: %s answered %s", ErrNoServers, server, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// referral returns the child zone and its name servers when resp delegates
+// name to a zone below zone.
+func referral(resp *dns.Msg, zone, name string) (string, []string, uint32) {
+	var child string
+	var nsNames []string
+	var ttl uint32
+
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(ns.Hdr.Name)
+		if !dns.IsSubDomain(owner, name) || dns.CountLabel(owner) <= dns.CountLabel(zone) ||
+			!dns.IsSubDomain(zone, owner) {
+			continue
+		}
+		if child != "" && owner != child {
+			continue
+		}
+
+		child = owner
+		nsNames = append(nsNames, strings.ToLower(ns.Ns))
+		if ttl == 0 || ns.Hdr.Ttl < ttl {
+			ttl = ns.Hdr.Ttl
+		}
+	}
+
+	return child, nsNames, ttl
+}
+
+// glue returns the addresses of nsNames found in the additional section,
+// ignoring records the delegating zone is not authoritative for.
+func (r *recursor) glue(resp *dns.Msg, zone string, nsNames []string) []string {
+	wanted := make(map[string]bool, len(nsNames))
+	for _, ns := range nsNames {
+		wanted[ns] = true
+	}
+
+	var servers []string
+	for _, rr := range resp.Extra {
+		owner := strings.ToLower(rr.Header().Name)
+		if !wanted[owner] || !dns.IsSubDomain(zone, owner) {
+			continue
+		}
+
+		switch rr := rr.(type) {
+		case *dns.A:
+			servers = append(servers, r.serverAddr(rr.A.String()))
+		case *dns.AAAA:
+			servers = append(servers, r.serverAddr(rr.AAAA.String()))
+		}
+	}
+
+	return servers
+}
+
+// lookupServers resolves the addresses of name servers that came without glue.
+func (r *recursor) lookupServers(ctx context.Context, nsNames []string, depth int) []string {
+	for _, ns := range nsNames {
+		resp, err := r.resolve(ctx, dns.Question{Name: ns, Qtype: dns.TypeA, Qclass: dns.ClassINET}, false, depth+1)
+		if err != nil {
+			continue
+		}
+
+		var servers []string
+		for _, rr := range resp.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				servers = append(servers, r.serverAddr(a.A.String()))
+			}
+		}
+		if len(servers) > 0 {
+			return servers
+		}
+	}
+
+	return nil
+}
+
+// inBailiwick returns the records of rrs owned by names within zone, the only
+// ones its servers are trusted with.
+func inBailiwick(rrs []dns.RR, zone string) []dns.RR {
+	var res []dns.RR
+	for _, rr := range rrs {
+		if dns.IsSubDomain(zone, rr.Header().Name) {
+			res = append(res, rr)
+		}
+	}
+
+	return res
+}
+
+// unresolvedCNAME follows the CNAME chain for name in answer and returns its
+// target when the answer has no records of qtype for it.
+func unresolvedCNAME(answer []dns.RR, name string, qtype uint16) (string, bool) {
+	if qtype == dns.TypeCNAME {
+		return "", false
+	}
+
+	target := name
+	for i := 0; i < maxCNAMEs; i++ {
+		next := ""
+		for _, rr := range answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, target) {
+				next = cname.Target
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		target = next
+	}
+
+	if strings.EqualFold(target, name) {
+		return "", false
+	}
+
+	for _, rr := range answer {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, target) {
+			return "", false
+		}
+	}
+
+	return target, true
+}
+
+// closestDelegation returns the deepest cached zone enclosing name, falling
+// back to the root hints.
+func (r *recursor) closestDelegation(name string) (string, []string) {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		zone := name[off:]
+		d, ok := r.delegations[zone]
+		if !ok {
+			continue
+		}
+		if now.After(d.expiresAt) {
+			delete(r.delegations, zone)
+			continue
+		}
+
+		return zone, d.servers
+	}
+
+	return ".", r.rootHints
+}
+
+// storeDelegation caches the servers of zone for ttl seconds. When the cache
+// is full the expired delegations are dropped, and then random ones if none
+// had expired.
+func (r *recursor) storeDelegation(zone string, servers []string, ttl uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.delegations[zone]; !ok && len(r.delegations) >= maxDelegations {
+		now := r.now()
+		for z, d := range r.delegations {
+			if now.After(d.expiresAt) {
+				delete(r.delegations, z)
+			}
+		}
+
+		for z := range r.delegations {
+			if len(r.delegations) < maxDelegations {
+				break
+			}
+			delete(r.delegations, z)
+		}
+	}
+
+	r.delegations[zone] = delegation{
+		servers:   servers,
+		expiresAt: r.now().Add(time.Duration(ttl) * time.Second),
+	}
+}
@@ -0,0 +1,354 @@
+package recursor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authServer is a minimal authoritative stand-in. Records of zones it is not
+// authoritative for act as delegations.
+type authServer struct {
+	zones   []string
+	records []dns.RR
+	// injected records are added to the answers to their owner's queries, as
+	// a malicious server would.
+	injected map[string][]dns.RR
+	hits     atomic.Int32
+}
+
+func mustRR(record string) dns.RR {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		panic(err)
+	}
+	return rr
+}
+
+func newAuthServer(zones []string, records ...string) *authServer {
+	s := &authServer{zones: zones}
+	for _, record := range records {
+		s.records = append(s.records, mustRR(record))
+	}
+	return s
+}
+
+func (s *authServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.hits.Add(1)
+
+	q := r.Question[0]
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	// Deepest delegation below our zones that encloses the query name. The DS
+	// records at a cut are answered by the parent.
+	var cut string
+	for _, rr := range s.records {
+		owner := rr.Header().Name
+		if q.Qtype == dns.TypeDS && owner == q.Name {
+			continue
+		}
+		if rr.Header().Rrtype == dns.TypeNS && !s.isApex(owner) && dns.IsSubDomain(owner, q.Name) &&
+			(cut == "" || dns.CountLabel(owner) > dns.CountLabel(cut)) {
+			cut = owner
+		}
+	}
+	if cut != "" {
+		for _, rr := range s.records {
+			if ns, ok := rr.(*dns.NS); ok && ns.Hdr.Name == cut {
+				m.Ns = append(m.Ns, ns)
+				for _, glue := range s.records {
+					if glue.Header().Name == ns.Ns && glue.Header().Rrtype == dns.TypeA {
+						m.Extra = append(m.Extra, glue)
+					}
+				}
+			}
+		}
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	m.Authoritative = true
+	m.Answer = append(m.Answer, s.injected[q.Name]...)
+	exists := false
+	for _, rr := range s.records {
+		if rr.Header().Name != q.Name {
+			continue
+		}
+		exists = true
+		if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	if len(m.Answer) == len(s.injected[q.Name]) {
+		if !exists {
+			m.Rcode = dns.RcodeNameError
+		}
+		for _, rr := range s.records {
+			if rr.Header().Rrtype == dns.TypeSOA && dns.IsSubDomain(rr.Header().Name, q.Name) {
+				m.Ns = append(m.Ns, rr)
+			}
+		}
+	}
+	_ = w.WriteMsg(m)
+}
+
+func (s *authServer) isApex(name string) bool {
+	for _, zone := range s.zones {
+		if zone == name {
+			return true
+		}
+	}
+	return false
+}
+
+func startAuthServer(t *testing.T, s *authServer) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dns.Server{PacketConn: pc, Handler: s}
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = srv.Shutdown()
+	})
+
+	return pc.LocalAddr().String()
+}
+
+type testHierarchy struct {
+	root, tld, auth *authServer
+	recursor        *recursor
+}
+
+// newTestHierarchy starts a root, a TLD server for com. and net. and an
+// authoritative server for example.com. and example.net. The glue addresses
+// are documentation addresses mapped to the local stand-ins.
+func newTestHierarchy(t *testing.T) *testHierarchy {
+	h := &testHierarchy{
+		root: newAuthServer([]string{"."},
+			". 86400 IN SOA a.root. admin.root. 1 1800 900 604800 86400",
+			"com. 172800 IN NS a.gtld.test.",
+			"net. 172800 IN NS a.gtld.test.",
+			"a.gtld.test. 172800 IN A 192.0.2.2",
+		),
+		tld: newAuthServer([]string{"com.", "net."},
+			"com. 900 IN SOA a.gtld.test. admin.gtld.test. 1 1800 900 604800 86400",
+			"net. 900 IN SOA a.gtld.test. admin.gtld.test. 1 1800 900 604800 86400",
+			// example.com. has no glue, its name server lives under example.net.
+			"example.com. 172800 IN NS ns1.example.net.",
+			"example.com. 86400 IN DS 12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF",
+			"example.net. 172800 IN NS ns1.example.net.",
+			"ns1.example.net. 172800 IN A 192.0.2.3",
+		),
+		auth: newAuthServer([]string{"example.com.", "example.net."},
+			"example.com. 3600 IN SOA ns1.example.net. admin.example.com. 1 7200 3600 1209600 300",
+			"example.net. 3600 IN SOA ns1.example.net. admin.example.net. 1 7200 3600 1209600 300",
+			"ns1.example.net. 3600 IN A 192.0.2.3",
+			"www.example.com. 300 IN A 10.0.0.1",
+			"mail.example.com. 300 IN A 10.0.0.2",
+			"alias.example.com. 300 IN CNAME www.example.com.",
+			"cross.example.com. 300 IN CNAME www.example.net.",
+			"www.example.net. 300 IN A 10.0.0.3",
+			"poisoned.example.com. 300 IN A 10.0.0.4",
+		),
+	}
+	h.auth.injected = map[string][]dns.RR{
+		"cross.example.com.":    {mustRR("www.example.net. 300 IN A 192.0.2.66")},
+		"poisoned.example.com.": {mustRR("www.example.org. 300 IN A 192.0.2.66")},
+	}
+
+	local := map[string]string{
+		"192.0.2.2": startAuthServer(t, h.tld),
+		"192.0.2.3": startAuthServer(t, h.auth),
+	}
+
+	r := New(Options{RootHints: []string{startAuthServer(t, h.root)}, Timeout: time.Second}).(*recursor)
+	r.serverAddr = func(ip string) string {
+		return local[ip]
+	}
+	h.recursor = r
+
+	return h
+}
+
+func query(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	return m
+}
+
+func TestRecursor_FollowsReferrals(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	req := query("www.example.com.", dns.TypeA)
+	resp, err := h.recursor.Exchange(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, req.Id, resp.Id)
+	assert.True(t, resp.RecursionAvailable)
+	assert.False(t, resp.Authoritative)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+}
+
+func TestRecursor_CachesDelegations(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	_, err := h.recursor.Exchange(context.Background(), query("www.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	rootHits, tldHits := h.root.hits.Load(), h.tld.hits.Load()
+
+	resp, err := h.recursor.Exchange(context.Background(), query("mail.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	require.Len(t, resp.Answer, 1)
+
+	assert.Equal(t, rootHits, h.root.hits.Load())
+	assert.Equal(t, tldHits, h.tld.hits.Load())
+}
+
+func TestRecursor_ExpiredDelegationsStartFromRoot(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	_, err := h.recursor.Exchange(context.Background(), query("www.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	rootHits := h.root.hits.Load()
+
+	h.recursor.now = func() time.Time { return time.Now().Add(73 * time.Hour) }
+
+	_, err = h.recursor.Exchange(context.Background(), query("www.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	assert.Greater(t, h.root.hits.Load(), rootHits)
+}
+
+func TestRecursor_DelegationsAreBounded(t *testing.T) {
+	r := New(Options{}).(*recursor)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < maxDelegations; i++ {
+		r.storeDelegation(fmt.Sprintf("zone%d.example.", i), []string{"192.0.2.1:53"}, uint32(i%2*3600))
+	}
+	assert.Len(t, r.delegations, maxDelegations)
+
+	// Expired delegations go first.
+	now = now.Add(time.Second)
+	r.storeDelegation("new.example.", []string{"192.0.2.1:53"}, 3600)
+	assert.Len(t, r.delegations, maxDelegations/2+1)
+	assert.Contains(t, r.delegations, "zone1.example.")
+	assert.NotContains(t, r.delegations, "zone0.example.")
+
+	// Then any, when none expired.
+	for i := 0; len(r.delegations) < maxDelegations; i++ {
+		r.storeDelegation(fmt.Sprintf("more%d.example.", i), []string{"192.0.2.1:53"}, 3600)
+	}
+	r.storeDelegation("last.example.", []string{"192.0.2.1:53"}, 3600)
+	assert.Len(t, r.delegations, maxDelegations)
+	assert.Contains(t, r.delegations, "last.example.")
+}
+
+func TestRecursor_ChasesCNAME(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	resp, err := h.recursor.Exchange(context.Background(), query("alias.example.com.", dns.TypeA))
+	require.NoError(t, err)
+
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "www.example.com.", resp.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "10.0.0.1", resp.Answer[1].(*dns.A).A.String())
+}
+
+func TestRecursor_DropsOutOfBailiwickRecords(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	// The CNAME target is resolved from its own zone instead.
+	resp, err := h.recursor.Exchange(context.Background(), query("cross.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "www.example.net.", resp.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "10.0.0.3", resp.Answer[1].(*dns.A).A.String())
+
+	resp, err = h.recursor.Exchange(context.Background(), query("poisoned.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.4", resp.Answer[0].(*dns.A).A.String())
+}
+
+func TestRecursor_NegativeAnswers(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	resp, err := h.recursor.Exchange(context.Background(), query("missing.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, dns.TypeSOA, resp.Ns[0].Header().Rrtype)
+
+	resp, err = h.recursor.Exchange(context.Background(), query("www.example.com.", dns.TypeAAAA))
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	require.Len(t, resp.Ns, 1)
+}
+
+func TestRecursor_PreservesEDNS0(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	req := query("www.example.com.", dns.TypeA)
+	req.SetEdns0(1232, true)
+
+	resp, err := h.recursor.Exchange(context.Background(), req)
+	require.NoError(t, err)
+
+	opt := resp.IsEdns0()
+	require.NotNil(t, opt)
+	assert.Equal(t, uint16(1232), opt.UDPSize())
+	assert.True(t, opt.Do())
+}
+
+func TestRecursor_UnreachableRoot(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	r := New(Options{RootHints: []string{pc.LocalAddr().String()}, Timeout: 100 * time.Millisecond})
+
+	_, err = r.Exchange(context.Background(), query("www.example.com.", dns.TypeA))
+	assert.ErrorIs(t, err, ErrNoServers)
+}
+
+func TestNew_RootHints(t *testing.T) {
+	r := New(Options{}).(*recursor)
+	assert.Len(t, r.rootHints, len(DefaultRootHints))
+	assert.True(t, strings.HasSuffix(r.rootHints[0], ":53"))
+
+	r = New(Options{RootHints: []string{"192.0.2.1", "192.0.2.2:5353", "2001:db8::1"}}).(*recursor)
+	assert.Equal(t, []string{"192.0.2.1:53", "192.0.2.2:5353", "[2001:db8::1]:53"}, r.rootHints)
+}
+
+func TestRecursor_AsksParentForDS(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	// Warm the delegation cache so example.com. is known.
+	_, err := h.recursor.Exchange(context.Background(), query("www.example.com.", dns.TypeA))
+	require.NoError(t, err)
+	authHits := h.auth.hits.Load()
+
+	resp, err := h.recursor.Exchange(context.Background(), query("example.com.", dns.TypeDS))
+	require.NoError(t, err)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, dns.TypeDS, resp.Answer[0].Header().Rrtype)
+	assert.Equal(t, authHits, h.auth.hits.Load())
+}
@@ -0,0 +1,123 @@
+package rpz
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Action is what a policy does to the queries it matches.
+type Action int
+
+const (
+	ActionNXDomain Action = iota + 1
+	ActionNoData
+	ActionPassthru
+	ActionDrop
+	// ActionLocalData answers with the records of the policy. A CNAME
+	// record rewrites the query to its target.
+	ActionLocalData
+)
+
+var ErrUnsupportedPolicy = fmt.Errorf("unsupported rpz policy")
+
+func (a Action) String() string {
+	switch a {
+	case ActionNXDomain:
+		return "NXDOMAIN"
+	case ActionNoData:
+		return "NODATA"
+	case ActionPassthru:
+		return "PASSTHRU"
+	case ActionDrop:
+		return "DROP"
+	case ActionLocalData:
+		return "local-data"
+	}
+
+	return "unknown"
+}
+
+// Policy is what a zone prescribes for the names matching its trigger.
+type Policy struct {
+	// Zone is the name of the RPZ zone holding the policy.
+	Zone string
+	// Trigger is the owner name of the policy relative to the zone, like
+	// ads.example.com or *.ads.example.com.
+	Trigger string
+	Action  Action
+	TTL     uint32
+	// Records are the local data of the policy.
+	Records []dns.RR
+
+	wildcard bool
+	// name is the normalized trigger without its wildcard label.
+	name string
+}
+
+// newPolicy builds the policy of trigger from the records the zone has for
+// it, following the action encoding of the RPZ specification.
+func newPolicy(zone, trigger string, rrs []dns.RR) (*Policy, error) {
+	p := &Policy{
+		Zone:     zone,
+		Trigger:  trigger,
+		Action:   ActionLocalData,
+		TTL:      rrs[0].Header().Ttl,
+		Records:  rrs,
+		wildcard: strings.HasPrefix(trigger, "*."),
+		name:     strings.TrimPrefix(trigger, "*."),
+	}
+
+	cname, ok := rrs[0].(*dns.CNAME)
+	if !ok {
+		return p, nil
+	}
+
+	if len(rrs) > 1 {
+		return nil, fmt.Errorf("%w: %s has a CNAME and other data", ErrUnsupportedPolicy, trigger)
+	}
+
+	switch target := strings.ToLower(cname.Target); {
+	case target == ".":
+		p.Action = ActionNXDomain
+	case target == "*.":
+		p.Action = ActionNoData
+	case target == "rpz-passthru.":
+		p.Action = ActionPassthru
+	case target == "rpz-drop.":
+		p.Action = ActionDrop
+	case strings.HasPrefix(target, "rpz-") || strings.HasPrefix(target, "*."):
+		return nil, fmt.Errorf("%w: %s CNAME %s", ErrUnsupportedPolicy, trigger, target)
+	}
+
+	if p.Action != ActionLocalData {
+		p.Records = nil
+	}
+
+	return p, nil
+}
+
+// matches reports whether the policy applies to the normalized name, which
+// is known to fall under its trigger. Wildcards only cover subdomains.
+func (p *Policy) matches(name string) bool {
+	return !p.wildcard || name != p.name
+}
+
+// Answer returns the local data answering a query for qname and qtype: the
+// records of that type, or the CNAME rewriting the query, owned by qname.
+func (p *Policy) Answer(qname string, qtype uint16) []dns.RR {
+	var res []dns.RR
+	for _, rr := range p.Records {
+		rrtype := rr.Header().Rrtype
+		if rrtype != qtype && rrtype != dns.TypeCNAME && qtype != dns.TypeANY {
+			continue
+		}
+
+		rr = dns.Copy(rr)
+		rr.Header().Name = qname
+		res = append(res, rr)
+	}
+
+	return res
+}
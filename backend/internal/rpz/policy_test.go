@@ -0,0 +1,83 @@
+package rpz
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		want    Action
+		wantErr bool
+	}{
+		{name: "nxdomain", record: "ads.example.com.rpz. 60 CNAME .", want: ActionNXDomain},
+		{name: "nodata", record: "ads.example.com.rpz. 60 CNAME *.", want: ActionNoData},
+		{name: "passthru", record: "ads.example.com.rpz. 60 CNAME rpz-passthru.", want: ActionPassthru},
+		{name: "drop", record: "ads.example.com.rpz. 60 CNAME rpz-drop.", want: ActionDrop},
+		{name: "rewrite", record: "ads.example.com.rpz. 60 CNAME walled.garden.", want: ActionLocalData},
+		{name: "local data", record: "ads.example.com.rpz. 60 A 10.0.0.1", want: ActionLocalData},
+		{name: "tcp-only", record: "ads.example.com.rpz. 60 CNAME rpz-tcp-only.", wantErr: true},
+		{name: "wildcard target", record: "ads.example.com.rpz. 60 CNAME *.walled.garden.", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPolicy("rpz.", "ads.example.com", []dns.RR{mustRR(t, tt.record)})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnsupportedPolicy)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p.Action)
+			assert.Equal(t, uint32(60), p.TTL)
+			assert.Equal(t, tt.want == ActionLocalData, len(p.Records) == 1)
+		})
+	}
+}
+
+func TestNewPolicy_CNAMEAndOtherData(t *testing.T) {
+	_, err := newPolicy("rpz.", "ads.example.com", []dns.RR{
+		mustRR(t, "ads.example.com.rpz. CNAME ."),
+		mustRR(t, "ads.example.com.rpz. A 10.0.0.1"),
+	})
+	assert.ErrorIs(t, err, ErrUnsupportedPolicy)
+}
+
+func TestPolicy_Answer(t *testing.T) {
+	p, err := newPolicy("rpz.", "ads.example.com", []dns.RR{
+		mustRR(t, "ads.example.com.rpz. 60 A 10.0.0.1"),
+		mustRR(t, "ads.example.com.rpz. 60 AAAA ::1"),
+	})
+	require.NoError(t, err)
+
+	answer := p.Answer("ads.example.com.", dns.TypeA)
+	require.Len(t, answer, 1)
+	assert.Equal(t, "ads.example.com.", answer[0].Header().Name)
+	assert.Equal(t, "10.0.0.1", answer[0].(*dns.A).A.String())
+	assert.Equal(t, "ads.example.com.rpz.", p.Records[0].Header().Name)
+
+	assert.Empty(t, p.Answer("ads.example.com.", dns.TypeMX))
+	assert.Len(t, p.Answer("ads.example.com.", dns.TypeANY), 2)
+
+	rewrite, err := newPolicy("rpz.", "*.example.com", []dns.RR{
+		mustRR(t, "*.example.com.rpz. 60 CNAME walled.garden."),
+	})
+	require.NoError(t, err)
+
+	answer = rewrite.Answer("www.example.com.", dns.TypeMX)
+	require.Len(t, answer, 1)
+	assert.Equal(t, "walled.garden.", answer[0].(*dns.CNAME).Target)
+}
@@ -0,0 +1,128 @@
+package rpz
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+const (
+	defaultRefresh = time.Hour
+	defaultPort    = "53"
+)
+
+var ErrInvalidZone = fmt.Errorf("invalid rpz zone")
+
+type ZoneOptions struct {
+	Name string
+	// Primary is the host:port the zone is transferred from with AXFR and
+	// then IXFR. Exactly one of Primary and File must be set.
+	Primary string
+	// File is a zone file, reloaded when it changes.
+	File string
+	// Refresh is how often the zone is checked for updates, on top of the
+	// NOTIFY messages sent by the primary.
+	Refresh time.Duration
+	// TSIGKey and TSIGSecret sign transfers with HMAC-SHA256 when set.
+	TSIGKey    string
+	TSIGSecret string
+}
+
+type Options struct {
+	// Zones are consulted in order, the first one with a matching policy
+	// wins.
+	Zones []ZoneOptions
+}
+
+type RPZ interface {
+	// Match returns the policy for the query name, if any.
+	Match(name string) (*Policy, bool)
+	// Notify schedules a refresh of zone when from is its primary, and
+	// reports whether the NOTIFY was accepted.
+	Notify(zone string, from net.IP) bool
+	Start()
+	Stop()
+}
+
+type rpz struct {
+	zones []*zone
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(opts Options) (RPZ, error) {
+	r := &rpz{stop: make(chan struct{})}
+	for _, zo := range opts.Zones {
+		if zo.Name == "" || (zo.Primary == "") == (zo.File == "") {
+			return nil, fmt.Errorf("%w: %q needs either a primary or a file", ErrInvalidZone, zo.Name)
+		}
+
+		zo.Name = dns.CanonicalName(zo.Name)
+		if zo.Refresh == 0 {
+			zo.Refresh = defaultRefresh
+		}
+		if zo.Primary != "" {
+			if _, _, err := net.SplitHostPort(zo.Primary); err != nil {
+				zo.Primary = net.JoinHostPort(zo.Primary, defaultPort)
+			}
+		}
+
+		r.zones = append(r.zones, newZone(zo))
+	}
+
+	return r, nil
+}
+
+func (r *rpz) Match(name string) (*Policy, bool) {
+	name = matcher.Normalize(name)
+	for _, z := range r.zones {
+		if p, ok := z.match(name); ok {
+			return p, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *rpz) Notify(name string, from net.IP) bool {
+	name = dns.CanonicalName(name)
+	for _, z := range r.zones {
+		if z.opts.Name != name || z.opts.Primary == "" {
+			continue
+		}
+
+		host, _, _ := net.SplitHostPort(z.opts.Primary)
+		if ip := net.ParseIP(host); ip == nil || !ip.Equal(from) {
+			return false
+		}
+
+		select {
+		case z.notify <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	return false
+}
+
+func (r *rpz) Start() {
+	for _, z := range r.zones {
+		r.wg.Add(1)
+		go func(z *zone) {
+			defer r.wg.Done()
+			z.run(r.stop)
+		}(z)
+	}
+}
+
+func (r *rpz) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
@@ -0,0 +1,312 @@
+package rpz
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testZone = `$ORIGIN rpz.example.
+$TTL 300
+@                       SOA ns.rpz.example. admin.rpz.example. 1 3600 600 86400 60
+@                       NS  ns.rpz.example.
+ads.example.com         CNAME .
+*.ads.example.com       CNAME .
+tracker.example.net     CNAME *.
+ok.ads.example.com      CNAME rpz-passthru.
+32.1.0.0.10.rpz-ip      CNAME .
+`
+
+func writeZone(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rpz.zone")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestNew_InvalidZone(t *testing.T) {
+	tests := []ZoneOptions{
+		{Name: "rpz.example"},
+		{Name: "rpz.example", Primary: "10.0.0.1", File: "rpz.zone"},
+		{Primary: "10.0.0.1"},
+	}
+
+	for _, zo := range tests {
+		_, err := New(Options{Zones: []ZoneOptions{zo}})
+		assert.ErrorIs(t, err, ErrInvalidZone)
+	}
+}
+
+func TestNew_Defaults(t *testing.T) {
+	r, err := New(Options{Zones: []ZoneOptions{{Name: "RPZ.Example", Primary: "10.0.0.1"}}})
+	require.NoError(t, err)
+
+	z := r.(*rpz).zones[0]
+	assert.Equal(t, "rpz.example.", z.opts.Name)
+	assert.Equal(t, "10.0.0.1:53", z.opts.Primary)
+	assert.Equal(t, defaultRefresh, z.opts.Refresh)
+}
+
+func TestRPZ_Match(t *testing.T) {
+	r, err := New(Options{Zones: []ZoneOptions{{Name: "rpz.example", File: writeZone(t, testZone)}}})
+	require.NoError(t, err)
+	require.NoError(t, r.(*rpz).zones[0].refresh())
+
+	tests := []struct {
+		name string
+		want Action
+	}{
+		{name: "ads.example.com.", want: ActionNXDomain},
+		{name: "ADS.Example.com", want: ActionNXDomain},
+		{name: "www.ads.example.com.", want: ActionNXDomain},
+		{name: "ok.ads.example.com.", want: ActionPassthru},
+		{name: "tracker.example.net.", want: ActionNoData},
+		{name: "www.tracker.example.net.", want: 0},
+		{name: "example.com.", want: 0},
+		{name: "notads.example.com.", want: 0},
+		{name: "32.1.0.0.10.rpz-ip.", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := r.Match(tt.name)
+			if tt.want == 0 {
+				assert.False(t, ok)
+				return
+			}
+
+			require.True(t, ok)
+			assert.Equal(t, tt.want, p.Action)
+			assert.Equal(t, "rpz.example.", p.Zone)
+		})
+	}
+}
+
+func TestRPZ_Match_FirstZoneWins(t *testing.T) {
+	passthru := `$ORIGIN allow.example.
+$TTL 300
+@               SOA ns.allow.example. admin.allow.example. 1 3600 600 86400 60
+ads.example.com CNAME rpz-passthru.
+`
+	r, err := New(Options{Zones: []ZoneOptions{
+		{Name: "allow.example", File: writeZone(t, passthru)},
+		{Name: "rpz.example", File: writeZone(t, testZone)},
+	}})
+	require.NoError(t, err)
+	for _, z := range r.(*rpz).zones {
+		require.NoError(t, z.refresh())
+	}
+
+	p, ok := r.Match("ads.example.com.")
+	require.True(t, ok)
+	assert.Equal(t, ActionPassthru, p.Action)
+
+	p, ok = r.Match("www.ads.example.com.")
+	require.True(t, ok)
+	assert.Equal(t, ActionNXDomain, p.Action)
+}
+
+func TestZone_Load_ReloadsOnChange(t *testing.T) {
+	path := writeZone(t, testZone)
+	z := newZone(ZoneOptions{Name: "rpz.example.", File: path})
+	require.NoError(t, z.refresh())
+
+	_, ok := z.match("other.example.org")
+	assert.False(t, ok)
+
+	updated := testZone + "other.example.org CNAME .\n"
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	require.NoError(t, z.refresh())
+
+	_, ok = z.match("other.example.org")
+	assert.True(t, ok)
+
+	// Changes keeping the mtime are loaded when the size differs.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(testZone), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), info.ModTime()))
+	require.NoError(t, z.refresh())
+
+	_, ok = z.match("other.example.org")
+	assert.False(t, ok)
+}
+
+func TestZone_Load_MissingSOA(t *testing.T) {
+	z := newZone(ZoneOptions{Name: "rpz.example.", File: writeZone(t, "ads.example.com.rpz.example. 300 CNAME .\n")})
+	assert.ErrorIs(t, z.refresh(), ErrBadTransfer)
+}
+
+func TestZone_Apply(t *testing.T) {
+	soa := func(serial int) dns.RR {
+		return mustRR(t, fmt.Sprintf("rpz.example. SOA ns.rpz.example. admin.rpz.example. %d 3600 600 86400 60",
+			serial))
+	}
+	z := newZone(ZoneOptions{Name: "rpz.example."})
+
+	// Full transfer.
+	require.NoError(t, z.apply([]dns.RR{
+		soa(1),
+		mustRR(t, "ads.example.com.rpz.example. CNAME ."),
+		mustRR(t, "tracker.example.net.rpz.example. CNAME ."),
+		soa(1),
+	}))
+	_, ok := z.match("ads.example.com")
+	assert.True(t, ok)
+
+	// Up to date.
+	require.NoError(t, z.apply([]dns.RR{soa(1)}))
+	assert.Equal(t, uint32(1), z.soa.Serial)
+
+	// Incremental transfer from 1 to 3, through 2.
+	require.NoError(t, z.apply([]dns.RR{
+		soa(3),
+		soa(1),
+		mustRR(t, "ads.example.com.rpz.example. CNAME ."),
+		soa(2),
+		mustRR(t, "ads.example.org.rpz.example. CNAME ."),
+		soa(2),
+		soa(3),
+		mustRR(t, "tracker.example.net.rpz.example. 60 CNAME rpz-passthru."),
+		soa(3),
+	}))
+	assert.Equal(t, uint32(3), z.soa.Serial)
+
+	_, ok = z.match("ads.example.com")
+	assert.False(t, ok)
+	_, ok = z.match("ads.example.org")
+	assert.True(t, ok)
+
+	// tracker.example.net now has two CNAMEs and is skipped.
+	_, ok = z.match("tracker.example.net")
+	assert.False(t, ok)
+
+	// Incremental transfers from another serial are discarded.
+	err := z.apply([]dns.RR{
+		soa(5),
+		soa(4),
+		mustRR(t, "ads.example.org.rpz.example. CNAME ."),
+		soa(5),
+		soa(5),
+	})
+	assert.ErrorIs(t, err, ErrSerialMismatch)
+	assert.Equal(t, uint32(3), z.soa.Serial)
+	_, ok = z.match("ads.example.org")
+	assert.True(t, ok)
+
+	assert.ErrorIs(t, z.apply(nil), ErrBadTransfer)
+	assert.ErrorIs(t, z.apply([]dns.RR{soa(4), mustRR(t, "a.rpz.example. CNAME .")}), ErrBadTransfer)
+}
+
+// startPrimary serves the zone over TCP, as a full transfer for AXFR and as
+// the incremental records for IXFR.
+func startPrimary(t *testing.T, axfr, ixfr func() []dns.RR) (string, *sync.Map) {
+	t.Helper()
+
+	var queries sync.Map
+	mux := dns.NewServeMux()
+	mux.HandleFunc("rpz.example.", func(w dns.ResponseWriter, req *dns.Msg) {
+		qtype := req.Question[0].Qtype
+		queries.Store(qtype, true)
+
+		rrs := axfr()
+		if qtype == dns.TypeIXFR {
+			rrs = ixfr()
+		}
+
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: rrs}
+		close(ch)
+		_ = new(dns.Transfer).Out(w, req, ch)
+		w.Hijack()
+		_ = w.Close()
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	srv := &dns.Server{Listener: l, Net: "tcp", Handler: mux, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return l.Addr().String(), &queries
+}
+
+func TestRPZ_Transfer(t *testing.T) {
+	soa1 := mustRR(t, "rpz.example. SOA ns.rpz.example. admin.rpz.example. 1 3600 600 86400 60")
+	soa2 := mustRR(t, "rpz.example. SOA ns.rpz.example. admin.rpz.example. 2 3600 600 86400 60")
+	ads := mustRR(t, "ads.example.com.rpz.example. CNAME .")
+	tracker := mustRR(t, "tracker.example.net.rpz.example. CNAME *.")
+
+	addr, queries := startPrimary(t,
+		func() []dns.RR { return []dns.RR{soa1, ads, soa1} },
+		func() []dns.RR { return []dns.RR{soa2, soa1, soa2, tracker, soa2} },
+	)
+
+	r, err := New(Options{Zones: []ZoneOptions{{Name: "rpz.example", Primary: addr, Refresh: time.Hour}}})
+	require.NoError(t, err)
+	r.Start()
+	defer r.Stop()
+
+	assert.Eventually(t, func() bool {
+		_, ok := r.Match("ads.example.com")
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok := queries.Load(dns.TypeAXFR)
+	assert.True(t, ok)
+
+	assert.False(t, r.Notify("rpz.example.", net.ParseIP("10.0.0.1")))
+	assert.False(t, r.Notify("other.example.", net.ParseIP("127.0.0.1")))
+	assert.True(t, r.Notify("RPZ.example.", net.ParseIP("127.0.0.1")))
+
+	assert.Eventually(t, func() bool {
+		p, ok := r.Match("tracker.example.net")
+		return ok && p.Action == ActionNoData
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok = queries.Load(dns.TypeIXFR)
+	assert.True(t, ok)
+
+	_, ok = r.Match("ads.example.com")
+	assert.True(t, ok)
+}
+
+func TestZone_Transfer_SerialMismatch(t *testing.T) {
+	soa := func(serial int) dns.RR {
+		return mustRR(t, fmt.Sprintf("rpz.example. SOA ns.rpz.example. admin.rpz.example. %d 3600 600 86400 60",
+			serial))
+	}
+	ads := mustRR(t, "ads.example.com.rpz.example. CNAME .")
+	tracker := mustRR(t, "tracker.example.net.rpz.example. CNAME .")
+
+	addr, queries := startPrimary(t,
+		func() []dns.RR { return []dns.RR{soa(6), tracker, soa(6)} },
+		func() []dns.RR { return []dns.RR{soa(6), soa(5), soa(6), tracker, soa(6)} },
+	)
+
+	z := newZone(ZoneOptions{Name: "rpz.example.", Primary: addr})
+	require.NoError(t, z.apply([]dns.RR{soa(1), ads, soa(1)}))
+
+	require.NoError(t, z.refresh())
+	assert.Equal(t, uint32(6), z.soa.Serial)
+	_, ok := queries.Load(dns.TypeIXFR)
+	assert.True(t, ok)
+	_, ok = queries.Load(dns.TypeAXFR)
+	assert.True(t, ok)
+
+	// The full transfer replaced the zone.
+	_, ok = z.match("ads.example.com")
+	assert.False(t, ok)
+	_, ok = z.match("tracker.example.net")
+	assert.True(t, ok)
+}
@@ -0,0 +1,323 @@
+package rpz
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+const transferTimeout = 30 * time.Second
+
+var (
+	ErrBadTransfer    = fmt.Errorf("bad zone transfer")
+	ErrSerialMismatch = fmt.Errorf("incremental transfer from another serial")
+)
+
+type zone struct {
+	opts ZoneOptions
+
+	// mu serializes refreshes, lookups only read policies.
+	mu      sync.Mutex
+	soa     *dns.SOA
+	records map[string]dns.RR
+	// modTime and size are those of the file the loaded copy came from.
+	modTime  time.Time
+	size     int64
+	policies atomic.Pointer[matcher.Trie[*Policy]]
+
+	notify chan struct{}
+}
+
+func newZone(opts ZoneOptions) *zone {
+	return &zone{opts: opts, notify: make(chan struct{}, 1)}
+}
+
+// run keeps the zone up to date until stop is closed, refreshing it every
+// Refresh interval or when the primary sends a NOTIFY.
+func (z *zone) run(stop <-chan struct{}) {
+	for {
+		wait := z.opts.Refresh
+		if err := z.refresh(); err != nil {
+			log.Printf("Failed to refresh rpz zone %s: %s\n", z.opts.Name, err.Error())
+			wait = min(wait, time.Minute)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-z.notify:
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (z *zone) refresh() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.opts.File != "" {
+		return z.load()
+	}
+
+	return z.transfer()
+}
+
+// load reads the zone file when its modification time or size differ from
+// the loaded copy's, so changes within the mtime granularity are loaded too.
+func (z *zone) load() error {
+	info, err := os.Stat(z.opts.File)
+	if err != nil {
+		return err
+	}
+
+	if z.soa != nil && info.ModTime().Equal(z.modTime) && info.Size() == z.size {
+		return nil
+	}
+
+	f, err := os.Open(z.opts.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rrs []dns.RR
+	zp := dns.NewZoneParser(f, z.opts.Name, z.opts.File)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return err
+	}
+
+	soa, ok := findSOA(rrs, z.opts.Name)
+	if !ok {
+		return fmt.Errorf("%w: %s has no SOA record", ErrBadTransfer, z.opts.File)
+	}
+
+	z.replace(soa, rrs)
+	z.modTime = info.ModTime()
+	z.size = info.Size()
+	return nil
+}
+
+// transfer fetches the zone from its primary, incrementally once a copy
+// of the zone is loaded. Incremental transfers that do not start from the
+// serial held are discarded for a full one.
+func (z *zone) transfer() error {
+	err := z.fetch(z.soa != nil)
+	if errors.Is(err, ErrSerialMismatch) {
+		log.Printf("Rpz zone %s: %s, falling back to AXFR\n", z.opts.Name, err.Error())
+		return z.fetch(false)
+	}
+
+	return err
+}
+
+func (z *zone) fetch(incremental bool) error {
+	m := new(dns.Msg)
+	if !incremental {
+		m.SetAxfr(z.opts.Name)
+	} else {
+		m.SetIxfr(z.opts.Name, z.soa.Serial, z.soa.Ns, z.soa.Mbox)
+	}
+
+	t := &dns.Transfer{DialTimeout: transferTimeout, ReadTimeout: transferTimeout}
+	if z.opts.TSIGKey != "" {
+		key := dns.Fqdn(z.opts.TSIGKey)
+		m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+		t.TsigSecret = map[string]string{key: z.opts.TSIGSecret}
+	}
+
+	env, err := t.In(m, z.opts.Primary)
+	if err != nil {
+		return err
+	}
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			return e.Error
+		}
+		rrs = append(rrs, e.RR...)
+	}
+
+	return z.apply(rrs)
+}
+
+// apply updates the zone from the records of a transfer: a single SOA when
+// the zone is current, the whole zone between two SOAs, or the IXFR
+// sequences of deletions and additions between SOAs (RFC 1995, section 4).
+// The sequences must go from the serial held to the new one, one after the
+// other, or the zone is left as it was.
+func (z *zone) apply(rrs []dns.RR) error {
+	if len(rrs) == 0 {
+		return fmt.Errorf("%w: empty response", ErrBadTransfer)
+	}
+
+	soa, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return fmt.Errorf("%w: first record is not a SOA", ErrBadTransfer)
+	}
+
+	if len(rrs) == 1 {
+		return nil
+	}
+
+	last, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok || last.Serial != soa.Serial {
+		return fmt.Errorf("%w: truncated transfer", ErrBadTransfer)
+	}
+
+	body := rrs[1 : len(rrs)-1]
+	if len(body) == 0 || !isSOA(body[0]) || z.soa == nil {
+		z.replace(soa, append([]dns.RR{soa}, body...))
+		return nil
+	}
+
+	records := make(map[string]dns.RR, len(z.records))
+	for k, rr := range z.records {
+		records[k] = rr
+	}
+
+	serial := z.soa.Serial
+	adding := true
+	for _, rr := range body {
+		if s, ok := rr.(*dns.SOA); ok {
+			adding = !adding
+			if !adding && s.Serial != serial {
+				return fmt.Errorf("%w: %d, holding %d", ErrSerialMismatch, s.Serial, serial)
+			}
+			serial = s.Serial
+			continue
+		}
+
+		if adding {
+			records[recordKey(rr)] = rr
+		} else {
+			delete(records, recordKey(rr))
+		}
+	}
+
+	if serial != soa.Serial {
+		return fmt.Errorf("%w: ends at %d instead of %d", ErrBadTransfer, serial, soa.Serial)
+	}
+
+	z.soa = soa
+	z.records = records
+	z.build()
+	return nil
+}
+
+func (z *zone) replace(soa *dns.SOA, rrs []dns.RR) {
+	records := make(map[string]dns.RR, len(rrs))
+	for _, rr := range rrs {
+		if !isSOA(rr) {
+			records[recordKey(rr)] = rr
+		}
+	}
+
+	z.soa = soa
+	z.records = records
+	z.build()
+}
+
+// build indexes the policies of the zone by trigger, wildcard triggers as
+// subtree rules. Triggers on IP addresses or name servers are skipped, only
+// QNAME triggers are supported.
+func (z *zone) build() {
+	suffix := "." + z.opts.Name
+	byTrigger := make(map[string][]dns.RR)
+	for _, rr := range z.records {
+		owner := strings.ToLower(rr.Header().Name)
+		if !strings.HasSuffix(owner, suffix) {
+			continue
+		}
+
+		trigger := strings.TrimSuffix(owner, suffix)
+		byTrigger[trigger] = append(byTrigger[trigger], rr)
+	}
+
+	policies := matcher.New[*Policy]()
+	skipped := 0
+	for trigger, rrs := range byTrigger {
+		if isSpecialTrigger(trigger) {
+			skipped++
+			continue
+		}
+
+		p, err := newPolicy(z.opts.Name, trigger, rrs)
+		if err != nil {
+			log.Printf("Skipping rpz policy in %s: %s\n", z.opts.Name, err.Error())
+			skipped++
+			continue
+		}
+		policies.Insert(p.name, p.wildcard, p)
+	}
+
+	log.Printf("Loaded rpz zone %s serial %d with %d policies, %d skipped\n", z.opts.Name, z.soa.Serial,
+		policies.Len(), skipped)
+	z.policies.Store(policies)
+}
+
+// match returns the policy for the normalized name, exact triggers taking
+// precedence over wildcards.
+func (z *zone) match(name string) (*Policy, bool) {
+	policies := z.policies.Load()
+	if policies == nil {
+		return nil, false
+	}
+
+	var res *Policy
+	policies.Walk(name, func(p *Policy) bool {
+		if p.matches(name) {
+			res = p
+			return false
+		}
+		return true
+	})
+
+	return res, res != nil
+}
+
+// isSpecialTrigger reports whether trigger matches on something other than
+// the query name, like rpz-ip or rpz-nsdname triggers.
+func isSpecialTrigger(trigger string) bool {
+	for _, label := range dns.SplitDomainName(trigger) {
+		if strings.HasPrefix(label, "rpz-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSOA(rr dns.RR) bool {
+	return rr.Header().Rrtype == dns.TypeSOA
+}
+
+func findSOA(rrs []dns.RR, name string) (*dns.SOA, bool) {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, name) {
+			return soa, true
+		}
+	}
+
+	return nil, false
+}
+
+// recordKey identifies a record regardless of its TTL and name case.
+func recordKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	rr.Header().Ttl = 0
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+	return rr.String()
+}
@@ -0,0 +1,155 @@
+package schedules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/orion-tec/oriondns/db"
+)
+
+var (
+	ErrNotFound  = fmt.Errorf("not found")
+	ErrNameTaken = fmt.Errorf("name already in use")
+	ErrInUse     = fmt.Errorf("schedule in use")
+)
+
+type schedulesDB struct {
+	db *db.DB
+}
+
+type DB interface {
+	Insert(ctx context.Context, schedule Schedule) (int64, error)
+	GetAll(ctx context.Context) ([]Schedule, error)
+	Update(ctx context.Context, schedule Schedule) error
+	Delete(ctx context.Context, id int64) error
+}
+
+func New(db *db.DB) DB {
+	return &schedulesDB{db}
+}
+
+func (s *schedulesDB) Insert(ctx context.Context, schedule Schedule) (int64, error) {
+	schedule = withDefaults(schedule)
+
+	var id int64
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO schedules (name, timezone, days, windows)
+			VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, schedule.Name, schedule.Timezone, schedule.Days, schedule.Windows).Scan(&id)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return id, nil
+}
+
+func (s *schedulesDB) GetAll(ctx context.Context) ([]Schedule, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, timezone, days, windows, created_at, updated_at, deleted_at
+		FROM schedules
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := pgx.CollectRows(rows, pgx.RowToStructByName[Schedule])
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (s *schedulesDB) Update(ctx context.Context, schedule Schedule) error {
+	schedule = withDefaults(schedule)
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE schedules
+		SET name = $2, timezone = $3, days = $4, windows = $5, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, schedule.ID, schedule.Name, schedule.Timezone, schedule.Days, schedule.Windows)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete soft deletes a schedule. Schedules still attached to rules,
+// category policies or groups are kept and ErrInUse is returned.
+func (s *schedulesDB) Delete(ctx context.Context, id int64) error {
+	var found, inUse bool
+	err := s.db.QueryRow(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM schedules WHERE id = $1 AND deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM blocked_domains WHERE schedule_id = $1 AND deleted_at IS NULL)
+				OR EXISTS (SELECT 1 FROM category_policies WHERE schedule_id = $1)
+				OR EXISTS (SELECT 1 FROM client_groups WHERE schedule_id = $1 AND deleted_at IS NULL)
+	`, id).Scan(&found, &inUse)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !found:
+		return ErrNotFound
+	case inUse:
+		return ErrInUse
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE schedules
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func withDefaults(schedule Schedule) Schedule {
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if schedule.Days == nil {
+		schedule.Days = []string{}
+	}
+	if schedule.Windows == nil {
+		schedule.Windows = []string{}
+	}
+
+	return schedule
+}
+
+// mapError maps unique violations on the name to ErrNameTaken and foreign
+// key violations to ErrInUse.
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			return ErrNameTaken
+		case "23503":
+			return ErrInUse
+		}
+	}
+
+	return err
+}
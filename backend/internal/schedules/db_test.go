@@ -0,0 +1,65 @@
+package schedules
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/testutil"
+)
+
+func TestSchedulesDB(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	schedulesDB := New(database)
+
+	ctx := context.Background()
+
+	id, err := schedulesDB.Insert(ctx, Schedule{Name: "school", Days: []string{"mon"}})
+	require.NoError(t, err)
+
+	_, err = schedulesDB.Insert(ctx, Schedule{Name: "school"})
+	assert.ErrorIs(t, err, ErrNameTaken)
+
+	err = schedulesDB.Update(ctx, Schedule{
+		ID:       id,
+		Name:     "school",
+		Timezone: "America/Sao_Paulo",
+		Days:     []string{"mon", "tue"},
+		Windows:  []string{"08:00-15:00"},
+	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, schedulesDB.Update(ctx, Schedule{ID: id + 1, Name: "other"}), ErrNotFound)
+
+	schedules, err := schedulesDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, schedules, 1)
+	assert.Equal(t, "America/Sao_Paulo", schedules[0].Timezone)
+	assert.Equal(t, []string{"mon", "tue"}, schedules[0].Days)
+	assert.Equal(t, []string{"08:00-15:00"}, schedules[0].Windows)
+
+	_, err = pool.Exec(ctx, `INSERT INTO blocked_domains (domain, schedule_id) VALUES ('games.com', $1)`, id)
+	require.NoError(t, err)
+	assert.ErrorIs(t, schedulesDB.Delete(ctx, id), ErrInUse)
+
+	_, err = pool.Exec(ctx, `DELETE FROM blocked_domains`)
+	require.NoError(t, err)
+	require.NoError(t, schedulesDB.Delete(ctx, id))
+	assert.ErrorIs(t, schedulesDB.Delete(ctx, id), ErrNotFound)
+
+	// Deleted schedules are kept, out of the listing.
+	var deleted bool
+	err = pool.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM schedules WHERE id = $1`, id).Scan(&deleted)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	schedules, err = schedulesDB.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, schedules)
+}
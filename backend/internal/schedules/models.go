@@ -0,0 +1,34 @@
+package schedules
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrInvalidSchedule = fmt.Errorf("invalid schedule")
+
+// Schedule is a set of weekly time windows in a timezone. Block rules,
+// category policies and client groups attached to a schedule only apply
+// while it is active.
+type Schedule struct {
+	ID   int64
+	Name string
+	// Timezone is an IANA name like "America/Sao_Paulo", empty for UTC.
+	Timezone string
+	// Days are the days the windows start on, "mon" to "sun". An empty list
+	// means every day.
+	Days []string
+	// Windows are "HH:MM-HH:MM" ranges of local time. A window ending before
+	// it starts runs past midnight into the next day. An empty list means
+	// the whole day.
+	Windows   []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// Validate checks that the timezone, days and windows are well formed.
+func (s Schedule) Validate() error {
+	_, err := Compile(s)
+	return err
+}
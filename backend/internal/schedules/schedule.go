@@ -0,0 +1,120 @@
+package schedules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Timezones are resolved even on hosts without a zoneinfo database.
+	_ "time/tzdata"
+)
+
+var days = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is a range of local time as offsets from midnight. Windows whose
+// end is not after their start run past midnight.
+type window struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// Compiled is a Schedule ready to be checked against the current time.
+type Compiled struct {
+	loc     *time.Location
+	days    [7]bool
+	windows []window
+}
+
+// Compile parses the timezone, days and windows of s.
+func Compile(s Schedule) (*Compiled, error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, s.Timezone)
+	}
+
+	c := &Compiled{loc: loc}
+	for _, name := range s.Days {
+		day, ok := days[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown day %q", ErrInvalidSchedule, name)
+		}
+		c.days[day] = true
+	}
+	if len(s.Days) == 0 {
+		c.days = [7]bool{true, true, true, true, true, true, true}
+	}
+
+	for _, w := range s.Windows {
+		start, end, ok := strings.Cut(w, "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: bad window %q", ErrInvalidSchedule, w)
+		}
+
+		var parsed window
+		parsed.start, ok = parseClock(start, false)
+		if !ok {
+			return nil, fmt.Errorf("%w: bad window %q", ErrInvalidSchedule, w)
+		}
+		parsed.end, ok = parseClock(end, true)
+		if !ok {
+			return nil, fmt.Errorf("%w: bad window %q", ErrInvalidSchedule, w)
+		}
+		c.windows = append(c.windows, parsed)
+	}
+
+	return c, nil
+}
+
+// parseClock parses HH:MM into an offset from midnight. 24:00 is accepted
+// as the end of a window.
+func parseClock(s string, end bool) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if end && s == "24:00" {
+		return 24 * time.Hour, true
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+}
+
+// Active reports whether t falls within one of the windows, in the local
+// time of the schedule. Windows running past midnight belong to the day
+// they start on.
+func (c *Compiled) Active(t time.Time) bool {
+	t = t.In(c.loc)
+	day := t.Weekday()
+	if len(c.windows) == 0 {
+		return c.days[day]
+	}
+
+	prev := (day + 6) % 7
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	for _, w := range c.windows {
+		if w.start < w.end {
+			if c.days[day] && clock >= w.start && clock < w.end {
+				return true
+			}
+			continue
+		}
+
+		if (c.days[day] && clock >= w.start) || (c.days[prev] && clock < w.end) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package schedules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile_Invalid(t *testing.T) {
+	tests := []Schedule{
+		{Timezone: "Mars/Olympus_Mons"},
+		{Days: []string{"monday"}},
+		{Windows: []string{"08:00"}},
+		{Windows: []string{"8am-3pm"}},
+		{Windows: []string{"08:00-25:00"}},
+		{Windows: []string{"24:00-08:00"}},
+	}
+
+	for _, s := range tests {
+		_, err := Compile(s)
+		assert.ErrorIs(t, err, ErrInvalidSchedule, "%+v", s)
+	}
+}
+
+func TestCompiled_Active(t *testing.T) {
+	school, err := Compile(Schedule{
+		Timezone: "America/Sao_Paulo",
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Windows:  []string{"08:00-15:00"},
+	})
+	require.NoError(t, err)
+
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		t      time.Time
+		active bool
+	}{
+		{"weekday morning", time.Date(2025, 3, 10, 8, 0, 0, 0, loc), true},
+		{"weekday afternoon", time.Date(2025, 3, 14, 14, 59, 59, 0, loc), true},
+		{"weekday end", time.Date(2025, 3, 14, 15, 0, 0, 0, loc), false},
+		{"weekday early", time.Date(2025, 3, 10, 7, 59, 0, 0, loc), false},
+		{"saturday", time.Date(2025, 3, 15, 10, 0, 0, 0, loc), false},
+		// 11:00 UTC is 08:00 in Sao Paulo.
+		{"other timezone", time.Date(2025, 3, 10, 11, 0, 0, 0, time.UTC), true},
+		{"other timezone early", time.Date(2025, 3, 10, 10, 59, 0, 0, time.UTC), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.active, school.Active(tc.t))
+		})
+	}
+}
+
+func TestCompiled_Active_Overnight(t *testing.T) {
+	night, err := Compile(Schedule{Days: []string{"fri"}, Windows: []string{"22:00-06:00"}})
+	require.NoError(t, err)
+
+	// 2025-03-14 is a Friday.
+	assert.True(t, night.Active(time.Date(2025, 3, 14, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, night.Active(time.Date(2025, 3, 15, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, night.Active(time.Date(2025, 3, 15, 6, 0, 0, 0, time.UTC)))
+	assert.False(t, night.Active(time.Date(2025, 3, 15, 23, 0, 0, 0, time.UTC)))
+	assert.False(t, night.Active(time.Date(2025, 3, 14, 5, 0, 0, 0, time.UTC)))
+}
+
+func TestCompiled_Active_Defaults(t *testing.T) {
+	always, err := Compile(Schedule{})
+	require.NoError(t, err)
+	assert.True(t, always.Active(time.Date(2025, 3, 15, 3, 0, 0, 0, time.UTC)))
+
+	weekend, err := Compile(Schedule{Days: []string{"Sat", "sun"}})
+	require.NoError(t, err)
+	assert.True(t, weekend.Active(time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, weekend.Active(time.Date(2025, 3, 17, 12, 0, 0, 0, time.UTC)))
+
+	evening, err := Compile(Schedule{Windows: []string{"18:00-24:00"}})
+	require.NoError(t, err)
+	assert.True(t, evening.Active(time.Date(2025, 3, 17, 23, 59, 59, 0, time.UTC)))
+	assert.False(t, evening.Active(time.Date(2025, 3, 18, 0, 0, 0, 0, time.UTC)))
+}
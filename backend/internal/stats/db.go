@@ -25,6 +25,11 @@ type DB interface {
 		categories []string) ([]MostUsedDomainResponse, error)
 	GetServerUsageByTimeRange(ctx context.Context, from, to time.Time, categories []string) (
 		[]ServerUsageByTimeRangeResponse, error)
+	InsertClient(ctx context.Context, t time.Time, client string) error
+	SetClientHostname(ctx context.Context, client, hostname string) error
+	GetMostActiveClients(ctx context.Context, from, to time.Time, limit int) ([]MostActiveClientResponse, error)
+	ReplaceUpstreamStats(ctx context.Context, upstreams []UpstreamStats) error
+	GetUpstreamStats(ctx context.Context) ([]UpstreamStats, error)
 }
 
 func New(db *db.DB) DB {
@@ -119,11 +124,15 @@ func (s *statsDB) GetMostUsedDomains(ctx context.Context, from, to time.Time,
 	return res, nil
 }
 
-func (s *statsDB) Insert(ctx context.Context, t time.Time, domain, domainType string) error {
-	// Truncate the time to the minute
-	// This is to ensure that we can aggregate stats by 10 minutes
+// aggregationTime truncates t to the minute
+// This is to ensure that we can aggregate stats by 10 minutes
+func aggregationTime(t time.Time) time.Time {
 	minute := t.Minute()
-	newTime := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), minute-t.Minute()%10, 0, 0, t.Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), minute-t.Minute()%10, 0, 0, t.Location())
+}
+
+func (s *statsDB) Insert(ctx context.Context, t time.Time, domain, domainType string) error {
+	newTime := aggregationTime(t)
 
 	_, err := s.db.Exec(ctx, `
 		INSERT INTO stats_aggregated (time, domain, count, q_type)
@@ -180,3 +189,84 @@ func (s *statsDB) GetServerUsageByTimeRange(ctx context.Context, from time.Time,
 
 	return res, nil
 }
+
+// InsertClient counts a query from client, an IP address, in the same 10
+// minute buckets as Insert.
+func (s *statsDB) InsertClient(ctx context.Context, t time.Time, client string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO client_stats_aggregated (time, client, count)
+			VALUES ($1, $2, 1) ON CONFLICT(time, client) DO
+		UPDATE SET count = client_stats_aggregated.count + 1, updated_at = NOW()
+	`, aggregationTime(t), client)
+	return err
+}
+
+// SetClientHostname labels client with the hostname its address resolves
+// to.
+func (s *statsDB) SetClientHostname(ctx context.Context, client, hostname string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO client_hostnames (client, hostname)
+			VALUES ($1, $2) ON CONFLICT(client) DO
+		UPDATE SET hostname = EXCLUDED.hostname, updated_at = NOW()
+	`, client, hostname)
+	return err
+}
+
+func (s *statsDB) GetMostActiveClients(ctx context.Context, from, to time.Time,
+	limit int) ([]MostActiveClientResponse, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT cs.client, COALESCE(ch.hostname, '') AS hostname, SUM(cs.count) AS count
+		FROM client_stats_aggregated cs
+		LEFT JOIN client_hostnames ch ON ch.client = cs.client
+		WHERE cs.time >= $1 AND cs.time <= $2
+		GROUP BY cs.client, ch.hostname
+		ORDER BY count DESC
+		LIMIT $3
+	`, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[MostActiveClientResponse])
+}
+
+// ReplaceUpstreamStats stores upstreams as the current upstream counters,
+// dropping those of upstreams no longer configured.
+func (s *statsDB) ReplaceUpstreamStats(ctx context.Context, upstreams []UpstreamStats) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rolling back after a commit is a no-op.
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(ctx, "DELETE FROM upstream_stats")
+	if err != nil {
+		return err
+	}
+
+	for _, u := range upstreams {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO upstream_stats (pool, address, healthy, queries, errors, avg_latency_ms)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, u.Pool, u.Address, u.Healthy, u.Queries, u.Errors, u.AvgLatencyMs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *statsDB) GetUpstreamStats(ctx context.Context) ([]UpstreamStats, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT pool, address, healthy, queries, errors, avg_latency_ms, updated_at
+		FROM upstream_stats
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[UpstreamStats])
+}
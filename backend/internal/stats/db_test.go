@@ -231,3 +231,61 @@ func TestStatsDB_GetUsedDomainsByTimeAggregation(t *testing.T) {
 	assert.Equal(t, "facebook.com", results[1].Domain)
 	assert.Equal(t, int64(5), results[1].Count)
 }
+
+func TestStatsDB_GetMostActiveClients(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	statsDB := New(database)
+
+	ctx := context.Background()
+	baseTime := time.Date(2023, 1, 1, 12, 5, 0, 0, time.UTC)
+
+	require.NoError(t, statsDB.InsertClient(ctx, baseTime, "192.168.0.10"))
+	require.NoError(t, statsDB.InsertClient(ctx, baseTime.Add(2*time.Minute), "192.168.0.10"))
+	require.NoError(t, statsDB.InsertClient(ctx, baseTime, "192.168.0.11"))
+	require.NoError(t, statsDB.SetClientHostname(ctx, "192.168.0.10", "old.home.lan"))
+	require.NoError(t, statsDB.SetClientHostname(ctx, "192.168.0.10", "laptop.home.lan"))
+
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	results, err := statsDB.GetMostActiveClients(ctx, from, to, 10)
+	require.NoError(t, err)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, MostActiveClientResponse{Client: "192.168.0.10", Hostname: "laptop.home.lan", Count: 2}, results[0])
+	assert.Equal(t, MostActiveClientResponse{Client: "192.168.0.11", Count: 1}, results[1])
+}
+
+func TestStatsDB_ReplaceUpstreamStats(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	statsDB := New(database)
+
+	ctx := context.Background()
+	require.NoError(t, statsDB.ReplaceUpstreamStats(ctx, []UpstreamStats{
+		{Pool: "default", Address: "8.8.8.8:53", Healthy: true, Queries: 10, Errors: 1, AvgLatencyMs: 12.5},
+	}))
+	require.NoError(t, statsDB.ReplaceUpstreamStats(ctx, []UpstreamStats{
+		{Pool: "default", Address: "1.1.1.1:53", Healthy: true, Queries: 3, AvgLatencyMs: 8},
+		{Pool: "forwarding", Address: "10.0.0.1", Queries: 2, Errors: 2},
+	}))
+
+	results, err := statsDB.GetUpstreamStats(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, "1.1.1.1:53", results[0].Address)
+	assert.Equal(t, int64(3), results[0].Queries)
+	assert.InDelta(t, 8, results[0].AvgLatencyMs, 0.001)
+	assert.Equal(t, "forwarding", results[1].Pool)
+	assert.False(t, results[1].Healthy)
+	assert.Equal(t, int64(2), results[1].Errors)
+	assert.False(t, results[1].UpdatedAt.IsZero())
+}
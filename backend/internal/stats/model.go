@@ -11,3 +11,24 @@ type ServerUsageByTimeRangeResponse struct {
 	TimeRange time.Time
 	Count     int64
 }
+
+// UpstreamStats are the counters of an upstream since the DNS server started.
+type UpstreamStats struct {
+	// Pool is "default" for the upstream servers, "forwarding" for the
+	// servers of the forwarding rules and the private reverse zones, or
+	// "group " followed by the names of the client groups using the servers.
+	Pool         string
+	Address      string
+	Healthy      bool
+	Queries      int64
+	Errors       int64
+	AvgLatencyMs float64
+	UpdatedAt    time.Time
+}
+
+type MostActiveClientResponse struct {
+	Client string
+	// Hostname is the PTR name of the client, empty when unknown.
+	Hostname string
+	Count    int64
+}
@@ -0,0 +1,118 @@
+package subscriptions
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/orion-tec/oriondns/db"
+)
+
+type subscriptionsDB struct {
+	db *db.DB
+}
+
+type DB interface {
+	Insert(ctx context.Context, name, url string) error
+	GetAll(ctx context.Context) ([]Subscription, error)
+	// ReplaceRules swaps the rules imported from a subscription for list and
+	// stores the validators of the download.
+	ReplaceRules(ctx context.Context, id int64, list *List, etag, lastModified string) error
+	// MarkSynced records a sync that did not change the rules, with the
+	// error that stopped it, if any.
+	MarkSynced(ctx context.Context, id int64, syncErr string) error
+}
+
+func New(db *db.DB) DB {
+	return &subscriptionsDB{db}
+}
+
+func (s *subscriptionsDB) Insert(ctx context.Context, name, url string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO subscriptions (name, url)
+			VALUES ($1, $2)
+	`, name, url)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *subscriptionsDB) GetAll(ctx context.Context) ([]Subscription, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, url, enabled, etag, last_modified, rules_count, last_synced_at, last_error,
+			created_at, updated_at, deleted_at
+		FROM subscriptions
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := pgx.CollectRows(rows, pgx.RowToStructByName[Subscription])
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+func (s *subscriptionsDB) ReplaceRules(ctx context.Context, id int64, list *List, etag, lastModified string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rolling back after a commit is a no-op.
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tables := []struct {
+		name  string
+		rules []Rule
+	}{
+		{"blocked_domains", list.Blocked},
+		{"allowed_domains", list.Allowed},
+	}
+
+	for _, table := range tables {
+		rules := table.rules
+		_, err = tx.Exec(ctx, "DELETE FROM "+table.name+" WHERE subscription_id = $1", id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{table.name}, []string{"domain", "recursive", "subscription_id"},
+			pgx.CopyFromSlice(len(rules), func(i int) ([]any, error) {
+				return []any{rules[i].Domain, rules[i].Recursive, id}, nil
+			}))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE subscriptions
+		SET etag = $2, last_modified = $3, rules_count = $4, last_synced_at = NOW(), last_error = '',
+			updated_at = NOW()
+		WHERE id = $1
+	`, id, etag, lastModified, len(list.Blocked)+len(list.Allowed))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *subscriptionsDB) MarkSynced(ctx context.Context, id int64, syncErr string) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE subscriptions
+		SET last_synced_at = NOW(), last_error = $2, updated_at = NOW()
+		WHERE id = $1
+	`, id, syncErr)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
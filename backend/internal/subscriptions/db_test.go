@@ -0,0 +1,88 @@
+package subscriptions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/db"
+	"github.com/orion-tec/oriondns/internal/testutil"
+)
+
+func TestSubscriptionsDB_Insert_GetAll(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	subscriptionsDB := New(database)
+
+	ctx := context.Background()
+
+	err := subscriptionsDB.Insert(ctx, "ads", "https://lists.example.com/ads.txt")
+	require.NoError(t, err)
+
+	subs, err := subscriptionsDB.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	assert.Equal(t, "ads", subs[0].Name)
+	assert.Equal(t, "https://lists.example.com/ads.txt", subs[0].URL)
+	assert.True(t, subs[0].Enabled)
+	assert.Nil(t, subs[0].LastSyncedAt)
+}
+
+func TestSubscriptionsDB_ReplaceRules(t *testing.T) {
+	testutil.SkipIfNoDatabase(t)
+	pool := testutil.SetupTestDB(t)
+	testutil.TruncateAllTables(t, pool)
+
+	database := db.NewWithPool(pool)
+	subscriptionsDB := New(database)
+
+	ctx := context.Background()
+
+	require.NoError(t, subscriptionsDB.Insert(ctx, "ads", "https://lists.example.com/ads.txt"))
+	subs, err := subscriptionsDB.GetAll(ctx)
+	require.NoError(t, err)
+	id := subs[0].ID
+
+	_, err = pool.Exec(ctx, "INSERT INTO blocked_domains (domain) VALUES ('manual.example.com')")
+	require.NoError(t, err)
+
+	err = subscriptionsDB.ReplaceRules(ctx, id, &List{
+		Blocked: []Rule{{Domain: "old.example.com"}},
+	}, `"v1"`, "")
+	require.NoError(t, err)
+
+	err = subscriptionsDB.ReplaceRules(ctx, id, &List{
+		Blocked: []Rule{{Domain: "ads.example.com", Recursive: true}, {Domain: "tracker.example.net"}},
+		Allowed: []Rule{{Domain: "cdn.ads.example.com", Recursive: true}},
+	}, `"v2"`, "Mon, 02 Jan 2006 15:04:05 GMT")
+	require.NoError(t, err)
+
+	var blocked, allowed, manual int
+	err = pool.QueryRow(ctx, "SELECT COUNT(*) FROM blocked_domains WHERE subscription_id = $1", id).Scan(&blocked)
+	require.NoError(t, err)
+	err = pool.QueryRow(ctx, "SELECT COUNT(*) FROM allowed_domains WHERE subscription_id = $1", id).Scan(&allowed)
+	require.NoError(t, err)
+	err = pool.QueryRow(ctx, "SELECT COUNT(*) FROM blocked_domains WHERE subscription_id IS NULL").Scan(&manual)
+	require.NoError(t, err)
+	assert.Equal(t, 2, blocked)
+	assert.Equal(t, 1, allowed)
+	assert.Equal(t, 1, manual)
+
+	subs, err = subscriptionsDB.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, `"v2"`, subs[0].ETag)
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", subs[0].LastModified)
+	assert.Equal(t, 3, subs[0].RulesCount)
+	assert.NotNil(t, subs[0].LastSyncedAt)
+
+	require.NoError(t, subscriptionsDB.MarkSynced(ctx, id, "boom"))
+	subs, err = subscriptionsDB.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "boom", subs[0].LastError)
+	assert.Equal(t, `"v2"`, subs[0].ETag)
+}
@@ -0,0 +1,35 @@
+package subscriptions
+
+import "time"
+
+// Subscription is a remote list of rules kept in sync with the blocked and
+// allowed domains.
+type Subscription struct {
+	ID      int64
+	Name    string
+	URL     string
+	Enabled bool
+	// ETag and LastModified are the validators of the last download, sent
+	// back so unchanged lists are not downloaded again.
+	ETag         string
+	LastModified string
+	RulesCount   int
+	LastSyncedAt *time.Time
+	LastError    string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time
+}
+
+// Rule is a domain taken from a list.
+type Rule struct {
+	Domain    string
+	Recursive bool
+}
+
+// List holds the rules parsed from a subscription.
+type List struct {
+	Blocked []Rule
+	// Allowed are exceptions, like AdBlock @@ rules.
+	Allowed []Rule
+}
@@ -0,0 +1,148 @@
+package subscriptions
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+const maxLineLen = 64 * 1024
+
+// Host names in hosts files that point at the machine itself rather than
+// at a blocked domain.
+var localHosts = map[string]struct{}{
+	"localhost":             {},
+	"localhost.localdomain": {},
+	"local":                 {},
+	"broadcasthost":         {},
+	"ip6-localhost":         {},
+	"ip6-loopback":          {},
+	"ip6-localnet":          {},
+	"ip6-mcastprefix":       {},
+	"ip6-allnodes":          {},
+	"ip6-allrouters":        {},
+	"ip6-allhosts":          {},
+	"0.0.0.0":               {},
+}
+
+// Parse reads a hosts file, an AdBlock-style list or a plain list of
+// domains, detecting the syntax line by line:
+//
+//	0.0.0.0 ads.example.com     hosts entry, blocks the name itself
+//	||ads.example.com^          AdBlock rule, blocks the domain and subdomains
+//	@@||cdn.example.com^        AdBlock exception, allows them
+//	ads.example.com             plain domain, blocks the name itself
+//
+// Comments, cosmetic and URL rules and rules with options are skipped, as
+// they cannot be enforced on DNS.
+func Parse(r io.Reader) (*List, error) {
+	type key struct {
+		Rule
+		allow bool
+	}
+
+	list := &List{}
+	seen := make(map[key]struct{})
+	add := func(domain string, recursive, allow bool) {
+		domain = matcher.Normalize(domain)
+		if !validDomain(domain) {
+			return
+		}
+
+		rule := Rule{Domain: domain, Recursive: recursive}
+		if _, ok := seen[key{rule, allow}]; ok {
+			return
+		}
+		seen[key{rule, allow}] = struct{}{}
+
+		if allow {
+			list.Allowed = append(list.Allowed, rule)
+		} else {
+			list.Blocked = append(list.Blocked, rule)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineLen)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+
+		if domain, allow, ok := parseAdBlock(line); ok {
+			add(domain, true, allow)
+			continue
+		}
+
+		// Comments start a field, so cosmetic rules like example.com##.ad
+		// stay whole and are rejected as invalid domains.
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+
+		switch {
+		case len(fields) == 0:
+		case net.ParseIP(fields[0]) != nil:
+			for _, host := range fields[1:] {
+				if _, ok := localHosts[strings.ToLower(host)]; !ok {
+					add(host, false, false)
+				}
+			}
+		case len(fields) == 1:
+			add(fields[0], false, false)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// parseAdBlock parses the ||domain^ rules that map to DNS blocking, and
+// their @@ exceptions.
+func parseAdBlock(line string) (string, bool, bool) {
+	allow := strings.HasPrefix(line, "@@")
+	line = strings.TrimPrefix(line, "@@")
+
+	if !strings.HasPrefix(line, "||") {
+		return "", false, false
+	}
+
+	domain, ok := strings.CutSuffix(strings.TrimSuffix(line[2:], "|"), "^")
+	if !ok || strings.ContainsAny(domain, "*/$^|") {
+		return "", false, false
+	}
+
+	return domain, allow, true
+}
+
+// validDomain accepts normalized host names with at least two labels.
+func validDomain(domain string) bool {
+	if len(domain) > 253 || !strings.Contains(domain, ".") || net.ParseIP(domain) != nil {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package subscriptions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Hosts(t *testing.T) {
+	list, err := Parse(strings.NewReader(`
+# StevenBlack style hosts file
+127.0.0.1 localhost
+::1 localhost ip6-localhost ip6-loopback
+0.0.0.0 0.0.0.0
+0.0.0.0 ads.example.com
+0.0.0.0 Tracker.Example.com. metrics.example.com # trailing comment
+127.0.0.1	tabs.example.com
+0.0.0.0 ads.example.com
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Rule{
+		{Domain: "ads.example.com"},
+		{Domain: "tracker.example.com"},
+		{Domain: "metrics.example.com"},
+		{Domain: "tabs.example.com"},
+	}, list.Blocked)
+	assert.Empty(t, list.Allowed)
+}
+
+func TestParse_AdBlock(t *testing.T) {
+	list, err := Parse(strings.NewReader(`[Adblock Plus 2.0]
+! Title: test list
+||ads.example.com^
+||tracker.example.net^|
+@@||cdn.ads.example.com^
+||third-party.example.com^$third-party
+||example.org/banner.js
+||wild*.example.com^
+example.com##.banner
+/banner/*/img^
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Rule{
+		{Domain: "ads.example.com", Recursive: true},
+		{Domain: "tracker.example.net", Recursive: true},
+	}, list.Blocked)
+	assert.Equal(t, []Rule{{Domain: "cdn.ads.example.com", Recursive: true}}, list.Allowed)
+}
+
+func TestParse_PlainDomains(t *testing.T) {
+	list, err := Parse(strings.NewReader(`
+# plain list
+ads.example.com
+  malware.example.net  
+localhost
+192.0.2.1
+not a domain
+bad!chars.example.com
+-
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Rule{
+		{Domain: "ads.example.com"},
+		{Domain: "malware.example.net"},
+	}, list.Blocked)
+}
+
+func TestParse_LongLine(t *testing.T) {
+	_, err := Parse(strings.NewReader(strings.Repeat("a", maxLineLen+1)))
+	assert.Error(t, err)
+}
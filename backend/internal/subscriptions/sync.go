@@ -0,0 +1,144 @@
+package subscriptions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go.uber.org/fx"
+
+	"github.com/orion-tec/oriondns/config"
+)
+
+const (
+	defaultInterval = 24 * time.Hour
+	defaultTimeout  = time.Minute
+	// maxListSize bounds downloads, large lists are around 50 MiB.
+	maxListSize = 256 << 20
+)
+
+var (
+	ErrUnexpectedStatus = fmt.Errorf("unexpected http status")
+	ErrListTooLarge     = fmt.Errorf("list too large")
+)
+
+type syncer struct {
+	db      DB
+	client  *http.Client
+	maxSize int64
+}
+
+type Syncer interface {
+	Sync(ctx context.Context) error
+}
+
+func NewSyncer(lc fx.Lifecycle, cfg *config.Config, subscriptionsDB DB) Syncer {
+	interval := cfg.DNS.Subscriptions.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+
+	timeout := cfg.DNS.Subscriptions.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	s := newSyncer(subscriptionsDB, &http.Client{Timeout: timeout})
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go func() {
+				for {
+					fmt.Println("Syncing subscriptions")
+					err := s.Sync(context.Background())
+					if err != nil {
+						log.Printf("Error on subscriptions syncer: %s\n", err)
+					}
+
+					time.Sleep(interval)
+				}
+			}()
+			return nil
+		},
+	})
+
+	return s
+}
+
+func newSyncer(subscriptionsDB DB, client *http.Client) *syncer {
+	return &syncer{db: subscriptionsDB, client: client, maxSize: maxListSize}
+}
+
+// Sync downloads every enabled subscription and replaces its rules. A
+// failing subscription keeps its previous rules and records the error.
+func (s *syncer) Sync(ctx context.Context) error {
+	subs, err := s.db.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if !sub.Enabled {
+			continue
+		}
+
+		err := s.sync(ctx, sub)
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Failed to sync subscription %s: %s\n", sub.URL, err)
+		err = s.db.MarkSynced(ctx, sub.ID, err.Error())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *syncer) sync(ctx context.Context, sub Subscription) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	if sub.ETag != "" {
+		req.Header.Set("If-None-Match", sub.ETag)
+	}
+	if sub.LastModified != "" {
+		req.Header.Set("If-Modified-Since", sub.LastModified)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		log.Printf("Subscription %s not modified\n", sub.URL)
+		return s.db.MarkSynced(ctx, sub.ID, "")
+	default:
+		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	// Reading a byte past the limit tells lists over it from lists that fill
+	// it exactly, so they fail rather than being cut short.
+	body := &io.LimitedReader{R: resp.Body, N: s.maxSize + 1}
+	list, err := Parse(body)
+	if err != nil {
+		return err
+	}
+	if body.N == 0 {
+		return fmt.Errorf("%w: over %d bytes", ErrListTooLarge, s.maxSize)
+	}
+
+	log.Printf("Subscription %s has %d blocked and %d allowed domains\n", sub.URL, len(list.Blocked),
+		len(list.Allowed))
+	return s.db.ReplaceRules(ctx, sub.ID, list, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"))
+}
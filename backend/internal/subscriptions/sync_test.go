@@ -0,0 +1,130 @@
+package subscriptions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryDB keeps subscriptions and their rules in memory.
+type memoryDB struct {
+	subs  []Subscription
+	lists map[int64]*List
+}
+
+func (m *memoryDB) Insert(_ context.Context, name, url string) error {
+	m.subs = append(m.subs, Subscription{ID: int64(len(m.subs) + 1), Name: name, URL: url, Enabled: true})
+	return nil
+}
+
+func (m *memoryDB) GetAll(context.Context) ([]Subscription, error) {
+	return append([]Subscription(nil), m.subs...), nil
+}
+
+func (m *memoryDB) ReplaceRules(_ context.Context, id int64, list *List, etag, lastModified string) error {
+	m.lists[id] = list
+	sub := &m.subs[id-1]
+	sub.ETag, sub.LastModified, sub.LastError = etag, lastModified, ""
+	sub.RulesCount = len(list.Blocked) + len(list.Allowed)
+	return nil
+}
+
+func (m *memoryDB) MarkSynced(_ context.Context, id int64, syncErr string) error {
+	m.subs[id-1].LastError = syncErr
+	return nil
+}
+
+func newListServer(t *testing.T, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var downloads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag.txt":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/last-modified.txt":
+			if r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		downloads.Add(1)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &downloads
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	srv, downloads := newListServer(t, "||ads.example.com^\n@@||cdn.ads.example.com^\n0.0.0.0 tracker.example.net\n")
+
+	db := &memoryDB{lists: make(map[int64]*List)}
+	ctx := context.Background()
+	require.NoError(t, db.Insert(ctx, "etag", srv.URL+"/etag.txt"))
+	require.NoError(t, db.Insert(ctx, "last modified", srv.URL+"/last-modified.txt"))
+	require.NoError(t, db.Insert(ctx, "missing", srv.URL+"/missing.txt"))
+	require.NoError(t, db.Insert(ctx, "disabled", srv.URL+"/etag.txt"))
+	db.subs[3].Enabled = false
+
+	s := newSyncer(db, srv.Client())
+	require.NoError(t, s.Sync(ctx))
+
+	assert.Equal(t, int32(2), downloads.Load())
+	for _, id := range []int64{1, 2} {
+		list := db.lists[id]
+		require.NotNil(t, list, id)
+		assert.Equal(t, []Rule{
+			{Domain: "ads.example.com", Recursive: true},
+			{Domain: "tracker.example.net"},
+		}, list.Blocked)
+		assert.Equal(t, []Rule{{Domain: "cdn.ads.example.com", Recursive: true}}, list.Allowed)
+	}
+
+	assert.Equal(t, `"v1"`, db.subs[0].ETag)
+	assert.Equal(t, 3, db.subs[0].RulesCount)
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", db.subs[1].LastModified)
+	assert.Contains(t, db.subs[2].LastError, "404")
+	assert.Nil(t, db.lists[3])
+	assert.Nil(t, db.lists[4])
+
+	// Unchanged lists are not downloaded again and keep their rules.
+	require.NoError(t, s.Sync(ctx))
+	assert.Equal(t, int32(2), downloads.Load())
+	assert.Len(t, db.lists[1].Blocked, 2)
+}
+
+func TestSyncer_Sync_ListTooLarge(t *testing.T) {
+	body := "||ads.example.com^\n"
+	srv, _ := newListServer(t, body)
+
+	db := &memoryDB{lists: make(map[int64]*List)}
+	ctx := context.Background()
+	require.NoError(t, db.Insert(ctx, "etag", srv.URL+"/etag.txt"))
+
+	s := newSyncer(db, srv.Client())
+	s.maxSize = int64(len(body)) - 1
+	require.NoError(t, s.Sync(ctx))
+	assert.Nil(t, db.lists[1])
+	assert.Contains(t, db.subs[0].LastError, ErrListTooLarge.Error())
+
+	// Lists filling the limit exactly are kept whole.
+	s.maxSize = int64(len(body))
+	require.NoError(t, s.Sync(ctx))
+	require.NotNil(t, db.lists[1])
+	assert.Equal(t, []Rule{{Domain: "ads.example.com", Recursive: true}}, db.lists[1].Blocked)
+}
@@ -59,7 +59,17 @@ func TruncateAllTables(t *testing.T, pool *pgxpool.Pool) {
 
 	tables := []string{
 		"stats_aggregated",
+		"client_stats_aggregated",
+		"client_hostnames",
+		"upstream_stats",
 		"blocked_domains",
+		"allowed_domains",
+		"subscriptions",
+		"category_policies",
+		"clients",
+		"client_groups",
+		"schedules",
+		"local_records",
 		"domain_categories",
 		"domains",
 	}
@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const dohContentType = "application/dns-message"
+
+// httpsTransport sends RFC 8484 POST requests. The underlying http.Transport
+// keeps connections alive and multiplexes queries over HTTP/2.
+type httpsTransport struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSTransport(url string, timeout time.Duration, tlsConfig *tls.Config) *httpsTransport {
+	return &httpsTransport{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig:     tlsConfig,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConnsPerHost: 4,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+func (t *httpsTransport) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	// The ID is set to zero so responses are cacheable by HTTP intermediaries.
+	q := msg.Copy()
+	q.Id = 0
+
+	data, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned http status %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, err
+	}
+	resp.Id = msg.Id
+
+	return resp, nil
+}
+
+func (t *httpsTransport) close() {
+	t.client.CloseIdleConnections()
+}
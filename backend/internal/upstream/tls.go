@@ -0,0 +1,188 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var errConnClosed = fmt.Errorf("upstream connection closed")
+
+// tlsTransport keeps a single DNS-over-TLS connection open and pipelines
+// queries on it, matching responses to queries by message ID (RFC 7766).
+type tlsTransport struct {
+	addr      string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	conn *pipelinedConn
+}
+
+type pipelinedConn struct {
+	conn *dns.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint16]chan *dns.Msg
+	err     error
+	done    chan struct{}
+}
+
+func newTLSTransport(addr string, timeout time.Duration, tlsConfig *tls.Config) *tlsTransport {
+	return &tlsTransport{
+		addr:      addr,
+		timeout:   timeout,
+		tlsConfig: tlsConfig,
+	}
+}
+
+func (t *tlsTransport) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	// A reused connection may have been closed by the server while idle, in
+	// which case the query is retried once on a fresh connection.
+	for {
+		pc, fresh, err := t.getConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := pc.exchange(ctx, msg)
+		if err == nil || fresh || ctx.Err() != nil {
+			return resp, err
+		}
+	}
+}
+
+func (t *tlsTransport) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil {
+		t.conn.fail(errConnClosed)
+		t.conn = nil
+	}
+}
+
+// getConn returns the open connection, dialing a new one when there is none.
+func (t *tlsTransport) getConn(ctx context.Context) (*pipelinedConn, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil && !t.conn.closed() {
+		return t.conn, false, nil
+	}
+
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: t.timeout}, Config: t.tlsConfig}
+	c, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	pc := &pipelinedConn{
+		conn:    &dns.Conn{Conn: c},
+		pending: make(map[uint16]chan *dns.Msg),
+		done:    make(chan struct{}),
+	}
+	go pc.readLoop()
+
+	t.conn = pc
+	return pc, true, nil
+}
+
+func (pc *pipelinedConn) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	q := msg.Copy()
+	ch := make(chan *dns.Msg, 1)
+
+	pc.mu.Lock()
+	if pc.err != nil {
+		pc.mu.Unlock()
+		return nil, pc.err
+	}
+	for {
+		q.Id = uint16(rand.UintN(1 << 16))
+		if _, taken := pc.pending[q.Id]; !taken {
+			break
+		}
+	}
+	pc.pending[q.Id] = ch
+	pc.mu.Unlock()
+
+	defer func() {
+		pc.mu.Lock()
+		delete(pc.pending, q.Id)
+		pc.mu.Unlock()
+	}()
+
+	pc.writeMu.Lock()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = pc.conn.SetWriteDeadline(deadline)
+	}
+	err := pc.conn.WriteMsg(q)
+	pc.writeMu.Unlock()
+	if err != nil {
+		pc.fail(err)
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		resp.Id = msg.Id
+		return resp, nil
+	case <-pc.done:
+		return nil, pc.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (pc *pipelinedConn) readLoop() {
+	for {
+		resp, err := pc.conn.ReadMsg()
+		if err != nil {
+			pc.fail(err)
+			return
+		}
+
+		pc.mu.Lock()
+		ch, ok := pc.pending[resp.Id]
+		delete(pc.pending, resp.Id)
+		pc.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+// fail closes the connection and wakes up every query waiting on it.
+func (pc *pipelinedConn) fail(err error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.err != nil {
+		return
+	}
+
+	pc.err = err
+	close(pc.done)
+	_ = pc.conn.Close()
+}
+
+func (pc *pipelinedConn) closed() bool {
+	select {
+	case <-pc.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	ErrUnknownScheme = fmt.Errorf("unknown upstream scheme")
+	ErrIDMismatch    = fmt.Errorf("upstream answer id mismatch")
+)
+
+// transport sends a single query to an upstream over a given protocol.
+type transport interface {
+	exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error)
+	close()
+}
+
+// newTransport builds the transport for server, which is either a plain
+// host:port (UDP) or a udp://, tcp://, tls:// or https:// URL.
+func newTransport(server string, timeout time.Duration, tlsConfig *tls.Config) (transport, error) {
+	if !strings.Contains(server, "://") {
+		server = "udp://" + server
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "udp":
+		return newUDPTransport(hostWithPort(u.Host, "53"), timeout), nil
+	case "tcp":
+		return &tcpTransport{
+			addr:   hostWithPort(u.Host, "53"),
+			client: &dns.Client{Net: "tcp", Timeout: timeout},
+		}, nil
+	case "tls":
+		return newTLSTransport(hostWithPort(u.Host, "853"), timeout, clientTLSConfig(tlsConfig, u.Hostname())), nil
+	case "https":
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return newHTTPSTransport(u.String(), timeout, clientTLSConfig(tlsConfig, u.Hostname())), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownScheme, u.Scheme)
+}
+
+func hostWithPort(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	return net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+}
+
+func clientTLSConfig(base *tls.Config, serverName string) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = serverName
+	}
+
+	return cfg
+}
+
+// udpTransport retries over TCP when the UDP answer comes back truncated.
+type udpTransport struct {
+	addr      string
+	client    *dns.Client
+	tcpClient *dns.Client
+}
+
+func newUDPTransport(addr string, timeout time.Duration) *udpTransport {
+	return &udpTransport{
+		addr:      addr,
+		client:    &dns.Client{Net: "udp", Timeout: timeout},
+		tcpClient: &dns.Client{Net: "tcp", Timeout: timeout},
+	}
+}
+
+func (t *udpTransport) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	resp, err := exchangeWithRandomID(ctx, t.client, msg, t.addr)
+	if err == nil && resp.Truncated {
+		resp, err = exchangeWithRandomID(ctx, t.tcpClient, msg, t.addr)
+	}
+
+	return resp, err
+}
+
+func (t *udpTransport) close() {}
+
+type tcpTransport struct {
+	addr   string
+	client *dns.Client
+}
+
+func (t *tcpTransport) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	return exchangeWithRandomID(ctx, t.client, msg, t.addr)
+}
+
+func (t *tcpTransport) close() {}
+
+// exchangeWithRandomID sends msg with a random ID rather than the client's,
+// which DoQ and DoH clients set to zero, so answers are hard to forge. The
+// client's ID is restored on the answer.
+func exchangeWithRandomID(ctx context.Context, client *dns.Client, msg *dns.Msg, addr string) (*dns.Msg, error) {
+	q := msg.Copy()
+	q.Id = dns.Id()
+
+	resp, _, err := client.ExchangeContext(ctx, q, addr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Id != q.Id {
+		return nil, ErrIDMismatch
+	}
+
+	resp.Id = msg.Id
+	return resp, nil
+}
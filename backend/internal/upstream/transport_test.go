@@ -0,0 +1,254 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTransport(t *testing.T) {
+	testCases := []struct {
+		server string
+		check  func(t *testing.T, tr transport)
+	}{
+		{"8.8.8.8:53", func(t *testing.T, tr transport) {
+			assert.Equal(t, "8.8.8.8:53", tr.(*udpTransport).addr)
+		}},
+		{"udp://9.9.9.9", func(t *testing.T, tr transport) {
+			assert.Equal(t, "9.9.9.9:53", tr.(*udpTransport).addr)
+		}},
+		{"tcp://[2001:db8::1]", func(t *testing.T, tr transport) {
+			assert.Equal(t, "[2001:db8::1]:53", tr.(*tcpTransport).addr)
+		}},
+		{"tls://1.1.1.1", func(t *testing.T, tr transport) {
+			tt := tr.(*tlsTransport)
+			assert.Equal(t, "1.1.1.1:853", tt.addr)
+			assert.Equal(t, "1.1.1.1", tt.tlsConfig.ServerName)
+		}},
+		{"tls://dns.quad9.net:8853", func(t *testing.T, tr transport) {
+			tt := tr.(*tlsTransport)
+			assert.Equal(t, "dns.quad9.net:8853", tt.addr)
+			assert.Equal(t, "dns.quad9.net", tt.tlsConfig.ServerName)
+		}},
+		{"https://dns.google", func(t *testing.T, tr transport) {
+			assert.Equal(t, "https://dns.google/dns-query", tr.(*httpsTransport).url)
+		}},
+		{"https://cloudflare-dns.com/custom", func(t *testing.T, tr transport) {
+			assert.Equal(t, "https://cloudflare-dns.com/custom", tr.(*httpsTransport).url)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.server, func(t *testing.T) {
+			tr, err := newTransport(tc.server, time.Second, nil)
+			require.NoError(t, err)
+			tc.check(t, tr)
+		})
+	}
+
+	_, err := newTransport("quic://1.1.1.1", time.Second, nil)
+	assert.ErrorIs(t, err, ErrUnknownScheme)
+}
+
+func TestPlainTransports_RandomizeID(t *testing.T) {
+	var mu sync.Mutex
+	var seen []uint16
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		seen = append(seen, r.Id)
+		mu.Unlock()
+		answerWith("10.0.0.1", nil)(w, r)
+	})
+
+	for _, server := range []string{"udp://" + addr, "tcp://" + addr} {
+		tr, err := newTransport(server, time.Second, nil)
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			// DoQ and DoH clients send ID 0.
+			req := query("example.com.")
+			req.Id = 0
+			resp, err := tr.exchange(context.Background(), req)
+			require.NoError(t, err, server)
+			assert.Equal(t, uint16(0), resp.Id)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, seen, 4)
+	assert.False(t, seen[0] == 0 && seen[1] == 0, "udp ids should be random")
+	assert.False(t, seen[2] == 0 && seen[3] == 0, "tcp ids should be random")
+}
+
+func TestPlainTransports_IDMismatch(t *testing.T) {
+	addr := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Id = r.Id + 1
+		_ = w.WriteMsg(m)
+	})
+
+	tr, err := newTransport("tcp://"+addr, time.Second, nil)
+	require.NoError(t, err)
+
+	_, err = tr.exchange(context.Background(), query("example.com."))
+	assert.Error(t, err)
+}
+
+// newTestTLSServer starts an HTTPS stand-in whose certificate is used by all
+// encrypted upstream tests, and returns a client config trusting it.
+func newTestTLSServer(t *testing.T, handler http.Handler) (*httptest.Server, *tls.Config) {
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	return srv, &tls.Config{RootCAs: roots, ServerName: "example.com"}
+}
+
+func startTestDoTServer(t *testing.T, handler dns.HandlerFunc) (string, *tls.Config) {
+	httpSrv, clientConfig := newTestTLSServer(t, http.NotFoundHandler())
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: httpSrv.TLS.Certificates})
+	require.NoError(t, err)
+
+	srv := &dns.Server{Listener: l, Net: "tcp-tls", Handler: handler}
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = srv.Shutdown()
+	})
+
+	return l.Addr().String(), clientConfig
+}
+
+func TestTLSTransport_PipelinesOnOneConnection(t *testing.T) {
+	var hits atomic.Int32
+	addr, clientConfig := startTestDoTServer(t, answerWith("10.0.0.1", &hits))
+
+	p, err := New(Options{Servers: []string{"tls://" + addr}, TLSConfig: clientConfig})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	tr := p.(*pool).upstreams[0].transport.(*tlsTransport)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			req := query("example.com.")
+			req.Id = uint16(i)
+			resp, err := p.Exchange(context.Background(), req)
+			if assert.NoError(t, err) {
+				assert.Equal(t, uint16(i), resp.Id)
+				assert.Len(t, resp.Answer, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(20), hits.Load())
+
+	tr.mu.Lock()
+	conn := tr.conn
+	tr.mu.Unlock()
+
+	_, err = p.Exchange(context.Background(), query("example.org."))
+	require.NoError(t, err)
+
+	tr.mu.Lock()
+	assert.Same(t, conn, tr.conn, "connection should be reused")
+	tr.mu.Unlock()
+}
+
+func TestTLSTransport_RedialsClosedConnection(t *testing.T) {
+	addr, clientConfig := startTestDoTServer(t, answerWith("10.0.0.1", nil))
+
+	tr, err := newTransport("tls://"+addr, time.Second, clientConfig)
+	require.NoError(t, err)
+	defer tr.close()
+
+	_, err = tr.exchange(context.Background(), query("example.com."))
+	require.NoError(t, err)
+
+	// Simulate the server dropping the idle connection.
+	tt := tr.(*tlsTransport)
+	tt.mu.Lock()
+	_ = tt.conn.conn.Close()
+	tt.mu.Unlock()
+
+	resp, err := tr.exchange(context.Background(), query("example.com."))
+	require.NoError(t, err)
+	assert.Len(t, resp.Answer, 1)
+}
+
+func TestHTTPSTransport(t *testing.T) {
+	var hits atomic.Int32
+	srv, clientConfig := newTestTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/dns-query", r.URL.Path)
+		assert.Equal(t, dohContentType, r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		req := new(dns.Msg)
+		require.NoError(t, req.Unpack(body))
+		assert.Equal(t, uint16(0), req.Id)
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 10.0.0.2")
+		m.Answer = append(m.Answer, rr)
+		out, _ := m.Pack()
+
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(out)
+	}))
+
+	p, err := New(Options{Servers: []string{srv.URL}, TLSConfig: clientConfig})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	req := query("example.com.")
+	req.Id = 4321
+	resp, err := p.Exchange(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(4321), resp.Id)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.2", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestHTTPSTransport_HTTPError(t *testing.T) {
+	srv, clientConfig := newTestTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	tr, err := newTransport(srv.URL, time.Second, clientConfig)
+	require.NoError(t, err)
+	defer tr.close()
+
+	_, err = tr.exchange(context.Background(), query("example.com."))
+	assert.ErrorContains(t, err, "502")
+}
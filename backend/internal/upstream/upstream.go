@@ -0,0 +1,321 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Strategy defines the order in which upstreams are tried for a query.
+type Strategy string
+
+const (
+	// StrategyStrict always tries upstreams in the configured order.
+	StrategyStrict Strategy = "strict"
+	// StrategyRoundRobin spreads queries across upstreams.
+	StrategyRoundRobin Strategy = "round_robin"
+	// StrategyFastest prefers the upstream with the lowest average latency.
+	StrategyFastest Strategy = "fastest"
+)
+
+const (
+	DefaultServer = "8.8.8.8:53"
+
+	defaultTimeout             = 2 * time.Second
+	defaultHealthCheckInterval = 30 * time.Second
+
+	// Consecutive failures after which an upstream is marked unhealthy until
+	// the next successful health check.
+	maxConsecutiveFailures = 3
+)
+
+var (
+	ErrNoUpstreams     = fmt.Errorf("no upstream servers configured")
+	ErrUnknownStrategy = fmt.Errorf("unknown upstream strategy")
+)
+
+type Options struct {
+	// Servers are plain host:port addresses (UDP) or udp://, tcp://, tls://
+	// and https:// URLs.
+	Servers             []string
+	Strategy            Strategy
+	Timeout             time.Duration
+	HealthCheckInterval time.Duration
+	// HealthCheckZone is the zone whose SOA the health checks ask for, so
+	// servers answering only for some zones, like those of forwarding rules,
+	// are not marked unhealthy. The root NS set is asked for when empty.
+	HealthCheckZone string
+	// TLSConfig is the base client configuration for tls:// and https://
+	// upstreams. The server name is taken from the URL when not set.
+	TLSConfig *tls.Config
+}
+
+// Stats is a snapshot of the counters of a single upstream.
+type Stats struct {
+	Address    string
+	Healthy    bool
+	Queries    uint64
+	Errors     uint64
+	AvgLatency time.Duration
+}
+
+type Pool interface {
+	Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error)
+	Stats() []Stats
+	Start()
+	Stop()
+}
+
+type upstream struct {
+	address   string
+	transport transport
+
+	healthy  atomic.Bool
+	failures atomic.Int32
+	queries  atomic.Uint64
+	errors   atomic.Uint64
+	// Exponentially weighted moving average of the latency, in nanoseconds.
+	latency atomic.Int64
+}
+
+type pool struct {
+	upstreams []*upstream
+	strategy  Strategy
+	timeout   time.Duration
+	interval  time.Duration
+	checkZone string
+
+	next     atomic.Uint64
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func New(opts Options) (Pool, error) {
+	if len(opts.Servers) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyStrict
+	}
+	switch opts.Strategy {
+	case StrategyStrict, StrategyRoundRobin, StrategyFastest:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, opts.Strategy)
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	p := &pool{
+		strategy:  opts.Strategy,
+		timeout:   opts.Timeout,
+		interval:  opts.HealthCheckInterval,
+		checkZone: opts.HealthCheckZone,
+		done:      make(chan struct{}),
+	}
+
+	for _, server := range opts.Servers {
+		t, err := newTransport(server, opts.Timeout, opts.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		u := &upstream{address: server, transport: t}
+		u.healthy.Store(true)
+		p.upstreams = append(p.upstreams, u)
+	}
+
+	return p, nil
+}
+
+// Exchange sends msg to the upstreams ordered by the pool strategy, failing
+// over to the next one on network errors, SERVFAIL or REFUSED.
+func (p *pool) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	var lastResp *dns.Msg
+	var lastErr error
+
+	for _, u := range p.candidates() {
+		resp, err := u.exchange(ctx, msg)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+			u.markFailure()
+			lastResp = resp
+			continue
+		}
+
+		return resp, nil
+	}
+
+	if lastResp != nil {
+		return lastResp, nil
+	}
+
+	return nil, fmt.Errorf("all upstreams failed: %w", lastErr)
+}
+
+func (p *pool) Stats() []Stats {
+	res := make([]Stats, len(p.upstreams))
+	for i, u := range p.upstreams {
+		res[i] = Stats{
+			Address:    u.address,
+			Healthy:    u.healthy.Load(),
+			Queries:    u.queries.Load(),
+			Errors:     u.errors.Load(),
+			AvgLatency: time.Duration(u.latency.Load()),
+		}
+	}
+
+	return res
+}
+
+func (p *pool) Start() {
+	go p.healthCheckLoop()
+}
+
+func (p *pool) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		for _, u := range p.upstreams {
+			u.transport.close()
+		}
+	})
+}
+
+// candidates returns the upstreams in the order they should be tried.
+// Unhealthy upstreams are kept at the end as a last resort.
+func (p *pool) candidates() []*upstream {
+	ordered := make([]*upstream, len(p.upstreams))
+
+	switch p.strategy {
+	case StrategyRoundRobin:
+		start := int((p.next.Add(1) - 1) % uint64(len(p.upstreams)))
+		for i := range p.upstreams {
+			ordered[i] = p.upstreams[(start+i)%len(p.upstreams)]
+		}
+	case StrategyFastest:
+		copy(ordered, p.upstreams)
+		// Upstreams without measurements yet sort first so they get one.
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].latency.Load() < ordered[j].latency.Load()
+		})
+	default:
+		copy(ordered, p.upstreams)
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].healthy.Load() && !ordered[j].healthy.Load()
+	})
+
+	return ordered
+}
+
+func (p *pool) healthCheckLoop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.checkAll()
+		for _, s := range p.Stats() {
+			log.Printf("Upstream %s: healthy=%t queries=%d errors=%d avg_latency=%s\n",
+				s.Address, s.Healthy, s.Queries, s.Errors, s.AvgLatency)
+		}
+	}
+}
+
+func (p *pool) checkAll() {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+			u.check(p.timeout, p.checkZone)
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (u *upstream) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	u.queries.Add(1)
+
+	start := time.Now()
+	resp, err := u.transport.exchange(ctx, msg)
+	if err != nil {
+		u.markFailure()
+		return nil, err
+	}
+
+	u.observe(time.Since(start))
+	u.failures.Store(0)
+	return resp, nil
+}
+
+// check queries the SOA of zone, or the root NS set when zone is empty, to
+// verify the upstream is answering.
+func (u *upstream) check(timeout time.Duration, zone string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg := new(dns.Msg)
+	if zone != "" {
+		msg.SetQuestion(dns.Fqdn(zone), dns.TypeSOA)
+	} else {
+		msg.SetQuestion(".", dns.TypeNS)
+	}
+
+	start := time.Now()
+	resp, err := u.transport.exchange(ctx, msg)
+	if err != nil || resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+		if u.healthy.Swap(false) {
+			log.Printf("Upstream %s is unhealthy\n", u.address)
+		}
+		return
+	}
+
+	u.observe(time.Since(start))
+	u.failures.Store(0)
+	if !u.healthy.Swap(true) {
+		log.Printf("Upstream %s is healthy again\n", u.address)
+	}
+}
+
+func (u *upstream) markFailure() {
+	u.errors.Add(1)
+	if u.failures.Add(1) >= maxConsecutiveFailures {
+		u.healthy.Store(false)
+	}
+}
+
+func (u *upstream) observe(d time.Duration) {
+	for {
+		old := u.latency.Load()
+		updated := int64(d)
+		if old != 0 {
+			updated = old + (int64(d)-old)/5
+		}
+		if u.latency.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
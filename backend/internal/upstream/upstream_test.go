@@ -0,0 +1,267 @@
+package upstream
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestServer serves handler over UDP and TCP on the same local port.
+func startTestServer(t *testing.T, handler dns.HandlerFunc) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	require.NoError(t, err)
+
+	for _, srv := range []*dns.Server{
+		{PacketConn: pc, Handler: handler},
+		{Listener: l, Handler: handler},
+	} {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go func() {
+			_ = srv.ActivateAndServe()
+		}()
+		<-started
+
+		t.Cleanup(func() {
+			_ = srv.Shutdown()
+		})
+	}
+
+	return pc.LocalAddr().String()
+}
+
+func answerWith(ip string, hits *atomic.Int32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		if hits != nil {
+			hits.Add(1)
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A " + ip)
+		m.Answer = append(m.Answer, rr)
+		_ = w.WriteMsg(m)
+	}
+}
+
+func rcodeHandler(rcode int, hits *atomic.Int32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		hits.Add(1)
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		_ = w.WriteMsg(m)
+	}
+}
+
+func query(name string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeA)
+	return m
+}
+
+func TestNew_Validation(t *testing.T) {
+	_, err := New(Options{})
+	assert.ErrorIs(t, err, ErrNoUpstreams)
+
+	_, err = New(Options{Servers: []string{"127.0.0.1:53"}, Strategy: "random"})
+	assert.ErrorIs(t, err, ErrUnknownStrategy)
+
+	p, err := New(Options{Servers: []string{"127.0.0.1:53"}})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyStrict, p.(*pool).strategy)
+}
+
+func TestPool_Exchange_FailoverOnServfail(t *testing.T) {
+	var firstHits, secondHits atomic.Int32
+	first := startTestServer(t, rcodeHandler(dns.RcodeServerFailure, &firstHits))
+	second := startTestServer(t, answerWith("10.0.0.2", &secondHits))
+
+	p, err := New(Options{Servers: []string{first, second}, Strategy: StrategyStrict})
+	require.NoError(t, err)
+
+	resp, err := p.Exchange(context.Background(), query("example.com."))
+	require.NoError(t, err)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.2", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(1), firstHits.Load())
+	assert.Equal(t, int32(1), secondHits.Load())
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(1), stats[0].Errors)
+	assert.Equal(t, uint64(0), stats[1].Errors)
+	assert.Greater(t, stats[1].AvgLatency, time.Duration(0))
+}
+
+func TestPool_Exchange_FailoverOnNetworkError(t *testing.T) {
+	// Nothing listens on the first address, so the exchange times out.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := pc.LocalAddr().String()
+	require.NoError(t, pc.Close())
+
+	alive := startTestServer(t, answerWith("10.0.0.1", nil))
+
+	p, err := New(Options{Servers: []string{dead, alive}, Timeout: 200 * time.Millisecond})
+	require.NoError(t, err)
+
+	resp, err := p.Exchange(context.Background(), query("example.com."))
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, uint64(1), p.Stats()[0].Errors)
+}
+
+func TestPool_Exchange_AllFail(t *testing.T) {
+	var hits atomic.Int32
+	srv := startTestServer(t, rcodeHandler(dns.RcodeRefused, &hits))
+
+	p, err := New(Options{Servers: []string{srv}})
+	require.NoError(t, err)
+
+	resp, err := p.Exchange(context.Background(), query("example.com."))
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+}
+
+func TestPool_Exchange_RetriesTruncatedOverTCP(t *testing.T) {
+	var udpHits, tcpHits atomic.Int32
+	srv := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if w.LocalAddr().Network() == "udp" {
+			udpHits.Add(1)
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Truncated = true
+			_ = w.WriteMsg(m)
+			return
+		}
+
+		tcpHits.Add(1)
+		answerWith("10.0.0.3", nil)(w, r)
+	})
+
+	p, err := New(Options{Servers: []string{srv}})
+	require.NoError(t, err)
+
+	resp, err := p.Exchange(context.Background(), query("large.example.com."))
+	require.NoError(t, err)
+	assert.False(t, resp.Truncated)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.3", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(1), udpHits.Load())
+	assert.Equal(t, int32(1), tcpHits.Load())
+}
+
+func TestPool_Exchange_RoundRobin(t *testing.T) {
+	var firstHits, secondHits atomic.Int32
+	first := startTestServer(t, answerWith("10.0.0.1", &firstHits))
+	second := startTestServer(t, answerWith("10.0.0.2", &secondHits))
+
+	p, err := New(Options{Servers: []string{first, second}, Strategy: StrategyRoundRobin})
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err := p.Exchange(context.Background(), query("example.com."))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(2), firstHits.Load())
+	assert.Equal(t, int32(2), secondHits.Load())
+}
+
+func TestPool_Exchange_Fastest(t *testing.T) {
+	var slowHits, fastHits atomic.Int32
+	slow := startTestServer(t, answerWith("10.0.0.1", &slowHits))
+	fast := startTestServer(t, answerWith("10.0.0.2", &fastHits))
+
+	p, err := New(Options{Servers: []string{slow, fast}, Strategy: StrategyFastest})
+	require.NoError(t, err)
+
+	impl := p.(*pool)
+	impl.upstreams[0].latency.Store(int64(50 * time.Millisecond))
+	impl.upstreams[1].latency.Store(int64(time.Millisecond))
+
+	resp, err := p.Exchange(context.Background(), query("example.com."))
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(0), slowHits.Load())
+}
+
+func TestPool_candidates_UnhealthyLast(t *testing.T) {
+	p, err := New(Options{Servers: []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"}})
+	require.NoError(t, err)
+
+	impl := p.(*pool)
+	impl.upstreams[0].healthy.Store(false)
+
+	ordered := impl.candidates()
+	assert.Equal(t, "127.0.0.1:2", ordered[0].address)
+	assert.Equal(t, "127.0.0.1:3", ordered[1].address)
+	assert.Equal(t, "127.0.0.1:1", ordered[2].address)
+}
+
+func TestUpstream_check(t *testing.T) {
+	var hits atomic.Int32
+	srv := startTestServer(t, rcodeHandler(dns.RcodeServerFailure, &hits))
+
+	p, err := New(Options{Servers: []string{srv}})
+	require.NoError(t, err)
+
+	impl := p.(*pool)
+	impl.checkAll()
+	assert.False(t, p.Stats()[0].Healthy)
+
+	healthy := startTestServer(t, answerWith("10.0.0.1", nil))
+	impl.upstreams[0].transport = newUDPTransport(healthy, time.Second)
+	impl.checkAll()
+	assert.True(t, p.Stats()[0].Healthy)
+}
+
+func TestUpstream_check_Zone(t *testing.T) {
+	questions := make(chan dns.Question, 2)
+	srv := startTestServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		questions <- r.Question[0]
+
+		// Like the servers of forwarding rules, only corp.internal is
+		// answered.
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name != "corp.internal." {
+			m.Rcode = dns.RcodeRefused
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	p, err := New(Options{Servers: []string{srv}})
+	require.NoError(t, err)
+	p.(*pool).checkAll()
+	assert.False(t, p.Stats()[0].Healthy)
+
+	p, err = New(Options{Servers: []string{srv}, HealthCheckZone: "corp.internal"})
+	require.NoError(t, err)
+	p.(*pool).checkAll()
+	assert.True(t, p.Stats()[0].Healthy)
+
+	assert.Equal(t, dns.Question{Name: ".", Qtype: dns.TypeNS, Qclass: dns.ClassINET}, <-questions)
+	assert.Equal(t, dns.Question{Name: "corp.internal.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET}, <-questions)
+}
+
+func TestUpstream_markFailure(t *testing.T) {
+	u := &upstream{address: "127.0.0.1:53"}
+	u.healthy.Store(true)
+
+	for i := 0; i < maxConsecutiveFailures-1; i++ {
+		u.markFailure()
+	}
+	assert.True(t, u.healthy.Load())
+
+	u.markFailure()
+	assert.False(t, u.healthy.Load())
+	assert.Equal(t, uint64(maxConsecutiveFailures), u.errors.Load())
+}
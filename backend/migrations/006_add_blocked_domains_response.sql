@@ -0,0 +1,9 @@
+ALTER TABLE blocked_domains ADD COLUMN response VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE blocked_domains ADD COLUMN sinkhole_ipv4 VARCHAR(15) NOT NULL DEFAULT '';
+ALTER TABLE blocked_domains ADD COLUMN sinkhole_ipv6 VARCHAR(45) NOT NULL DEFAULT '';
+
+---- create above / drop below ----
+
+ALTER TABLE blocked_domains DROP COLUMN response;
+ALTER TABLE blocked_domains DROP COLUMN sinkhole_ipv4;
+ALTER TABLE blocked_domains DROP COLUMN sinkhole_ipv6;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS allowed_domains (
+    id SERIAL PRIMARY KEY,
+    domain VARCHAR(255) NOT NULL,
+    recursive BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS allowed_domains;
@@ -0,0 +1,7 @@
+ALTER TABLE blocked_domains ADD COLUMN kind VARCHAR(8) NOT NULL DEFAULT 'domain';
+ALTER TABLE blocked_domains ADD COLUMN qtypes TEXT[] NOT NULL DEFAULT '{}';
+
+---- create above / drop below ----
+
+ALTER TABLE blocked_domains DROP COLUMN kind;
+ALTER TABLE blocked_domains DROP COLUMN qtypes;
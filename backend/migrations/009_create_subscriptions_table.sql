@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL UNIQUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    rules_count INTEGER NOT NULL DEFAULT 0,
+    last_synced_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+ALTER TABLE blocked_domains ADD COLUMN subscription_id INTEGER REFERENCES subscriptions (id) ON DELETE CASCADE;
+ALTER TABLE allowed_domains ADD COLUMN subscription_id INTEGER REFERENCES subscriptions (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS blocked_domains_subscription_id_idx ON blocked_domains (subscription_id);
+CREATE INDEX IF NOT EXISTS allowed_domains_subscription_id_idx ON allowed_domains (subscription_id);
+
+---- create above / drop below ----
+
+ALTER TABLE allowed_domains DROP COLUMN subscription_id;
+ALTER TABLE blocked_domains DROP COLUMN subscription_id;
+
+DROP TABLE IF EXISTS subscriptions;
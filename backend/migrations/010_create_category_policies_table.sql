@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS category_policies (
+    id SERIAL PRIMARY KEY,
+    category VARCHAR(255) NOT NULL UNIQUE,
+    blocked BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS category_policies;
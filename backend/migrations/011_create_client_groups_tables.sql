@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS client_groups (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    upstreams TEXT[] NOT NULL DEFAULT '{}',
+    blocked_categories TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS clients (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES client_groups (id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    kind VARCHAR(16) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+ALTER TABLE blocked_domains ADD COLUMN group_id INTEGER REFERENCES client_groups (id) ON DELETE CASCADE;
+ALTER TABLE allowed_domains ADD COLUMN group_id INTEGER REFERENCES client_groups (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS clients_group_id_idx ON clients (group_id);
+CREATE INDEX IF NOT EXISTS blocked_domains_group_id_idx ON blocked_domains (group_id);
+CREATE INDEX IF NOT EXISTS allowed_domains_group_id_idx ON allowed_domains (group_id);
+
+---- create above / drop below ----
+
+ALTER TABLE allowed_domains DROP COLUMN group_id;
+ALTER TABLE blocked_domains DROP COLUMN group_id;
+
+DROP TABLE IF EXISTS clients;
+DROP TABLE IF EXISTS client_groups;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS schedules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    days TEXT[] NOT NULL DEFAULT '{}',
+    windows TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+ALTER TABLE blocked_domains ADD COLUMN schedule_id INTEGER REFERENCES schedules (id);
+ALTER TABLE category_policies ADD COLUMN schedule_id INTEGER REFERENCES schedules (id);
+ALTER TABLE client_groups ADD COLUMN schedule_id INTEGER REFERENCES schedules (id);
+
+CREATE INDEX IF NOT EXISTS blocked_domains_schedule_id_idx ON blocked_domains (schedule_id);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS blocked_domains_schedule_id_idx;
+
+ALTER TABLE client_groups DROP COLUMN schedule_id;
+ALTER TABLE category_policies DROP COLUMN schedule_id;
+ALTER TABLE blocked_domains DROP COLUMN schedule_id;
+
+DROP TABLE IF EXISTS schedules;
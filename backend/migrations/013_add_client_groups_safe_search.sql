@@ -0,0 +1,5 @@
+ALTER TABLE client_groups ADD COLUMN safe_search BOOLEAN;
+
+---- create above / drop below ----
+
+ALTER TABLE client_groups DROP COLUMN safe_search;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS local_records (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    value TEXT NOT NULL,
+    ttl INTEGER NOT NULL DEFAULT 300,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS local_records_name_idx ON local_records (name);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS local_records;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS client_stats_aggregated (
+  id SERIAL PRIMARY KEY,
+  time TIMESTAMPTZ NOT NULL,
+  client VARCHAR(45) NOT NULL,
+  count INTEGER NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (time, client)
+);
+
+CREATE TABLE IF NOT EXISTS client_hostnames (
+  client VARCHAR(45) PRIMARY KEY,
+  hostname VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS client_hostnames;
+DROP TABLE IF EXISTS client_stats_aggregated;
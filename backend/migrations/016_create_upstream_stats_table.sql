@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS upstream_stats (
+  id SERIAL PRIMARY KEY,
+  pool VARCHAR(255) NOT NULL,
+  address VARCHAR(255) NOT NULL,
+  healthy BOOLEAN NOT NULL,
+  queries BIGINT NOT NULL,
+  errors BIGINT NOT NULL,
+  avg_latency_ms DOUBLE PRECISION NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS upstream_stats;
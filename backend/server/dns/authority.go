@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/authority"
+)
+
+// transferChunk is how many records are sent in each AXFR message.
+const transferChunk = 100
+
+// newAuthority returns the configured authoritative zones, or nil when
+// there are none.
+func newAuthority(cfg *config.Config) (authority.Authority, error) {
+	if len(cfg.DNS.Authoritative.Zones) == 0 {
+		return nil, nil
+	}
+
+	var opts authority.Options
+	for _, z := range cfg.DNS.Authoritative.Zones {
+		opts.Zones = append(opts.Zones, authority.ZoneOptions{
+			Name:          z.Name,
+			File:          z.File,
+			AllowTransfer: z.AllowTransfer,
+		})
+	}
+
+	return authority.New(opts)
+}
+
+// authoritativeReply returns the answer to req from the authoritative
+// zones, if it is within one.
+func (d *DNS) authoritativeReply(req *dns.Msg) (*dns.Msg, bool) {
+	if d.authority == nil {
+		return nil, false
+	}
+
+	return d.authority.Answer(req)
+}
+
+// isTransfer reports whether msg asks for a zone transfer.
+func isTransfer(msg *dns.Msg) bool {
+	if len(msg.Question) != 1 {
+		return false
+	}
+
+	qtype := msg.Question[0].Qtype
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
+
+// handleTransfer sends an authoritative zone to a secondary allowed to
+// transfer it. Transfers only run over TCP; IXFR is answered with the full
+// zone, as RFC 1995 allows.
+func (d *DNS) handleTransfer(rw dns.ResponseWriter, msg *dns.Msg) {
+	q := msg.Question[0]
+
+	var from netip.Addr
+	addr, tcp := rw.RemoteAddr().(*net.TCPAddr)
+	if _, ok := rw.(*dohResponseWriter); ok {
+		tcp = false
+	}
+	if tcp {
+		from, _ = netip.AddrFromSlice(addr.IP)
+	}
+
+	var rrs []dns.RR
+	err := fmt.Errorf("transfers require TCP")
+	if tcp && d.authority != nil {
+		rrs, err = d.authority.Transfer(q.Name, from)
+	}
+	if err != nil {
+		fmt.Println("Refused transfer of", q.Name, "to", rw.RemoteAddr(), ":", err)
+		resp := new(dns.Msg)
+		resp.SetRcode(msg, dns.RcodeRefused)
+		writeResponse(rw, msg, resp)
+		return
+	}
+
+	fmt.Println("Transferring zone", q.Name, "to", from)
+
+	// The channel holds every envelope, so Out never leaves a sender
+	// blocked when the secondary goes away mid-transfer.
+	ch := make(chan *dns.Envelope, (len(rrs)+transferChunk-1)/transferChunk)
+	for i := 0; i < len(rrs); i += transferChunk {
+		ch <- &dns.Envelope{RR: rrs[i:min(i+transferChunk, len(rrs))]}
+	}
+	close(ch)
+
+	tr := new(dns.Transfer)
+	if err := tr.Out(rw, msg, ch); err != nil {
+		log.Printf("Failed to transfer zone %s to %s: %s\n", q.Name, from, err.Error())
+	}
+}
@@ -0,0 +1,131 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/authority"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+)
+
+// transferResponseWriter keeps every message written, as transfers span
+// several of them.
+type transferResponseWriter struct {
+	testResponseWriter
+	msgs []*dns.Msg
+}
+
+func (w *transferResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msgs = append(w.msgs, m)
+	return nil
+}
+
+func createTestDNSWithAuthority(t *testing.T, extra string) *DNS {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "corp.internal.zone")
+	require.NoError(t, os.WriteFile(file, []byte(`$TTL 3600
+@   IN SOA ns1.corp.internal. admin.corp.internal. 1 3600 600 86400 300
+@   IN NS  ns1
+ns1 IN A   10.0.0.53
+www IN A   10.0.0.80
+`+extra), 0o600))
+
+	zones, err := authority.New(authority.Options{Zones: []authority.ZoneOptions{
+		{Name: "corp.internal", File: file, AllowTransfer: []string{"192.168.0.0/24"}},
+	}})
+	require.NoError(t, err)
+
+	dnsHandler := createTestDNS()
+	dnsHandler.authority = zones
+	return dnsHandler
+}
+
+func TestDNS_handleRequest_Authoritative(t *testing.T) {
+	dnsHandler := createTestDNSWithAuthority(t, "")
+	upstreams := dnsHandler.upstreams.(*testUpstream)
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		rw := newUDPResponseWriter()
+		dnsHandler.handleRequest()(rw, req)
+		require.NotNil(t, rw.msg)
+		return rw.msg
+	}
+
+	resp := query("www.corp.internal.")
+	assert.True(t, resp.Authoritative)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.80", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("missing.corp.internal.")
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	require.Len(t, resp.Ns, 1)
+	assert.IsType(t, &dns.SOA{}, resp.Ns[0])
+	assert.Equal(t, int32(0), upstreams.hits.Load())
+
+	// Other names are still resolved upstream.
+	resp = query("example.com.")
+	assert.False(t, resp.Authoritative)
+	assert.Equal(t, int32(1), upstreams.hits.Load())
+
+	// Authoritative names are not blocked as uncategorized.
+	dnsHandler.blockUncategorized = true
+	testCategoryIndex(dnsHandler)
+	assert.Equal(t, "10.0.0.80", query("www.corp.internal.").Answer[0].(*dns.A).A.String())
+	assert.Equal(t, dns.RcodeNameError, query("missing.corp.internal.").Rcode)
+
+	// Blocks still apply to authoritative names.
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{{ID: 1, Domain: "www.corp.internal"}})
+	assert.True(t, query("www.corp.internal.").Answer[0].(*dns.A).A.Equal(net.IPv4zero))
+}
+
+func TestDNS_handleTransfer(t *testing.T) {
+	var extra string
+	for i := 0; i < 150; i++ {
+		extra += fmt.Sprintf("host%d IN A 10.0.1.1\n", i)
+	}
+	dnsHandler := createTestDNSWithAuthority(t, extra)
+
+	req := new(dns.Msg)
+	req.SetQuestion("corp.internal.", dns.TypeAXFR)
+
+	rw := &transferResponseWriter{testResponseWriter: *newTCPResponseWriter()}
+	dnsHandler.handleRequest()(rw, req)
+	require.Len(t, rw.msgs, 2)
+
+	var rrs []dns.RR
+	for _, m := range rw.msgs {
+		assert.True(t, m.Authoritative)
+		rrs = append(rrs, m.Answer...)
+	}
+	require.Len(t, rrs, 155)
+	assert.IsType(t, &dns.SOA{}, rrs[0])
+	assert.IsType(t, &dns.SOA{}, rrs[len(rrs)-1])
+
+	// Transfers need TCP and an allowed address.
+	for _, remote := range []net.Addr{
+		&net.UDPAddr{IP: net.ParseIP("192.168.0.10"), Port: 5353},
+		&net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353},
+	} {
+		rw = &transferResponseWriter{testResponseWriter: testResponseWriter{remote: remote}}
+		dnsHandler.handleRequest()(rw, req)
+		require.Len(t, rw.msgs, 1)
+		assert.Equal(t, dns.RcodeRefused, rw.msgs[0].Rcode)
+	}
+
+	// Zones not served here are refused too.
+	req.SetQuestion("example.com.", dns.TypeAXFR)
+	rw = &transferResponseWriter{testResponseWriter: *newTCPResponseWriter()}
+	dnsHandler.handleRequest()(rw, req)
+	require.Len(t, rw.msgs, 1)
+	assert.Equal(t, dns.RcodeRefused, rw.msgs[0].Rcode)
+}
@@ -0,0 +1,288 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+const defaultBlockTTL = 10 * time.Second
+
+var (
+	ErrInvalidBlockResponse = fmt.Errorf("invalid block response")
+	ErrInvalidBlockRule     = fmt.Errorf("invalid block rule")
+)
+
+// blockResponse describes how a blocked query is answered.
+type blockResponse struct {
+	mode string
+	ipv4 net.IP
+	ipv6 net.IP
+	ttl  uint32
+}
+
+// blockRule is a blocked domain together with the response its matches get.
+type blockRule struct {
+	blockeddomains.BlockedDomain
+	response blockResponse
+	// pattern matches normalized names for glob and regex rules.
+	pattern *regexp.Regexp
+	qtypes  []uint16
+}
+
+// matches reports whether the rule applies to a query for name from a
+// client of group, zero for clients without a group, while its schedule is
+// active. name must be normalized and already fall under the rule's domain
+// for domain rules.
+func (r blockRule) matches(group int64, name string, qtype uint16, active activeFunc) bool {
+	if r.GroupID != nil && *r.GroupID != group {
+		return false
+	}
+
+	if !active(r.ScheduleID) {
+		return false
+	}
+
+	if len(r.qtypes) > 0 && !slices.Contains(r.qtypes, qtype) {
+		return false
+	}
+
+	return r.pattern == nil || r.pattern.MatchString(name)
+}
+
+// blocklist indexes block rules. Domain rules and glob rules live in a trie
+// under their domain or the literal suffix of the glob; regex rules and
+// globs without a literal suffix are tried in order afterwards.
+type blocklist struct {
+	trie    *matcher.Trie[[]blockRule]
+	regexes []blockRule
+	rules   int
+}
+
+func newBlocklist() *blocklist {
+	return &blocklist{trie: matcher.New[[]blockRule]()}
+}
+
+func (b *blocklist) add(rule blockRule) {
+	b.rules++
+
+	var suffix string
+	subdomains := rule.Recursive
+	switch rule.Kind {
+	case blockeddomains.KindRegex:
+		b.regexes = append(b.regexes, rule)
+		return
+	case blockeddomains.KindGlob:
+		suffix, subdomains = matcher.GlobSuffix(rule.Domain), true
+		if suffix == "" {
+			b.regexes = append(b.regexes, rule)
+			return
+		}
+	default:
+		suffix = rule.Domain
+	}
+
+	rules, _ := b.trie.Get(suffix, subdomains)
+	b.trie.Insert(suffix, subdomains, append(rules, rule))
+}
+
+// match returns the most specific rule blocking a query for name and qtype
+// from a client of group, among those whose schedule is active.
+func (b *blocklist) match(group int64, name string, qtype uint16, active activeFunc) (blockRule, bool) {
+	name = matcher.Normalize(name)
+
+	var res blockRule
+	var found bool
+	b.trie.Walk(name, func(rules []blockRule) bool {
+		for _, rule := range rules {
+			if rule.matches(group, name, qtype, active) {
+				res, found = rule, true
+				return false
+			}
+		}
+		return true
+	})
+	if found {
+		return res, true
+	}
+
+	for _, rule := range b.regexes {
+		if rule.matches(group, name, qtype, active) {
+			return rule, true
+		}
+	}
+
+	return blockRule{}, false
+}
+
+func newBlockResponse(cfg *config.Config) (blockResponse, error) {
+	ttl := cfg.DNS.Blocking.TTL
+	if ttl == 0 {
+		ttl = defaultBlockTTL
+	}
+
+	def := blockResponse{mode: blockeddomains.ResponseNullIP, ttl: uint32(ttl.Seconds())}
+	return def.override(cfg.DNS.Blocking.Response, cfg.DNS.Blocking.SinkholeIPv4, cfg.DNS.Blocking.SinkholeIPv6)
+}
+
+// override returns b with the non-empty settings replaced.
+func (b blockResponse) override(mode, ipv4, ipv6 string) (blockResponse, error) {
+	if mode != "" {
+		b.mode = mode
+	}
+
+	if ipv4 != "" {
+		ip := net.ParseIP(ipv4)
+		if ip == nil || ip.To4() == nil {
+			return b, fmt.Errorf("%w: sinkhole ipv4 %q", ErrInvalidBlockResponse, ipv4)
+		}
+		b.ipv4 = ip.To4()
+	}
+
+	if ipv6 != "" {
+		ip := net.ParseIP(ipv6)
+		if ip == nil || ip.To4() != nil {
+			return b, fmt.Errorf("%w: sinkhole ipv6 %q", ErrInvalidBlockResponse, ipv6)
+		}
+		b.ipv6 = ip
+	}
+
+	switch b.mode {
+	case blockeddomains.ResponseNXDomain, blockeddomains.ResponseRefused, blockeddomains.ResponseNoData,
+		blockeddomains.ResponseNullIP:
+	case blockeddomains.ResponseSinkhole:
+		if b.ipv4 == nil && b.ipv6 == nil {
+			return b, fmt.Errorf("%w: sinkhole without addresses", ErrInvalidBlockResponse)
+		}
+	default:
+		return b, fmt.Errorf("%w: unknown response %q", ErrInvalidBlockResponse, b.mode)
+	}
+
+	return b, nil
+}
+
+// reply builds the answer to req, blocked by a rule for zone. Only the first
+// question is answered, messages without one get FORMERR.
+func (b blockResponse) reply(req *dns.Msg, zone string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+
+	if len(req.Question) == 0 {
+		m.Rcode = dns.RcodeFormatError
+		return m
+	}
+
+	q := req.Question[0]
+	switch b.mode {
+	case blockeddomains.ResponseNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case blockeddomains.ResponseRefused:
+		m.Rcode = dns.RcodeRefused
+	case blockeddomains.ResponseNullIP:
+		m.Answer = b.address(q, net.IPv4zero, net.IPv6zero)
+	case blockeddomains.ResponseSinkhole:
+		m.Answer = b.address(q, b.ipv4, b.ipv6)
+	}
+
+	// Negative answers carry a SOA so clients cache them for the block TTL.
+	if m.Rcode == dns.RcodeNameError || (m.Rcode == dns.RcodeSuccess && len(m.Answer) == 0) {
+		m.Ns = []dns.RR{b.soa(zone)}
+	}
+
+	// OPT records are only sent to clients that used EDNS themselves.
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+		respOpt := m.IsEdns0()
+		respOpt.Option = append(respOpt.Option, &dns.EDNS0_EDE{
+			InfoCode:  dns.ExtendedErrorCodeBlocked,
+			ExtraText: "blocked by " + zone,
+		})
+	}
+
+	return m
+}
+
+// address answers A and AAAA questions with ipv4 and ipv6. Other types, or
+// a family without an address, get NODATA.
+func (b blockResponse) address(q dns.Question, ipv4, ipv6 net.IP) []dns.RR {
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: b.ttl}
+
+	switch {
+	case q.Qtype == dns.TypeA && ipv4 != nil:
+		return []dns.RR{&dns.A{Hdr: hdr, A: ipv4}}
+	case q.Qtype == dns.TypeAAAA && ipv6 != nil:
+		return []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: ipv6}}
+	}
+
+	return nil
+}
+
+func (b blockResponse) soa(zone string) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: b.ttl},
+		Ns:      "localhost.",
+		Mbox:    "nobody.invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  b.ttl,
+	}
+}
+
+// newBlockRule compiles bd and resolves its response against the server
+// default. Rules with invalid responses fall back to the default, rules with
+// invalid patterns or query types are rejected.
+func (d *DNS) newBlockRule(bd blockeddomains.BlockedDomain) (blockRule, error) {
+	rule := blockRule{BlockedDomain: bd, response: d.blockResponse}
+
+	if response, err := d.blockResponse.override(bd.Response, bd.SinkholeIPv4, bd.SinkholeIPv6); err != nil {
+		fmt.Printf("Blocked domain %s: %s, using the default response\n", bd.Domain, err)
+	} else {
+		rule.response = response
+	}
+
+	var err error
+	switch bd.Kind {
+	case "", blockeddomains.KindDomain:
+	case blockeddomains.KindGlob:
+		rule.pattern, err = matcher.CompileGlob(bd.Domain, bd.Recursive)
+	case blockeddomains.KindRegex:
+		rule.pattern, err = matcher.CompileRegexp(bd.Domain)
+	default:
+		err = fmt.Errorf("%w: unknown kind %q", ErrInvalidBlockRule, bd.Kind)
+	}
+	if err != nil {
+		return rule, err
+	}
+
+	for _, name := range bd.QTypes {
+		qtype, ok := dns.StringToType[strings.ToUpper(name)]
+		if !ok {
+			return rule, fmt.Errorf("%w: unknown query type %q", ErrInvalidBlockRule, name)
+		}
+		rule.qtypes = append(rule.qtypes, qtype)
+	}
+
+	return rule, nil
+}
+
+// zone is the owner of the SOA record in negative answers to name. Domain
+// rules answer for their domain, pattern rules for the name itself.
+func (r blockRule) zone(name string) string {
+	if r.pattern != nil {
+		return dns.Fqdn(matcher.Normalize(name))
+	}
+
+	return dns.Fqdn(matcher.Normalize(r.Domain))
+}
@@ -0,0 +1,290 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+)
+
+func blockedEDE(t *testing.T, m *dns.Msg) *dns.EDNS0_EDE {
+	t.Helper()
+
+	opt := m.IsEdns0()
+	require.NotNil(t, opt)
+	for _, o := range opt.Option {
+		if ede, ok := o.(*dns.EDNS0_EDE); ok {
+			return ede
+		}
+	}
+
+	require.Fail(t, "no extended DNS error")
+	return nil
+}
+
+func TestBlockResponse_Reply(t *testing.T) {
+	def := blockResponse{mode: blockeddomains.ResponseNullIP, ttl: 30}
+	sinkhole, err := def.override(blockeddomains.ResponseSinkhole, "192.0.2.1", "2001:db8::1")
+	require.NoError(t, err)
+	sinkholeV4, err := def.override(blockeddomains.ResponseSinkhole, "192.0.2.1", "")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		response blockResponse
+		qtype    uint16
+		rcode    int
+		answer   string
+		soa      bool
+	}{
+		{"null ip A", def, dns.TypeA, dns.RcodeSuccess, "0.0.0.0", false},
+		{"null ip AAAA", def, dns.TypeAAAA, dns.RcodeSuccess, "::", false},
+		{"null ip MX", def, dns.TypeMX, dns.RcodeSuccess, "", true},
+		{"null ip HTTPS", def, dns.TypeHTTPS, dns.RcodeSuccess, "", true},
+		{"sinkhole A", sinkhole, dns.TypeA, dns.RcodeSuccess, "192.0.2.1", false},
+		{"sinkhole AAAA", sinkhole, dns.TypeAAAA, dns.RcodeSuccess, "2001:db8::1", false},
+		{"sinkhole without ipv6", sinkholeV4, dns.TypeAAAA, dns.RcodeSuccess, "", true},
+		{"nxdomain", blockResponse{mode: blockeddomains.ResponseNXDomain, ttl: 30}, dns.TypeA, dns.RcodeNameError, "", true},
+		{"nodata", blockResponse{mode: blockeddomains.ResponseNoData, ttl: 30}, dns.TypeA, dns.RcodeSuccess, "", true},
+		{"refused", blockResponse{mode: blockeddomains.ResponseRefused, ttl: 30}, dns.TypeA, dns.RcodeRefused, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion("ads.example.com.", tc.qtype)
+			req.SetEdns0(1232, false)
+
+			m := tc.response.reply(req, "example.com.")
+
+			assert.Equal(t, req.Id, m.Id)
+			assert.True(t, m.Response)
+			assert.True(t, m.RecursionAvailable)
+			assert.Equal(t, tc.rcode, m.Rcode)
+
+			if tc.answer == "" {
+				assert.Empty(t, m.Answer)
+			} else {
+				require.Len(t, m.Answer, 1)
+				hdr := m.Answer[0].Header()
+				assert.Equal(t, "ads.example.com.", hdr.Name)
+				assert.Equal(t, tc.qtype, hdr.Rrtype)
+				assert.Equal(t, uint32(30), hdr.Ttl)
+
+				switch rr := m.Answer[0].(type) {
+				case *dns.A:
+					assert.Equal(t, tc.answer, rr.A.String())
+				case *dns.AAAA:
+					assert.Equal(t, tc.answer, rr.AAAA.String())
+				}
+			}
+
+			if tc.soa {
+				require.Len(t, m.Ns, 1)
+				soa := m.Ns[0].(*dns.SOA)
+				assert.Equal(t, "example.com.", soa.Hdr.Name)
+				assert.Equal(t, uint32(30), soa.Minttl)
+			} else {
+				assert.Empty(t, m.Ns)
+			}
+
+			ede := blockedEDE(t, m)
+			assert.Equal(t, dns.ExtendedErrorCodeBlocked, ede.InfoCode)
+		})
+	}
+}
+
+func TestBlockResponse_Reply_NoEDNS(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("ads.example.com.", dns.TypeA)
+
+	m := blockResponse{mode: blockeddomains.ResponseNXDomain, ttl: 30}.reply(req, "example.com.")
+
+	assert.Equal(t, dns.RcodeNameError, m.Rcode)
+	assert.Nil(t, m.IsEdns0())
+}
+
+func TestBlockResponse_Reply_NoQuestion(t *testing.T) {
+	m := blockResponse{mode: blockeddomains.ResponseNullIP, ttl: 30}.reply(new(dns.Msg), "example.com.")
+
+	assert.Equal(t, dns.RcodeFormatError, m.Rcode)
+	assert.Empty(t, m.Answer)
+}
+
+func TestNewBlockResponse(t *testing.T) {
+	cfg := &config.Config{}
+	b, err := newBlockResponse(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, blockeddomains.ResponseNullIP, b.mode)
+	assert.Equal(t, uint32(defaultBlockTTL.Seconds()), b.ttl)
+
+	cfg.DNS.Blocking.Response = blockeddomains.ResponseNXDomain
+	cfg.DNS.Blocking.TTL = time.Minute
+	b, err = newBlockResponse(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, blockeddomains.ResponseNXDomain, b.mode)
+	assert.Equal(t, uint32(60), b.ttl)
+
+	invalid := []struct {
+		response, ipv4, ipv6 string
+	}{
+		{"drop", "", ""},
+		{blockeddomains.ResponseSinkhole, "", ""},
+		{blockeddomains.ResponseSinkhole, "2001:db8::1", ""},
+		{blockeddomains.ResponseSinkhole, "", "192.0.2.1"},
+		{blockeddomains.ResponseSinkhole, "not-an-ip", ""},
+	}
+	for _, tc := range invalid {
+		cfg.DNS.Blocking.Response = tc.response
+		cfg.DNS.Blocking.SinkholeIPv4 = tc.ipv4
+		cfg.DNS.Blocking.SinkholeIPv6 = tc.ipv6
+		_, err = newBlockResponse(cfg)
+		assert.ErrorIs(t, err, ErrInvalidBlockResponse, tc)
+	}
+}
+
+func TestDNS_newBlockRule(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.blockResponse = blockResponse{
+		mode: blockeddomains.ResponseSinkhole,
+		ipv4: []byte{192, 0, 2, 1},
+		ttl:  10,
+	}
+
+	rule, err := dnsHandler.newBlockRule(blockeddomains.BlockedDomain{Domain: "a.com"})
+	require.NoError(t, err)
+	assert.Equal(t, dnsHandler.blockResponse, rule.response)
+
+	rule, err = dnsHandler.newBlockRule(blockeddomains.BlockedDomain{
+		Domain:   "b.com",
+		Response: blockeddomains.ResponseRefused,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blockeddomains.ResponseRefused, rule.response.mode)
+
+	// Per rule addresses replace the default sinkhole.
+	rule, err = dnsHandler.newBlockRule(blockeddomains.BlockedDomain{Domain: "c.com", SinkholeIPv4: "198.51.100.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.1", rule.response.ipv4.String())
+
+	// Invalid settings fall back to the default.
+	rule, err = dnsHandler.newBlockRule(blockeddomains.BlockedDomain{Domain: "d.com", Response: "bogus"})
+	require.NoError(t, err)
+	assert.Equal(t, dnsHandler.blockResponse, rule.response)
+
+	rule, err = dnsHandler.newBlockRule(blockeddomains.BlockedDomain{Domain: "e.com", QTypes: []string{"a", "HTTPS"}})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{dns.TypeA, dns.TypeHTTPS}, rule.qtypes)
+}
+
+func TestDNS_newBlockRule_Invalid(t *testing.T) {
+	dnsHandler := createTestDNS()
+
+	for _, bd := range []blockeddomains.BlockedDomain{
+		{Domain: "e.com", Kind: "wildcard"},
+		{Domain: "e.com", QTypes: []string{"BOGUS"}},
+		{Domain: "track[0-9]+", Kind: blockeddomains.KindRegex},
+		{Domain: "^(track", Kind: blockeddomains.KindRegex},
+		{Domain: "^((a{100}){100}){100}$", Kind: blockeddomains.KindRegex},
+	} {
+		_, err := dnsHandler.newBlockRule(bd)
+		assert.Error(t, err, bd.Domain)
+	}
+}
+
+func TestDNS_blockedBy_Patterns(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "ads*.example.com", Kind: blockeddomains.KindGlob},
+		{ID: 2, Domain: `^track[0-9]+\.`, Kind: blockeddomains.KindRegex},
+		{ID: 3, Domain: "video.example.org", Recursive: true, QTypes: []string{"HTTPS", "AAAA"}},
+		{ID: 4, Domain: "ads.*", Kind: blockeddomains.KindGlob},
+		{ID: 5, Domain: "^(broken", Kind: blockeddomains.KindRegex},
+	})
+	assert.Equal(t, 4, dnsHandler.blocklist.Load().rules)
+
+	testCases := []struct {
+		name  string
+		qtype uint16
+		rule  int64
+	}{
+		{"ads.example.com.", dns.TypeA, 1},
+		{"ads42.example.com.", dns.TypeAAAA, 1},
+		{"x.ads42.example.com.", dns.TypeA, 0},
+		{"pads.example.com.", dns.TypeA, 0},
+		{"track7.example.net.", dns.TypeA, 2},
+		{"TRACK7.example.net.", dns.TypeMX, 2},
+		{"tracker.example.net.", dns.TypeA, 0},
+		{"cdn.video.example.org.", dns.TypeHTTPS, 3},
+		{"video.example.org.", dns.TypeAAAA, 3},
+		{"cdn.video.example.org.", dns.TypeA, 0},
+		{"ads.net.", dns.TypeA, 4},
+		{"ads.example.net.", dns.TypeA, 0},
+		{"broken.example.com.", dns.TypeA, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ok := dnsHandler.blockedBy(nil, tc.name, tc.qtype)
+			assert.Equal(t, tc.rule != 0, ok)
+			assert.Equal(t, tc.rule, rule.ID)
+		})
+	}
+}
+
+func TestDNS_blockedBy_QTypeFallsBackToBroaderRule(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "example.com", Recursive: true},
+		{ID: 2, Domain: "example.com", Recursive: true, QTypes: []string{"AAAA"}, Response: "nxdomain"},
+		{ID: 3, Domain: "www.example.com", QTypes: []string{"HTTPS"}},
+	})
+
+	rule, ok := dnsHandler.blockedBy(nil, "example.com.", dns.TypeAAAA)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), rule.ID)
+
+	rule, ok = dnsHandler.blockedBy(nil, "www.example.com.", dns.TypeHTTPS)
+	require.True(t, ok)
+	assert.Equal(t, int64(3), rule.ID)
+
+	rule, ok = dnsHandler.blockedBy(nil, "www.example.com.", dns.TypeA)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), rule.ID)
+}
+
+func TestBlockRule_zone(t *testing.T) {
+	dnsHandler := createTestDNS()
+
+	rule, err := dnsHandler.newBlockRule(blockeddomains.BlockedDomain{Domain: ".Ads.example.com", Recursive: true})
+	require.NoError(t, err)
+	assert.Equal(t, "ads.example.com.", rule.zone("x.ads.example.com."))
+
+	rule, err = dnsHandler.newBlockRule(blockeddomains.BlockedDomain{Domain: "ads*.example.com", Kind: "glob"})
+	require.NoError(t, err)
+	assert.Equal(t, "ads1.example.com.", rule.zone("ADS1.example.com."))
+}
+
+func TestDNS_handleRequest_BlockedPerRuleResponse(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: ".Tracker.example.com.", Recursive: true, Response: blockeddomains.ResponseNXDomain},
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("pixel.tracker.example.com.", dns.TypeAAAA)
+	req.SetEdns0(1232, false)
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	assert.Equal(t, dns.RcodeNameError, rw.msg.Rcode)
+	require.Len(t, rw.msg.Ns, 1)
+	assert.Equal(t, "tracker.example.com.", rw.msg.Ns[0].Header().Name)
+	assert.Equal(t, "blocked by tracker.example.com.", blockedEDE(t, rw.msg).ExtraText)
+}
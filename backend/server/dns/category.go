@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+const (
+	uncategorizedAllow = "allow"
+	uncategorizedBlock = "block"
+)
+
+var ErrInvalidUncategorized = fmt.Errorf("invalid dns.categories.uncategorized")
+
+// categoryIndex maps normalized domains to their categories, along with
+// the categories that are blocked and the schedule of their block, nil when
+// it always applies.
+type categoryIndex struct {
+	domains map[string][]string
+	blocked map[string]*int64
+}
+
+// lookup returns the categories of name or, when it has none, of its closest
+// categorized parent.
+func (idx *categoryIndex) lookup(name string) ([]string, bool) {
+	name = matcher.Normalize(name)
+	for {
+		if cats, ok := idx.domains[name]; ok {
+			return cats, true
+		}
+
+		_, parent, ok := strings.Cut(name, ".")
+		if !ok {
+			return nil, false
+		}
+		name = parent
+	}
+}
+
+func blockUncategorized(cfg *config.Config) (bool, error) {
+	switch cfg.DNS.Categories.Uncategorized {
+	case "", uncategorizedAllow:
+		return false, nil
+	case uncategorizedBlock:
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w: %q", ErrInvalidUncategorized, cfg.DNS.Categories.Uncategorized)
+}
+
+func (d *DNS) updateCategoryIndex(domainCategories []categories.DomainCategory, policies []categories.Policy) {
+	index := &categoryIndex{
+		domains: make(map[string][]string),
+		blocked: make(map[string]*int64),
+	}
+
+	for _, dc := range domainCategories {
+		domain := matcher.Normalize(dc.Domain)
+		index.domains[domain] = append(index.domains[domain], dc.Category)
+	}
+
+	for _, p := range policies {
+		if p.Blocked {
+			index.blocked[p.Category] = p.ScheduleID
+		}
+	}
+
+	d.categoryIndex.Store(index)
+}
+
+func (d *DNS) updateCategories() {
+	for {
+		fmt.Println("Updating categories")
+		dcs, err := d.categories.GetDomainCategories(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			time.Sleep(1 * time.Minute)
+			continue
+		}
+
+		policies, err := d.categories.GetPolicies(context.Background())
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			d.updateCategoryIndex(dcs, policies)
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+// blockedCategory returns the category of name blocked for a client of g
+// right now, globally or for the group, or an empty string when name is
+// uncategorized and those are blocked. Reverse lookups are never
+// categorized, so they are never blocked as uncategorized, nor are the names
+// answered locally.
+func (d *DNS) blockedCategory(g *clientGroup, name string, qtype uint16) (string, bool) {
+	index := d.categoryIndex.Load()
+	if index == nil {
+		return "", false
+	}
+
+	cats, ok := index.lookup(name)
+	if !ok {
+		return "", d.blockUncategorized && qtype != dns.TypePTR && !d.servesLocally(name)
+	}
+
+	active := d.scheduleActive()
+	for _, category := range cats {
+		if scheduleID, ok := index.blocked[category]; ok && active(scheduleID) {
+			return category, true
+		}
+		if g != nil && active(g.schedule) {
+			if _, ok := g.blockedCategories[category]; ok {
+				return category, true
+			}
+		}
+	}
+
+	return "", false
+}
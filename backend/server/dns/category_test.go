@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/categories"
+)
+
+func testCategoryIndex(dnsHandler *DNS) {
+	dnsHandler.updateCategoryIndex([]categories.DomainCategory{
+		{Domain: "casino.example.com", Category: "games"},
+		{Domain: "casino.example.com", Category: "gambling"},
+		{Domain: "Chess.example.com", Category: "games"},
+		{Domain: "adult.example.com", Category: "adult"},
+	}, []categories.Policy{
+		{Category: "gambling", Blocked: true},
+		{Category: "adult", Blocked: false},
+	})
+}
+
+func TestDNS_decide_Categories(t *testing.T) {
+	dnsHandler := createTestDNS()
+	testCategoryIndex(dnsHandler)
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{
+		{ID: 1, Domain: "poker.example.com"},
+	})
+
+	testCases := []struct {
+		name   string
+		action action
+		rule   string
+	}{
+		{"casino.example.com.", actionBlock, "category gambling"},
+		{"CASINO.example.com.", actionBlock, "category gambling"},
+		{"chess.example.com.", actionNone, ""},
+		{"adult.example.com.", actionNone, ""},
+		{"www.casino.example.com.", actionBlock, "category gambling"},
+		{"cdn.www.Casino.example.com.", actionBlock, "category gambling"},
+		{"www.chess.example.com.", actionNone, ""},
+		{"example.com.", actionNone, ""},
+		{"poker.example.com.", actionAllow, "allow rule 1 (poker.example.com)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := dnsHandler.decide(nil, tc.name, dns.TypeA)
+			assert.Equal(t, tc.action, dec.action)
+			assert.Equal(t, tc.rule, dec.rule)
+		})
+	}
+}
+
+func TestDNS_decide_BlockUncategorized(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.blockUncategorized = true
+
+	// Nothing is blocked before the index is loaded.
+	assert.Equal(t, actionNone, dnsHandler.decide(nil, "new.example.com.", dns.TypeA).action)
+
+	testCategoryIndex(dnsHandler)
+
+	dec := dnsHandler.decide(nil, "new.example.com.", dns.TypeA)
+	assert.Equal(t, actionBlock, dec.action)
+	assert.Equal(t, "uncategorized default", dec.rule)
+
+	assert.Equal(t, actionNone, dnsHandler.decide(nil, "chess.example.com.", dns.TypeA).action)
+	assert.Equal(t, actionNone, dnsHandler.decide(nil, "www.chess.example.com.", dns.TypeA).action)
+	assert.Equal(t, actionNone, dnsHandler.decide(nil, "10.0.0.10.in-addr.arpa.", dns.TypePTR).action)
+}
+
+func TestDNS_handleRequest_BlockedCategory(t *testing.T) {
+	dnsHandler := createTestDNS()
+	testCategoryIndex(dnsHandler)
+
+	req := new(dns.Msg)
+	req.SetQuestion("casino.example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "0.0.0.0", rw.msg.Answer[0].(*dns.A).A.String())
+
+	ede := rw.msg.IsEdns0().Option[0].(*dns.EDNS0_EDE)
+	assert.Equal(t, "blocked by casino.example.com.", ede.ExtraText)
+}
+
+func TestBlockUncategorized(t *testing.T) {
+	cfg := &config.Config{}
+	blocked, err := blockUncategorized(cfg)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	cfg.DNS.Categories.Uncategorized = "block"
+	blocked, err = blockUncategorized(cfg)
+	require.NoError(t, err)
+	assert.True(t, blocked)
+
+	cfg.DNS.Categories.Uncategorized = "deny"
+	_, err = blockUncategorized(cfg)
+	assert.ErrorIs(t, err, ErrInvalidUncategorized)
+}
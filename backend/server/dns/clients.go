@@ -0,0 +1,246 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/cache"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+// defaultClientIDOption is the EDNS0 option carrying client IDs, the first
+// code of the range reserved for local use.
+const defaultClientIDOption = 65001
+
+// clientGroup is a group of clients with the settings that apply to them.
+type clientGroup struct {
+	id                int64
+	name              string
+	blockedCategories map[string]struct{}
+	// schedule limits blockedCategories to the times it is active.
+	schedule *int64
+	// safeSearch overrides the server safe search setting when set.
+	safeSearch *bool
+	// resolver answers the cache misses of the group, nil when it uses the
+	// server upstreams.
+	resolver *groupResolver
+}
+
+func (g *clientGroup) groupID() int64 {
+	if g == nil {
+		return 0
+	}
+
+	return g.id
+}
+
+// groupResolver is the upstream pool of the groups sharing a list of
+// upstreams, with its own cache so their answers never leak to other
+// clients.
+type groupResolver struct {
+	upstreams upstream.Pool
+	cache     cache.Cache
+}
+
+type cidrGroup struct {
+	prefix netip.Prefix
+	group  *clientGroup
+}
+
+// clientIndex finds the group of a client, by client ID first, then by
+// source address and then by the most specific CIDR.
+type clientIndex struct {
+	// groups are all the groups, in the order they were loaded.
+	groups []*clientGroup
+	ids    map[string]*clientGroup
+	ips    map[netip.Addr]*clientGroup
+	cidrs  []cidrGroup
+}
+
+func (idx *clientIndex) lookup(addr netip.Addr, clientID string) *clientGroup {
+	if g, ok := idx.ids[clientID]; ok && clientID != "" {
+		return g
+	}
+
+	addr = addr.Unmap()
+	if g, ok := idx.ips[addr]; ok {
+		return g
+	}
+
+	for _, c := range idx.cidrs {
+		if c.prefix.Contains(addr) {
+			return c.group
+		}
+	}
+
+	return nil
+}
+
+// updateClientIndex indexes clients by identifier. Resolvers are reused
+// for groups whose upstreams did not change; the returned map holds the
+// ones in use, the others are stopped once the new index is in place.
+func (d *DNS) updateClientIndex(
+	groups []clients.Group, cs []clients.Client, resolvers map[string]*groupResolver,
+) map[string]*groupResolver {
+	index := &clientIndex{
+		ids: make(map[string]*clientGroup),
+		ips: make(map[netip.Addr]*clientGroup),
+	}
+
+	used := make(map[string]*groupResolver)
+	byID := make(map[int64]*clientGroup, len(groups))
+	for _, group := range groups {
+		g := &clientGroup{
+			id:                group.ID,
+			name:              group.Name,
+			blockedCategories: make(map[string]struct{}),
+			schedule:          group.ScheduleID,
+			safeSearch:        group.SafeSearch,
+		}
+		for _, category := range group.BlockedCategories {
+			g.blockedCategories[category] = struct{}{}
+		}
+
+		if len(group.Upstreams) > 0 {
+			key := strings.Join(group.Upstreams, ",")
+			if r, ok := used[key]; ok {
+				g.resolver = r
+			} else if r, ok := resolvers[key]; ok {
+				g.resolver, used[key] = r, r
+			} else if r, err := d.newGroupResolver(group.Upstreams); err != nil {
+				log.Printf("Group %s uses the default upstreams: %s\n", group.Name, err.Error())
+			} else {
+				g.resolver, used[key] = r, r
+			}
+		}
+
+		byID[group.ID] = g
+		index.groups = append(index.groups, g)
+	}
+
+	for _, c := range cs {
+		g, ok := byID[c.GroupID]
+		if !ok {
+			continue
+		}
+
+		switch c.Kind {
+		case clients.KindClientID:
+			index.ids[c.Value] = g
+		case clients.KindIP:
+			if addr, err := netip.ParseAddr(c.Value); err == nil {
+				index.ips[addr.Unmap()] = g
+			}
+		case clients.KindCIDR:
+			if prefix, err := netip.ParsePrefix(c.Value); err == nil {
+				index.cidrs = append(index.cidrs, cidrGroup{prefix: prefix.Masked(), group: g})
+			}
+		}
+	}
+
+	slices.SortStableFunc(index.cidrs, func(a, b cidrGroup) int {
+		return b.prefix.Bits() - a.prefix.Bits()
+	})
+
+	d.clientIndex.Store(index)
+
+	for key, r := range resolvers {
+		if _, ok := used[key]; !ok {
+			r.upstreams.Stop()
+		}
+	}
+
+	return used
+}
+
+func (d *DNS) newGroupResolver(servers []string) (*groupResolver, error) {
+	if d.newGroupUpstreams == nil {
+		return nil, fmt.Errorf("group upstreams are not supported")
+	}
+
+	pool, err := d.newGroupUpstreams(servers)
+	if err != nil {
+		return nil, err
+	}
+	pool.Start()
+
+	return &groupResolver{upstreams: pool, cache: cache.New(d.cacheOptions)}, nil
+}
+
+func (d *DNS) updateClients() {
+	var resolvers map[string]*groupResolver
+	for {
+		fmt.Println("Updating clients")
+		groups, err := d.clients.GetGroups(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			time.Sleep(1 * time.Minute)
+			continue
+		}
+
+		cs, err := d.clients.GetClients(context.Background())
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			resolvers = d.updateClientIndex(groups, cs, resolvers)
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+// clientGroup returns the group of the client that sent msg, if any. The
+// client ID is taken from the DoH path or from the client ID EDNS0 option,
+// which is removed so it is never forwarded upstream.
+func (d *DNS) clientGroup(rw dns.ResponseWriter, msg *dns.Msg) *clientGroup {
+	clientID := d.takeClientIDOption(msg)
+	if w, ok := rw.(interface{ ClientID() string }); ok && w.ClientID() != "" {
+		clientID = w.ClientID()
+	}
+
+	index := d.clientIndex.Load()
+	if index == nil {
+		return nil
+	}
+
+	return index.lookup(remoteAddr(rw), clientID)
+}
+
+// remoteAddr returns the address of the client behind rw, invalid when it
+// has none.
+func remoteAddr(rw dns.ResponseWriter) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(rw.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addrPort.Addr().Unmap()
+}
+
+func (d *DNS) takeClientIDOption(msg *dns.Msg) string {
+	opt := msg.IsEdns0()
+	if opt == nil || d.clientIDOption == 0 {
+		return ""
+	}
+
+	var clientID string
+	options := opt.Option[:0:0]
+	for _, o := range opt.Option {
+		if local, ok := o.(*dns.EDNS0_LOCAL); ok && local.Code == d.clientIDOption {
+			clientID = string(local.Data)
+			continue
+		}
+		options = append(options, o)
+	}
+	opt.Option = options
+
+	return clientID
+}
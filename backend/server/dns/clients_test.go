@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+// stoppableUpstream is a testUpstream recording whether it was stopped.
+type stoppableUpstream struct {
+	testUpstream
+	stopped atomic.Bool
+}
+
+func (u *stoppableUpstream) Stop() { u.stopped.Store(true) }
+
+// clientIDResponseWriter is a testResponseWriter for DoH requests.
+type clientIDResponseWriter struct {
+	*testResponseWriter
+	clientID string
+}
+
+func (w *clientIDResponseWriter) ClientID() string { return w.clientID }
+
+var (
+	kidsGroupID   = int64(1)
+	guestsGroupID = int64(2)
+)
+
+func testGroups() ([]clients.Group, []clients.Client) {
+	groups := []clients.Group{
+		{ID: kidsGroupID, Name: "kids", BlockedCategories: []string{"games"}},
+		{ID: guestsGroupID, Name: "guests", Upstreams: []string{"9.9.9.9:53"}},
+	}
+	cs := []clients.Client{
+		{GroupID: kidsGroupID, Kind: clients.KindCIDR, Value: "192.168.0.0/24"},
+		{GroupID: kidsGroupID, Kind: clients.KindClientID, Value: "tablet"},
+		{GroupID: guestsGroupID, Kind: clients.KindCIDR, Value: "192.168.0.128/25"},
+		{GroupID: guestsGroupID, Kind: clients.KindIP, Value: "192.168.1.10"},
+		{GroupID: 99, Kind: clients.KindIP, Value: "192.168.1.99"},
+	}
+
+	return groups, cs
+}
+
+func createTestDNSWithGroups() (*DNS, map[string]*stoppableUpstream) {
+	dnsHandler := createTestDNS()
+	pools := make(map[string]*stoppableUpstream)
+	dnsHandler.newGroupUpstreams = func(servers []string) (upstream.Pool, error) {
+		pool := &stoppableUpstream{testUpstream: testUpstream{handler: answerWithA(300, "10.9.9.9")}}
+		pools[servers[0]] = pool
+		return pool, nil
+	}
+
+	groups, cs := testGroups()
+	dnsHandler.updateClientIndex(groups, cs, nil)
+	return dnsHandler, pools
+}
+
+func TestClientIndex_lookup(t *testing.T) {
+	dnsHandler, _ := createTestDNSWithGroups()
+
+	testCases := []struct {
+		name     string
+		addr     string
+		clientID string
+		group    int64
+	}{
+		{"cidr", "192.168.0.10", "", kidsGroupID},
+		{"most specific cidr", "192.168.0.200", "", guestsGroupID},
+		{"ip", "192.168.1.10", "", guestsGroupID},
+		{"ipv4 mapped", "::ffff:192.168.1.10", "", guestsGroupID},
+		{"client id wins", "192.168.1.10", "tablet", kidsGroupID},
+		{"unknown client id", "192.168.1.10", "phone", guestsGroupID},
+		{"unknown group", "192.168.1.99", "", 0},
+		{"no group", "10.0.0.1", "", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := net.ParseIP(tc.addr)
+			rw := &clientIDResponseWriter{
+				testResponseWriter: &testResponseWriter{remote: &net.UDPAddr{IP: addr, Port: 5353}},
+				clientID:           tc.clientID,
+			}
+			g := dnsHandler.clientGroup(rw, new(dns.Msg))
+			assert.Equal(t, tc.group, g.groupID())
+		})
+	}
+}
+
+func TestDNS_clientGroup_EDNSOption(t *testing.T) {
+	dnsHandler, _ := createTestDNSWithGroups()
+	dnsHandler.clientIDOption = defaultClientIDOption
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_LOCAL{Code: defaultClientIDOption, Data: []byte("tablet")},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0123456789abcdef"},
+	)
+
+	rw := &testResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5353}}
+	g := dnsHandler.clientGroup(rw, req)
+	assert.Equal(t, kidsGroupID, g.groupID())
+
+	// The client ID is not forwarded upstream.
+	require.Len(t, opt.Option, 1)
+	assert.Equal(t, uint16(dns.EDNS0COOKIE), opt.Option[0].Option())
+}
+
+func TestDNS_decide_Groups(t *testing.T) {
+	dnsHandler, _ := createTestDNSWithGroups()
+	index := dnsHandler.clientIndex.Load()
+	kids, guests := index.ids["tablet"], index.ips[netip.MustParseAddr("192.168.1.10")]
+
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "social.com", Recursive: true, GroupID: &kidsGroupID},
+		{ID: 2, Domain: "ads.com", Recursive: true},
+	})
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{
+		{ID: 3, Domain: "ads.com", GroupID: &guestsGroupID},
+		{ID: 4, Domain: "ads.com", GroupID: &kidsGroupID},
+	})
+	testCategoryIndex(dnsHandler)
+
+	testCases := []struct {
+		name   string
+		group  *clientGroup
+		action action
+		rule   string
+	}{
+		{"social.com.", kids, actionBlock, "block rule 1 (social.com) for group 1"},
+		{"www.social.com.", kids, actionBlock, "block rule 1 (social.com) for group 1"},
+		{"social.com.", guests, actionNone, ""},
+		{"social.com.", nil, actionNone, ""},
+		{"ads.com.", nil, actionBlock, "block rule 2 (ads.com)"},
+		{"ads.com.", guests, actionAllow, "allow rule 3 (ads.com) for group 2"},
+		{"ads.com.", kids, actionAllow, "allow rule 4 (ads.com) for group 1"},
+		{"cdn.ads.com.", guests, actionBlock, "block rule 2 (ads.com)"},
+		{"chess.example.com.", kids, actionBlock, "category games"},
+		{"chess.example.com.", guests, actionNone, ""},
+		{"casino.example.com.", guests, actionBlock, "category gambling"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := dnsHandler.decide(tc.group, tc.name, dns.TypeA)
+			assert.Equal(t, tc.action, dec.action)
+			assert.Equal(t, tc.rule, dec.rule)
+		})
+	}
+}
+
+func TestDNS_handleRequest_GroupUpstreams(t *testing.T) {
+	dnsHandler, pools := createTestDNSWithGroups()
+	pool := pools["9.9.9.9:53"]
+	require.NotNil(t, pool)
+
+	query := func(ip string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeA)
+		rw := &testResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP(ip), Port: 5353}}
+		dnsHandler.handleRequest()(rw, req)
+		require.NotNil(t, rw.msg)
+		require.Len(t, rw.msg.Answer, 1)
+		return rw.msg
+	}
+
+	assert.Equal(t, "10.9.9.9", query("192.168.1.10").Answer[0].(*dns.A).A.String())
+	assert.Equal(t, "10.9.9.9", query("192.168.1.10").Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(1), pool.hits.Load())
+
+	// Other clients neither use the group upstreams nor its cache.
+	assert.Equal(t, "10.0.0.1", query("10.0.0.1").Answer[0].(*dns.A).A.String())
+	assert.Equal(t, "10.0.0.1", query("192.168.0.10").Answer[0].(*dns.A).A.String())
+}
+
+func TestDNS_updateClientIndex_ReusesResolvers(t *testing.T) {
+	dnsHandler := createTestDNS()
+	var created []*stoppableUpstream
+	dnsHandler.newGroupUpstreams = func(servers []string) (upstream.Pool, error) {
+		pool := &stoppableUpstream{}
+		created = append(created, pool)
+		return pool, nil
+	}
+
+	groups, cs := testGroups()
+	resolvers := dnsHandler.updateClientIndex(groups, cs, nil)
+	resolvers = dnsHandler.updateClientIndex(groups, cs, resolvers)
+	require.Len(t, created, 1)
+	assert.Len(t, resolvers, 1)
+	assert.False(t, created[0].stopped.Load())
+
+	groups[1].Upstreams = []string{"1.1.1.1:53"}
+	resolvers = dnsHandler.updateClientIndex(groups, cs, resolvers)
+	require.Len(t, created, 2)
+	assert.Len(t, resolvers, 1)
+	assert.True(t, created[0].stopped.Load())
+	assert.False(t, created[1].stopped.Load())
+}
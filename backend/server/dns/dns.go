@@ -5,42 +5,116 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 	"go.uber.org/fx"
 
+	"github.com/orion-tec/oriondns/config"
 	"github.com/orion-tec/oriondns/internal/ai"
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/authority"
 	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/cache"
+	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/dnssec"
 	"github.com/orion-tec/oriondns/internal/domains"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/matcher"
+	"github.com/orion-tec/oriondns/internal/recursor"
+	"github.com/orion-tec/oriondns/internal/rpz"
+	"github.com/orion-tec/oriondns/internal/schedules"
 	"github.com/orion-tec/oriondns/internal/stats"
+	"github.com/orion-tec/oriondns/internal/upstream"
 )
 
+const defaultDoTAddr = ":853"
+
+var ErrTLSNotConfigured = fmt.Errorf("encrypted listeners require dns.tls.cert_file and dns.tls.key_file")
+
 type DNS struct {
-	cacheMap             sync.Map
-	blockedDomainsMap    map[string][]blockeddomains.BlockedDomain
-	blockedDomainsMutext sync.Mutex
+	cache cache.Cache
+
+	// Blocked domains indexed by label, rebuilt in the background and
+	// swapped in whole so lookups never take a lock.
+	blocklist     atomic.Pointer[blocklist]
+	allowlist     atomic.Pointer[matcher.Trie[[]alloweddomains.AllowedDomain]]
+	blockResponse blockResponse
+	// rpz holds the response policy zones, nil when none are configured.
+	rpz rpz.RPZ
+	// forwarders holds the conditional forwarding rules, nil when none are
+	// configured.
+	forwarders *forwarders
+	// authority serves the authoritative zones, nil when none are
+	// configured.
+	authority authority.Authority
+	// categoryIndex holds the categories of known domains and the blocked
+	// ones, nil until first loaded.
+	categoryIndex      atomic.Pointer[categoryIndex]
+	blockUncategorized bool
+	// clientIndex maps clients to their groups, nil until first loaded.
+	clientIndex    atomic.Pointer[clientIndex]
+	clientIDOption uint16
+	// localIndex holds the records answered by the server itself, nil until
+	// first loaded.
+	localIndex atomic.Pointer[localIndex]
+	// hostnames tracks the PTR lookups labelling clients in the stats.
+	hostnames hostnames
+	// safeSearch enforces safe search for clients whose group does not
+	// override it.
+	safeSearch bool
+	// scheduleIndex holds the schedules rules can be attached to, checked
+	// against now at query time. nil until first loaded.
+	scheduleIndex atomic.Pointer[scheduleIndex]
+	now           func() time.Time
+	// newGroupUpstreams builds the upstreams of groups with their own, whose
+	// caches use cacheOptions.
+	newGroupUpstreams func(servers []string) (upstream.Pool, error)
+	cacheOptions      cache.Options
 
 	blockedDomains blockeddomains.DB
+	allowedDomains alloweddomains.DB
+	categories     categories.DB
+	clients        clients.DB
+	schedules      schedules.DB
+	localRecords   localrecords.DB
 	domain         domains.DB
 	stats          stats.DB
 	ai             ai.AI
-}
+	upstreams      upstream.Pool
 
-func (d *DNS) updateBlockedDomainsMap(blockedDomains []blockeddomains.BlockedDomain) {
-	d.blockedDomainsMutext.Lock()
-	defer d.blockedDomainsMutext.Unlock()
+	// Lower cased names of the most used domains, whose cache entries are
+	// refreshed before they expire.
+	popularDomains atomic.Pointer[map[string]struct{}]
+}
 
-	for k := range d.blockedDomainsMap {
-		delete(d.blockedDomainsMap, k)
+func (d *DNS) updateBlocklist(blockedDomains []blockeddomains.BlockedDomain) {
+	blocklist := newBlocklist()
+	for _, bd := range blockedDomains {
+		rule, err := d.newBlockRule(bd)
+		if err != nil {
+			fmt.Printf("Skipping blocked domain %d: %s\n", bd.ID, err)
+			continue
+		}
+		blocklist.add(rule)
 	}
 
-	for _, bd := range blockedDomains {
-		id := fmt.Sprintf("%d", bd.ID)
-		d.blockedDomainsMap[id] = append(d.blockedDomainsMap[id], bd)
+	d.blocklist.Store(blocklist)
+}
+
+// blockedBy returns the rule blocking a query for name and qtype from a
+// client of g right now, if any.
+func (d *DNS) blockedBy(g *clientGroup, name string, qtype uint16) (blockRule, bool) {
+	blocklist := d.blocklist.Load()
+	if blocklist == nil {
+		return blockRule{}, false
 	}
+
+	return blocklist.match(g.groupID(), name, qtype, d.scheduleActive())
 }
 
 func (d *DNS) updateBlockedDomains() {
@@ -49,17 +123,72 @@ func (d *DNS) updateBlockedDomains() {
 		bds, err := d.blockedDomains.GetAll(context.Background())
 		if err != nil {
 			fmt.Println(err)
+		} else {
+			d.updateBlocklist(bds)
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+func (d *DNS) updatePopularDomains(limit int) {
+	for {
+		fmt.Println("Updating popular domains")
+		ds, err := d.domain.GetMostUsed(context.Background(), limit)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			popular := make(map[string]struct{}, len(ds))
+			for _, domain := range ds {
+				popular[strings.ToLower(dns.Fqdn(domain.Domain))] = struct{}{}
+			}
+			d.popularDomains.Store(&popular)
 		}
 
-		d.updateBlockedDomainsMap(bds)
 		time.Sleep(1 * time.Minute)
 	}
 }
 
-func (d *DNS) handleRequest(c *dns.Client) dns.HandlerFunc {
+func (d *DNS) isPopular(msg *dns.Msg) bool {
+	popular := d.popularDomains.Load()
+	if popular == nil || len(msg.Question) == 0 {
+		return false
+	}
+
+	_, ok := (*popular)[strings.ToLower(msg.Question[0].Name)]
+	return ok
+}
+
+// prefetch refreshes the cached answer for req in the background.
+func (d *DNS) prefetch(req *dns.Msg) {
+	upstreams := d.upstreams
+	if pool, ok := d.forwarders.match(req.Question[0].Name); ok {
+		upstreams = pool
+	}
+
+	resp, err := upstreams.Exchange(context.Background(), req)
+	if err != nil {
+		log.Printf("Failed to prefetch %s: %s\n", req.Question[0].Name, err.Error())
+		return
+	}
+
+	d.cache.Set(req, resp)
+}
+
+func (d *DNS) handleRequest() dns.HandlerFunc {
 	return func(rw dns.ResponseWriter, msg *dns.Msg) {
+		if msg.Opcode == dns.OpcodeNotify {
+			d.handleNotify(rw, msg)
+			return
+		}
+
+		if isTransfer(msg) {
+			d.handleTransfer(rw, msg)
+			return
+		}
 
 		// Store stats for the request
+		addr, now := remoteAddr(rw), d.now()
 		go func() {
 			for _, q := range msg.Question {
 				name := strings.TrimSuffix(q.Name, ".")
@@ -71,103 +200,425 @@ func (d *DNS) handleRequest(c *dns.Client) dns.HandlerFunc {
 				}
 
 				qType := getTypeString(q.Qtype)
-				err := d.stats.Insert(context.Background(), time.Now(), name, qType)
+				err := d.stats.Insert(context.Background(), now, name, qType)
 				if err != nil {
 					log.Printf("Failed to insert stats: %s", err.Error())
 				}
 			}
+
+			if addr.IsValid() {
+				err := d.stats.InsertClient(context.Background(), now, addr.String())
+				if err != nil {
+					log.Printf("Failed to insert client stats: %s", err.Error())
+				}
+				d.discoverHostname(addr, now)
+			}
 		}()
 
-		// Validate if it's blocked
-		d.blockedDomainsMutext.Lock()
-		isBlocked := false
-		for _, bds := range d.blockedDomainsMap {
-			for _, q := range msg.Question {
-				for _, bd := range bds {
-					if bd.Recursive && strings.HasSuffix(q.Name, bd.Domain) {
-						fmt.Println("Blocked recursive domain: ", q.Name)
-						isBlocked = true
-						break
-					}
+		g := d.clientGroup(rw, msg)
 
-					if q.Name == bd.Domain {
-						fmt.Println("Blocked domain: ", q.Name)
-						isBlocked = true
-						break
-					}
-				}
+		// Validate if it's blocked
+		for _, q := range msg.Question {
+			dec := d.decide(g, q.Name, q.Qtype)
+			switch dec.action {
+			case actionAllow:
+				fmt.Println("Allowed domain: ", q.Name, "by", dec.rule)
+			case actionRPZ:
+				fmt.Println("Rewritten domain: ", q.Name, "by", dec.rule)
+				d.applyPolicy(rw, msg, g, dec.policy)
+				return
+			case actionBlock:
+				fmt.Println("Blocked domain: ", q.Name, "by", dec.rule)
+				writeResponse(rw, msg, dec.block.response.reply(msg, dec.block.zone(q.Name)))
+				return
 			}
 		}
-		d.blockedDomainsMutext.Unlock()
 
-		if isBlocked {
-			m := new(dns.Msg)
-			m.Answer = append(m.Answer, &dns.A{
-				A: net.ParseIP("127.0.0.1"),
-			})
-			m.RecursionAvailable = true
-			m.SetReply(msg)
-			err := rw.WriteMsg(m)
-			if err != nil {
-				log.Printf("Failed to write msg: %s\n", err.Error())
-			}
+		if resp, ok := d.localReply(g, msg); ok {
+			fmt.Println("Local domain: ", msg.Question[0].Name)
+			writeResponse(rw, msg, resp)
+			return
+		}
 
+		if resp, ok := d.authoritativeReply(msg); ok {
+			fmt.Println("Authoritative domain: ", msg.Question[0].Name)
+			writeResponse(rw, msg, resp)
 			return
 		}
 
-		respFromCache, loaded := d.cacheMap.Load(msg.String())
-		if loaded {
-			err := rw.WriteMsg(respFromCache.(*dns.Msg))
-			if err != nil {
-				log.Printf("Failed to write msg: %s\n", err.Error())
-			}
+		if resp, ok := d.privateReverseReply(msg); ok {
+			fmt.Println("Private reverse domain: ", msg.Question[0].Name)
+			writeResponse(rw, msg, resp)
 			return
 		}
 
-		resp, _, err := c.Exchange(msg, "8.8.8.8:53")
+		if len(msg.Question) > 0 {
+			if target, ok := d.safeSearchTarget(g, msg.Question[0].Name); ok {
+				fmt.Println("Safe search domain: ", msg.Question[0].Name, "to", target)
+				writeResponse(rw, msg, d.safeSearchReply(g, msg, target))
+				return
+			}
+		}
+
+		writeResponse(rw, msg, d.resolve(g, msg))
+	}
+}
+
+// resolve answers msg for a client of g from the cache or the upstreams,
+// falling back to stale data and then SERVFAIL when the upstreams fail.
+// Groups with their own upstreams use their own cache, without prefetching,
+// but names under a forwarding rule go to its upstreams for every client.
+func (d *DNS) resolve(g *clientGroup, msg *dns.Msg) *dns.Msg {
+	upstreams, answers := d.upstreams, d.cache
+	if g != nil && g.resolver != nil {
+		upstreams, answers = g.resolver.upstreams, g.resolver.cache
+	}
+	if len(msg.Question) > 0 {
+		if pool, ok := d.forwarders.match(msg.Question[0].Name); ok {
+			upstreams, answers = pool, d.cache
+		}
+	}
+
+	if cached, ok := answers.Get(msg); ok {
+		if answers == d.cache && d.isPopular(msg) && d.cache.ShouldPrefetch(msg) {
+			go d.prefetch(msg.Copy())
+		}
+		return cached
+	}
+
+	resp, err := upstreams.Exchange(context.Background(), msg)
+	if err != nil || resp.Rcode == dns.RcodeServerFailure {
 		if err != nil {
 			log.Printf("Failed to exchange: %s", err.Error())
-			return
 		}
 
-		d.cacheMap.Store(msg.String(), resp)
-		err = rw.WriteMsg(resp)
+		// Serve stale data rather than letting the client time out.
+		if stale, ok := answers.GetStale(msg); ok {
+			return stale
+		}
+
+		if resp == nil {
+			resp = new(dns.Msg)
+			resp.SetRcode(msg, dns.RcodeServerFailure)
+		}
+		return resp
+	}
+
+	answers.Set(msg, resp)
+	return resp
+}
+
+// handleNotify acknowledges NOTIFY messages from the primaries of response
+// policy zones, which then get refreshed, and refuses any other.
+func (d *DNS) handleNotify(rw dns.ResponseWriter, msg *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(msg)
+
+	var from net.IP
+	switch addr := rw.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		from = addr.IP
+	case *net.TCPAddr:
+		from = addr.IP
+	}
+
+	if d.rpz != nil && len(msg.Question) == 1 && d.rpz.Notify(msg.Question[0].Name, from) {
+		fmt.Println("Received notify for rpz zone", msg.Question[0].Name, "from", from)
+		resp.Authoritative = true
+	} else {
+		resp.Rcode = dns.RcodeRefused
+	}
+
+	writeResponse(rw, msg, resp)
+}
+
+// writeResponse writes resp to the client, truncating it to the advertised
+// UDP buffer size so UDP clients know to retry over TCP.
+func writeResponse(rw dns.ResponseWriter, req, resp *dns.Msg) {
+	if isPlainUDP(rw) {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+
+		if resp.Len() > size {
+			resp = resp.Copy()
+			resp.Truncate(size)
+		}
+	}
+
+	err := rw.WriteMsg(resp)
+	if err != nil {
+		log.Printf("Failed to write msg: %s\n", err.Error())
+	}
+}
+
+// isPlainUDP reports whether responses written to rw are bound by the UDP
+// message size limits. DoQ runs over UDP but carries messages on streams.
+func isPlainUDP(rw dns.ResponseWriter) bool {
+	if _, ok := rw.(*doqResponseWriter); ok {
+		return false
+	}
+
+	_, ok := rw.RemoteAddr().(*net.UDPAddr)
+	return ok
+}
+
+// newUpstreams returns where cache misses are resolved: the root servers in
+// recursive mode, otherwise the configured forwarders. Answers are validated
+// when DNSSEC is enabled.
+func newUpstreams(cfg *config.Config) (upstream.Pool, error) {
+	var pool upstream.Pool
+	if cfg.DNS.Recursion.Enabled {
+		pool = recursor.New(recursor.Options{
+			RootHints: cfg.DNS.Recursion.RootHints,
+			Timeout:   cfg.DNS.Recursion.Timeout,
+		})
+	} else {
+		upstreamServers := cfg.DNS.Upstream.Servers
+		if len(upstreamServers) == 0 {
+			upstreamServers = []string{upstream.DefaultServer}
+		}
+
+		var err error
+		pool, err = upstream.New(upstream.Options{
+			Servers:             upstreamServers,
+			Strategy:            upstream.Strategy(cfg.DNS.Upstream.Strategy),
+			Timeout:             cfg.DNS.Upstream.Timeout,
+			HealthCheckInterval: cfg.DNS.Upstream.HealthCheckInterval,
+		})
 		if err != nil {
-			log.Printf("Failed to write msg: %s\n", err.Error())
+			return nil, err
 		}
 	}
+
+	if cfg.DNS.DNSSEC.Enabled {
+		return dnssec.New(pool, dnssec.Options{TrustAnchors: cfg.DNS.DNSSEC.TrustAnchors})
+	}
+
+	return pool, nil
+}
+
+type DNSDeps struct {
+	fx.In
+	Config         *config.Config
+	AI             ai.AI
+	Stats          stats.DB
+	BlockedDomains blockeddomains.DB
+	AllowedDomains alloweddomains.DB
+	Categories     categories.DB
+	Clients        clients.DB
+	Schedules      schedules.DB
+	LocalRecords   localrecords.DB
+	Domains        domains.DB
 }
 
-func New(lc fx.Lifecycle, ai ai.AI, stats stats.DB, blockedDomains blockeddomains.DB, domain domains.DB) *DNS {
-	c := new(dns.Client)
+func New(lc fx.Lifecycle, deps DNSDeps) (*DNS, error) {
+	cfg := deps.Config
+
+	upstreams, err := newUpstreams(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	blockResponse, err := newBlockResponse(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := newRPZ(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	forwarders, err := newForwarders(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err := newAuthority(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	uncategorized, err := blockUncategorized(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	clientIDOption := cfg.DNS.Clients.EDNSOption
+	if clientIDOption == 0 {
+		clientIDOption = defaultClientIDOption
+	}
+
+	cacheOptions := cache.Options{
+		MaxEntries:     cfg.DNS.Cache.MaxEntries,
+		MaxNegativeTTL: cfg.DNS.Cache.MaxNegativeTTL,
+		StaleMaxAge:    cfg.DNS.Cache.StaleMaxAge,
+		StaleTTL:       cfg.DNS.Cache.StaleTTL,
+	}
 
 	dnsStruct := DNS{
-		stats:             stats,
-		blockedDomains:    blockedDomains,
-		domain:            domain,
-		blockedDomainsMap: make(map[string][]blockeddomains.BlockedDomain),
-		ai:                ai,
+		cache:          cache.New(cacheOptions),
+		cacheOptions:   cacheOptions,
+		stats:          deps.Stats,
+		blockedDomains: deps.BlockedDomains,
+		allowedDomains: deps.AllowedDomains,
+		categories:     deps.Categories,
+		clients:        deps.Clients,
+		schedules:      deps.Schedules,
+		localRecords:   deps.LocalRecords,
+		domain:         deps.Domains,
+		ai:             deps.AI,
+		upstreams:      upstreams,
+		blockResponse:  blockResponse,
+		rpz:            policies,
+		forwarders:     forwarders,
+		authority:      zones,
+
+		blockUncategorized: uncategorized,
+		clientIDOption:     clientIDOption,
+		safeSearch:         cfg.DNS.SafeSearch.Enabled,
+		now:                time.Now,
+		newGroupUpstreams: func(servers []string) (upstream.Pool, error) {
+			// Groups forward to their upstreams even in recursive mode.
+			groupCfg := *cfg
+			groupCfg.DNS.Recursion.Enabled = false
+			groupCfg.DNS.Upstream.Servers = servers
+			return newUpstreams(&groupCfg)
+		},
 	}
 
 	go dnsStruct.updateBlockedDomains()
+	go dnsStruct.updateAllowedDomains()
+	go dnsStruct.updateCategories()
+	go dnsStruct.updateClients()
+	go dnsStruct.updateSchedules()
+	go dnsStruct.updateLocalRecords()
+	go dnsStruct.updateUpstreamStats()
+	if cfg.DNS.Cache.PrefetchTopDomains > 0 {
+		go dnsStruct.updatePopularDomains(cfg.DNS.Cache.PrefetchTopDomains)
+	}
+
+	handler := dnsStruct.handleRequest()
+	servers := []*dns.Server{
+		{Addr: ":53", Net: "udp", Handler: handler},
+		{Addr: ":53", Net: "tcp", Handler: handler},
+	}
 
-	srv := &dns.Server{Addr: ":53", Net: "udp"}
+	var certs *certReloader
+	if cfg.DNS.DoT.Enabled || cfg.DNS.DoH.Enabled || cfg.DNS.DoQ.Enabled {
+		if cfg.DNS.TLS.CertFile == "" || cfg.DNS.TLS.KeyFile == "" {
+			return nil, ErrTLSNotConfigured
+		}
 
-	srv.Handler = dns.HandlerFunc(dnsStruct.handleRequest(c))
+		certs, err = newCertReloader(cfg.DNS.TLS.CertFile, cfg.DNS.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	if cfg.DNS.DoT.Enabled {
+		addr := cfg.DNS.DoT.Addr
+		if addr == "" {
+			addr = defaultDoTAddr
+		}
+		servers = append(servers, &dns.Server{Addr: addr, Net: "tcp-tls", Handler: handler, TLSConfig: certs.tlsConfig()})
+	}
+
+	var doh *http.Server
+	if cfg.DNS.DoH.Enabled {
+		addr := cfg.DNS.DoH.Addr
+		if addr == "" {
+			addr = defaultDoHAddr
+		}
+		doh = newDoHServer(addr, handler, certs.tlsConfig())
+	}
+
+	var doq *doqServer
+	if cfg.DNS.DoQ.Enabled {
+		addr := cfg.DNS.DoQ.Addr
+		if addr == "" {
+			addr = defaultDoQAddr
+		}
+		doq = newDoQServer(addr, handler, certs.tlsConfig())
+	}
+
+	done := make(chan struct{})
 	lc.Append(fx.Hook{
 		OnStart: func(_ context.Context) error {
-			go func() {
-				fmt.Println("Listening on :53")
-				if err := srv.ListenAndServe(); err != nil {
-					log.Fatalf("Failed to set udp listener: %s", err.Error())
+			upstreams.Start()
+			if forwarders != nil {
+				forwarders.Start()
+			}
+			if policies != nil {
+				policies.Start()
+			}
+			if zones != nil {
+				zones.Start()
+			}
+			if certs != nil {
+				go certs.watch(done)
+			}
+			for _, srv := range servers {
+				go func(srv *dns.Server) {
+					fmt.Printf("Listening on %s (%s)\n", srv.Addr, srv.Net)
+					if err := srv.ListenAndServe(); err != nil {
+						log.Fatalf("Failed to set %s listener: %s", srv.Net, err.Error())
+					}
+				}(srv)
+			}
+			if doh != nil {
+				go func() {
+					fmt.Printf("Listening on %s (doh)\n", doh.Addr)
+					err := doh.ListenAndServeTLS("", "")
+					if err != nil && err != http.ErrServerClosed {
+						log.Fatalf("Failed to set doh listener: %s", err.Error())
+					}
+				}()
+			}
+			if doq != nil {
+				if err := doq.listen(); err != nil {
+					return err
 				}
-			}()
+				go func() {
+					fmt.Printf("Listening on %s (doq)\n", doq.addr)
+					if err := doq.serve(); err != nil {
+						log.Fatalf("Failed to set doq listener: %s", err.Error())
+					}
+				}()
+			}
 			return nil
 		},
-		OnStop: func(_ context.Context) error {
+		OnStop: func(ctx context.Context) error {
+			close(done)
+			upstreams.Stop()
+			if forwarders != nil {
+				forwarders.Stop()
+			}
+			if policies != nil {
+				policies.Stop()
+			}
+			if zones != nil {
+				zones.Stop()
+			}
+			for _, srv := range servers {
+				if err := srv.ShutdownContext(ctx); err != nil {
+					log.Printf("Failed to shutdown %s listener: %s\n", srv.Net, err.Error())
+				}
+			}
+			if doh != nil {
+				if err := doh.Shutdown(ctx); err != nil {
+					log.Printf("Failed to shutdown doh listener: %s\n", err.Error())
+				}
+			}
+			if doq != nil {
+				if err := doq.Shutdown(); err != nil {
+					log.Printf("Failed to shutdown doq listener: %s\n", err.Error())
+				}
+			}
 			return nil
 		},
 	})
-	return &dnsStruct
+	return &dnsStruct, nil
 }
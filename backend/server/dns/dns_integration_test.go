@@ -1,7 +1,6 @@
 package dns
 
 import (
-	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/cache"
 )
 
 func TestDNS_Integration_BlockedDomainHandling(t *testing.T) {
@@ -20,7 +20,7 @@ func TestDNS_Integration_BlockedDomainHandling(t *testing.T) {
 		{ID: 1, Domain: "malware.com.", Recursive: false},
 		{ID: 2, Domain: ".ads.example.com", Recursive: true},
 	}
-	dnsHandler.updateBlockedDomainsMap(testDomains)
+	dnsHandler.updateBlocklist(testDomains)
 
 	testCases := []struct {
 		name        string
@@ -67,18 +67,9 @@ func TestDNS_Integration_BlockedDomainHandling(t *testing.T) {
 			}
 
 			isBlocked := false
-			for _, bds := range dnsHandler.blockedDomainsMap {
-				for _, q := range msg.Question {
-					for _, bd := range bds {
-						if bd.Recursive && strings.HasSuffix(q.Name, bd.Domain) {
-							isBlocked = true
-							break
-						}
-						if q.Name == bd.Domain {
-							isBlocked = true
-							break
-						}
-					}
+			for _, q := range msg.Question {
+				if _, ok := dnsHandler.blockedBy(nil, q.Name, q.Qtype); ok {
+					isBlocked = true
 				}
 			}
 
@@ -89,42 +80,33 @@ func TestDNS_Integration_BlockedDomainHandling(t *testing.T) {
 
 func TestDNS_Integration_CacheEviction(t *testing.T) {
 	dnsHandler := createTestDNS()
+	dnsHandler.cache = cache.New(cache.Options{MaxEntries: 1})
 
 	msg1 := &dns.Msg{}
-	msg1.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA},
-	}
+	msg1.SetQuestion("google.com.", dns.TypeA)
 
 	msg2 := &dns.Msg{}
-	msg2.Question = []dns.Question{
-		{Name: "facebook.com.", Qtype: dns.TypeA},
-	}
+	msg2.SetQuestion("facebook.com.", dns.TypeA)
 
-	resp1 := &dns.Msg{}
-	resp1.SetReply(msg1)
+	resp1, err := answerWithA(300, "10.0.0.1")(msg1)
+	require.NoError(t, err)
+	resp2, err := answerWithA(300, "10.0.0.2")(msg2)
+	require.NoError(t, err)
 
-	resp2 := &dns.Msg{}
-	resp2.SetReply(msg2)
+	dnsHandler.cache.Set(msg1, resp1)
 
-	dnsHandler.cacheMap.Store(msg1.String(), resp1)
-	dnsHandler.cacheMap.Store(msg2.String(), resp2)
-
-	cachedResp1, loaded1 := dnsHandler.cacheMap.Load(msg1.String())
+	cachedResp1, loaded1 := dnsHandler.cache.Get(msg1)
 	require.True(t, loaded1)
-	assert.Equal(t, resp1, cachedResp1.(*dns.Msg))
+	assert.Equal(t, resp1.Answer[0].String(), cachedResp1.Answer[0].String())
 
-	cachedResp2, loaded2 := dnsHandler.cacheMap.Load(msg2.String())
-	require.True(t, loaded2)
-	assert.Equal(t, resp2, cachedResp2.(*dns.Msg))
+	dnsHandler.cache.Set(msg2, resp2)
 
-	dnsHandler.cacheMap.Delete(msg1.String())
-
-	_, loaded1After := dnsHandler.cacheMap.Load(msg1.String())
+	_, loaded1After := dnsHandler.cache.Get(msg1)
 	assert.False(t, loaded1After)
 
-	cachedResp2After, loaded2After := dnsHandler.cacheMap.Load(msg2.String())
-	require.True(t, loaded2After)
-	assert.Equal(t, resp2, cachedResp2After.(*dns.Msg))
+	cachedResp2, loaded2 := dnsHandler.cache.Get(msg2)
+	require.True(t, loaded2)
+	assert.Equal(t, resp2.Answer[0].String(), cachedResp2.Answer[0].String())
 }
 
 func TestDNS_Integration_ConcurrentBlockedDomainsUpdate(t *testing.T) {
@@ -134,7 +116,7 @@ func TestDNS_Integration_ConcurrentBlockedDomainsUpdate(t *testing.T) {
 		{ID: 1, Domain: "malware1.com.", Recursive: false},
 		{ID: 2, Domain: "malware2.com.", Recursive: false},
 	}
-	dnsHandler.updateBlockedDomainsMap(initialDomains)
+	dnsHandler.updateBlocklist(initialDomains)
 
 	done := make(chan bool, 2)
 
@@ -145,19 +127,7 @@ func TestDNS_Integration_ConcurrentBlockedDomainsUpdate(t *testing.T) {
 				{Name: "malware1.com.", Qtype: dns.TypeA},
 			}
 
-			isBlocked := false
-			dnsHandler.blockedDomainsMutext.Lock()
-			for _, bds := range dnsHandler.blockedDomainsMap {
-				for _, q := range msg.Question {
-					for _, bd := range bds {
-						if q.Name == bd.Domain {
-							isBlocked = true
-							break
-						}
-					}
-				}
-			}
-			dnsHandler.blockedDomainsMutext.Unlock()
+			_, isBlocked := dnsHandler.blockedBy(nil, msg.Question[0].Name, dns.TypeA)
 			_ = isBlocked
 			time.Sleep(time.Microsecond)
 		}
@@ -169,7 +139,7 @@ func TestDNS_Integration_ConcurrentBlockedDomainsUpdate(t *testing.T) {
 			newDomains := []blockeddomains.BlockedDomain{
 				{ID: 3, Domain: "newmalware.com.", Recursive: false},
 			}
-			dnsHandler.updateBlockedDomainsMap(newDomains)
+			dnsHandler.updateBlocklist(newDomains)
 			time.Sleep(time.Millisecond)
 		}
 		done <- true
@@ -178,14 +148,15 @@ func TestDNS_Integration_ConcurrentBlockedDomainsUpdate(t *testing.T) {
 	<-done
 	<-done
 
-	dnsHandler.blockedDomainsMutext.Lock()
-	defer dnsHandler.blockedDomainsMutext.Unlock()
-	assert.Contains(t, dnsHandler.blockedDomainsMap, "3")
-	assert.NotContains(t, dnsHandler.blockedDomainsMap, "1")
-	assert.NotContains(t, dnsHandler.blockedDomainsMap, "2")
+	_, blocked := dnsHandler.blockedBy(nil, "newmalware.com.", dns.TypeA)
+	assert.True(t, blocked)
+	_, blocked = dnsHandler.blockedBy(nil, "malware1.com.", dns.TypeA)
+	assert.False(t, blocked)
+	_, blocked = dnsHandler.blockedBy(nil, "malware2.com.", dns.TypeA)
+	assert.False(t, blocked)
 }
 
-func TestDNS_Integration_BlockedDomainsMapConsistency(t *testing.T) {
+func TestDNS_Integration_BlocklistConsistency(t *testing.T) {
 	dnsHandler := createTestDNS()
 
 	domains := []blockeddomains.BlockedDomain{
@@ -194,51 +165,46 @@ func TestDNS_Integration_BlockedDomainsMapConsistency(t *testing.T) {
 		{ID: 2, Domain: ".ads.example.com", Recursive: true},
 	}
 
-	dnsHandler.updateBlockedDomainsMap(domains)
-
-	assert.Len(t, dnsHandler.blockedDomainsMap, 2)
+	dnsHandler.updateBlocklist(domains)
 
-	group1, exists1 := dnsHandler.blockedDomainsMap["1"]
-	require.True(t, exists1)
-	assert.Len(t, group1, 2)
+	assert.Equal(t, 3, dnsHandler.blocklist.Load().rules)
 
-	domainNames := make([]string, len(group1))
-	for i, bd := range group1 {
-		domainNames[i] = bd.Domain
+	for _, name := range []string{"malware.com.", "phishing.com."} {
+		bd, ok := dnsHandler.blockedBy(nil, name, dns.TypeA)
+		require.True(t, ok, name)
+		assert.Equal(t, int64(1), bd.ID)
+		assert.Equal(t, name, bd.Domain)
 	}
-	assert.Contains(t, domainNames, "malware.com.")
-	assert.Contains(t, domainNames, "phishing.com.")
-
-	group2, exists2 := dnsHandler.blockedDomainsMap["2"]
-	require.True(t, exists2)
-	assert.Len(t, group2, 1)
-	assert.Equal(t, ".ads.example.com", group2[0].Domain)
-	assert.True(t, group2[0].Recursive)
+
+	bd, ok := dnsHandler.blockedBy(nil, "tracker.ads.example.com.", dns.TypeA)
+	require.True(t, ok)
+	assert.Equal(t, ".ads.example.com", bd.Domain)
+	assert.True(t, bd.Recursive)
 }
 
 func TestDNS_Integration_MessageCacheKeyConsistency(t *testing.T) {
 	dnsHandler := createTestDNS()
 
 	msg1 := &dns.Msg{}
-	msg1.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
-	}
+	msg1.SetQuestion("google.com.", dns.TypeA)
 
 	msg2 := &dns.Msg{}
-	msg2.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
-	}
+	msg2.SetQuestion("Google.COM.", dns.TypeA)
+	msg2.Id = msg1.Id + 1
 
-	key1 := msg1.String()
-	key2 := msg2.String()
+	key1, ok := cache.KeyFromMsg(msg1)
+	require.True(t, ok)
+	key2, ok := cache.KeyFromMsg(msg2)
+	require.True(t, ok)
 	assert.Equal(t, key1, key2)
 
-	resp := &dns.Msg{}
-	resp.SetReply(msg1)
+	resp, err := answerWithA(300, "10.0.0.1")(msg1)
+	require.NoError(t, err)
 
-	dnsHandler.cacheMap.Store(key1, resp)
+	dnsHandler.cache.Set(msg1, resp)
 
-	cachedResp, loaded := dnsHandler.cacheMap.Load(key2)
+	cachedResp, loaded := dnsHandler.cache.Get(msg2)
 	require.True(t, loaded)
-	assert.Equal(t, resp, cachedResp.(*dns.Msg))
+	assert.Equal(t, msg2.Id, cachedResp.Id)
+	assert.Equal(t, "Google.COM.", cachedResp.Question[0].Name)
 }
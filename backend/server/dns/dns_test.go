@@ -2,8 +2,10 @@ package dns
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,10 +14,15 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/orion-tec/oriondns/config"
 	"github.com/orion-tec/oriondns/internal/ai"
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
 	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/cache"
+	"github.com/orion-tec/oriondns/internal/dnssec"
 	"github.com/orion-tec/oriondns/internal/domains"
 	"github.com/orion-tec/oriondns/internal/stats"
+	"github.com/orion-tec/oriondns/internal/upstream"
 )
 
 type MockAI struct {
@@ -36,11 +43,42 @@ func (m *MockBlockedDomains) Insert(ctx context.Context, domain string, recursiv
 	return args.Error(0)
 }
 
+func (m *MockBlockedDomains) InsertRule(ctx context.Context, rule blockeddomains.BlockedDomain) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
 func (m *MockBlockedDomains) GetAll(ctx context.Context) ([]blockeddomains.BlockedDomain, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]blockeddomains.BlockedDomain), args.Error(1)
 }
 
+func (m *MockBlockedDomains) SetResponse(
+	ctx context.Context, id int64, response, sinkholeIPv4, sinkholeIPv6 string,
+) error {
+	args := m.Called(ctx, id, response, sinkholeIPv4, sinkholeIPv6)
+	return args.Error(0)
+}
+
+type MockAllowedDomains struct {
+	mock.Mock
+}
+
+func (m *MockAllowedDomains) Insert(ctx context.Context, domain string, recursive bool) error {
+	args := m.Called(ctx, domain, recursive)
+	return args.Error(0)
+}
+
+func (m *MockAllowedDomains) InsertRule(ctx context.Context, rule alloweddomains.AllowedDomain) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *MockAllowedDomains) GetAll(ctx context.Context) ([]alloweddomains.AllowedDomain, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]alloweddomains.AllowedDomain), args.Error(1)
+}
+
 type MockDomains struct {
 	mock.Mock
 }
@@ -68,6 +106,11 @@ func (m *MockDomains) GetDomainsWithoutCategory(ctx context.Context) ([]domains.
 	return args.Get(0).([]domains.Domain), args.Error(1)
 }
 
+func (m *MockDomains) GetMostUsed(ctx context.Context, limit int) ([]domains.Domain, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]domains.Domain), args.Error(1)
+}
+
 type MockStats struct {
 	mock.Mock
 }
@@ -105,20 +148,109 @@ func (m *MockStats) GetServerUsageByTimeRange(
 	return args.Get(0).([]stats.ServerUsageByTimeRangeResponse), args.Error(1)
 }
 
+func (m *MockStats) InsertClient(ctx context.Context, t time.Time, client string) error {
+	args := m.Called(ctx, t, client)
+	return args.Error(0)
+}
+
+func (m *MockStats) SetClientHostname(ctx context.Context, client, hostname string) error {
+	args := m.Called(ctx, client, hostname)
+	return args.Error(0)
+}
+
+func (m *MockStats) GetMostActiveClients(
+	ctx context.Context, from, to time.Time, limit int,
+) ([]stats.MostActiveClientResponse, error) {
+	args := m.Called(ctx, from, to, limit)
+	return args.Get(0).([]stats.MostActiveClientResponse), args.Error(1)
+}
+
+func (m *MockStats) ReplaceUpstreamStats(ctx context.Context, upstreams []stats.UpstreamStats) error {
+	args := m.Called(ctx, upstreams)
+	return args.Error(0)
+}
+
+func (m *MockStats) GetUpstreamStats(ctx context.Context) ([]stats.UpstreamStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]stats.UpstreamStats), args.Error(1)
+}
+
+// testResponseWriter records the message written by a handler.
+type testResponseWriter struct {
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func newUDPResponseWriter() *testResponseWriter {
+	return &testResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.168.0.10"), Port: 5353}}
+}
+
+func newTCPResponseWriter() *testResponseWriter {
+	return &testResponseWriter{remote: &net.TCPAddr{IP: net.ParseIP("192.168.0.10"), Port: 5353}}
+}
+
+func (w *testResponseWriter) LocalAddr() net.Addr       { return &net.UDPAddr{IP: net.IPv4zero, Port: 53} }
+func (w *testResponseWriter) RemoteAddr() net.Addr      { return w.remote }
+func (w *testResponseWriter) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+func (w *testResponseWriter) Write([]byte) (int, error) { return 0, nil }
+func (w *testResponseWriter) Close() error              { return nil }
+func (w *testResponseWriter) TsigStatus() error         { return nil }
+func (w *testResponseWriter) TsigTimersOnly(bool)       {}
+func (w *testResponseWriter) Hijack()                   {}
+
+// testUpstream is an upstream.Pool answering every query with handler.
+type testUpstream struct {
+	hits    atomic.Int32
+	handler func(req *dns.Msg) (*dns.Msg, error)
+	stats   []upstream.Stats
+}
+
+func (u *testUpstream) Exchange(_ context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	u.hits.Add(1)
+	return u.handler(msg)
+}
+
+func (u *testUpstream) Stats() []upstream.Stats { return u.stats }
+func (u *testUpstream) Start()                  {}
+func (u *testUpstream) Stop()                   {}
+
+func answerWithA(ttl uint32, ip string) func(req *dns.Msg) (*dns.Msg, error) {
+	return func(req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN A %s", req.Question[0].Name, ttl, ip))
+		if err != nil {
+			return nil, err
+		}
+		resp.Answer = append(resp.Answer, rr)
+		return resp, nil
+	}
+}
+
 func createTestDNS() *DNS {
 	mockAI := &MockAI{}
+
+	mockDomains := &MockDomains{}
+	mockDomains.On("Insert", mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockStats := &MockStats{}
+	mockStats.On("Insert", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockStats.On("InsertClient", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	mockStats.On("SetClientHostname", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
 	return &DNS{
-		cacheMap:             sync.Map{},
-		blockedDomainsMap:    make(map[string][]blockeddomains.BlockedDomain),
-		blockedDomainsMutext: sync.Mutex{},
-		blockedDomains:       &MockBlockedDomains{},
-		domain:               &MockDomains{},
-		stats:                &MockStats{},
-		ai:                   ai.AI(mockAI),
+		cache:          cache.New(cache.Options{MaxEntries: 100}),
+		blockedDomains: &MockBlockedDomains{},
+		allowedDomains: &MockAllowedDomains{},
+		domain:         mockDomains,
+		stats:          mockStats,
+		ai:             ai.AI(mockAI),
+		upstreams:      &testUpstream{handler: answerWithA(300, "10.0.0.1")},
+		blockResponse:  blockResponse{mode: blockeddomains.ResponseNullIP, ttl: 10},
+		now:            time.Now,
 	}
 }
 
-func TestDNS_updateBlockedDomainsMap(t *testing.T) {
+func TestDNS_updateBlocklist(t *testing.T) {
 	dnsHandler := createTestDNS()
 
 	testDomains := []blockeddomains.BlockedDomain{
@@ -126,192 +258,291 @@ func TestDNS_updateBlockedDomainsMap(t *testing.T) {
 		{ID: 2, Domain: ".ads.example.com", Recursive: true},
 	}
 
-	dnsHandler.updateBlockedDomainsMap(testDomains)
+	dnsHandler.updateBlocklist(testDomains)
 
-	assert.Len(t, dnsHandler.blockedDomainsMap, 2)
-	assert.Contains(t, dnsHandler.blockedDomainsMap, "1")
-	assert.Contains(t, dnsHandler.blockedDomainsMap, "2")
+	assert.Equal(t, 2, dnsHandler.blocklist.Load().rules)
 
-	assert.Equal(t, "malware.com", dnsHandler.blockedDomainsMap["1"][0].Domain)
-	assert.False(t, dnsHandler.blockedDomainsMap["1"][0].Recursive)
+	bd, ok := dnsHandler.blockedBy(nil, "malware.com.", dns.TypeA)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), bd.ID)
+	assert.False(t, bd.Recursive)
 
-	assert.Equal(t, ".ads.example.com", dnsHandler.blockedDomainsMap["2"][0].Domain)
-	assert.True(t, dnsHandler.blockedDomainsMap["2"][0].Recursive)
+	bd, ok = dnsHandler.blockedBy(nil, "tracker.ads.example.com.", dns.TypeA)
+	require.True(t, ok)
+	assert.Equal(t, ".ads.example.com", bd.Domain)
+	assert.True(t, bd.Recursive)
 }
 
-func TestDNS_updateBlockedDomainsMap_ClearsExisting(t *testing.T) {
+func TestDNS_updateBlocklist_ReplacesExisting(t *testing.T) {
 	dnsHandler := createTestDNS()
 
 	oldDomains := []blockeddomains.BlockedDomain{
 		{ID: 1, Domain: "old.com", Recursive: false},
 	}
-	dnsHandler.updateBlockedDomainsMap(oldDomains)
-	assert.Len(t, dnsHandler.blockedDomainsMap, 1)
+	dnsHandler.updateBlocklist(oldDomains)
+	_, ok := dnsHandler.blockedBy(nil, "old.com.", dns.TypeA)
+	assert.True(t, ok)
 
 	newDomains := []blockeddomains.BlockedDomain{
 		{ID: 2, Domain: "new.com", Recursive: false},
 	}
-	dnsHandler.updateBlockedDomainsMap(newDomains)
+	dnsHandler.updateBlocklist(newDomains)
 
-	assert.Len(t, dnsHandler.blockedDomainsMap, 1)
-	assert.Contains(t, dnsHandler.blockedDomainsMap, "2")
-	assert.NotContains(t, dnsHandler.blockedDomainsMap, "1")
+	_, ok = dnsHandler.blockedBy(nil, "new.com.", dns.TypeA)
+	assert.True(t, ok)
+	_, ok = dnsHandler.blockedBy(nil, "old.com.", dns.TypeA)
+	assert.False(t, ok)
 }
 
-func TestDNS_DomainBlocking_ExactMatch(t *testing.T) {
+func TestDNS_blockedBy_NoBlocklist(t *testing.T) {
 	dnsHandler := createTestDNS()
 
-	blockedDomains := []blockeddomains.BlockedDomain{
-		{ID: 1, Domain: "malware.com.", Recursive: false},
-	}
-	dnsHandler.updateBlockedDomainsMap(blockedDomains)
+	_, ok := dnsHandler.blockedBy(nil, "malware.com.", dns.TypeA)
+	assert.False(t, ok)
+}
 
-	msg := &dns.Msg{}
-	msg.Question = []dns.Question{
-		{Name: "malware.com.", Qtype: dns.TypeA},
+func TestDNS_DomainBlocking(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "malware.com.", Recursive: false},
+		{ID: 2, Domain: ".ads.example.com", Recursive: true},
+		{ID: 3, Domain: "evil.com", Recursive: true},
+	})
+
+	testCases := []struct {
+		name        string
+		shouldBlock bool
+	}{
+		{"malware.com.", true},
+		{"MalWare.Com.", true},
+		{"www.malware.com.", false},
+		{"tracker.ads.example.com.", true},
+		{"ads.example.com.", true},
+		{"safe.example.com.", false},
+		{"evil.com.", true},
+		{"cdn.evil.com.", true},
+		{"notevil.com.", false},
+		{"google.com.", false},
 	}
 
-	isBlocked := false
-	for _, bds := range dnsHandler.blockedDomainsMap {
-		for _, q := range msg.Question {
-			for _, bd := range bds {
-				if bd.Recursive && strings.HasSuffix(q.Name, bd.Domain) {
-					isBlocked = true
-					break
-				}
-				if q.Name == bd.Domain {
-					isBlocked = true
-					break
-				}
-			}
-		}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, isBlocked := dnsHandler.blockedBy(nil, tc.name, dns.TypeA)
+			assert.Equal(t, tc.shouldBlock, isBlocked)
+		})
 	}
-
-	assert.True(t, isBlocked)
 }
 
-func TestDNS_DomainBlocking_RecursiveMatch(t *testing.T) {
+func TestDNS_handleRequest_Blocked(t *testing.T) {
 	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "evil.com", Recursive: true},
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("cdn.evil.com.", dns.TypeA)
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	assert.Equal(t, req.Id, rw.msg.Id)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "0.0.0.0", rw.msg.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, uint32(10), rw.msg.Answer[0].Header().Ttl)
+
+	req = new(dns.Msg)
+	req.SetQuestion("notevil.com.", dns.TypeA)
+	rw = newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "10.0.0.1", rw.msg.Answer[0].(*dns.A).A.String())
+}
 
-	blockedDomains := []blockeddomains.BlockedDomain{
-		{ID: 1, Domain: ".ads.example.com", Recursive: true},
-	}
-	dnsHandler.updateBlockedDomainsMap(blockedDomains)
+func TestDNS_Cache_Store_Load(t *testing.T) {
+	dnsHandler := createTestDNS()
 
 	msg := &dns.Msg{}
-	msg.Question = []dns.Question{
-		{Name: "tracker.ads.example.com", Qtype: dns.TypeA},
-	}
+	msg.SetQuestion("google.com.", dns.TypeA)
 
-	isBlocked := false
-	for _, bds := range dnsHandler.blockedDomainsMap {
-		for _, q := range msg.Question {
-			for _, bd := range bds {
-				if bd.Recursive && strings.HasSuffix(q.Name, bd.Domain) {
-					isBlocked = true
-					break
-				}
-				if q.Name == bd.Domain {
-					isBlocked = true
-					break
-				}
-			}
-		}
-	}
+	respMsg, err := answerWithA(300, "10.0.0.1")(msg)
+	require.NoError(t, err)
 
-	assert.True(t, isBlocked)
+	dnsHandler.cache.Set(msg, respMsg)
+
+	cachedResp, loaded := dnsHandler.cache.Get(msg)
+	require.True(t, loaded)
+	assert.Equal(t, msg.Id, cachedResp.Id)
+	assert.Equal(t, respMsg.Answer[0].String(), cachedResp.Answer[0].String())
 }
 
-func TestDNS_DomainBlocking_NoMatch(t *testing.T) {
+func TestDNS_Cache_NotFound(t *testing.T) {
 	dnsHandler := createTestDNS()
 
-	blockedDomains := []blockeddomains.BlockedDomain{
-		{ID: 1, Domain: "malware.com.", Recursive: false},
-	}
-	dnsHandler.updateBlockedDomainsMap(blockedDomains)
-
 	msg := &dns.Msg{}
-	msg.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA},
-	}
+	msg.SetQuestion("google.com.", dns.TypeA)
 
-	isBlocked := false
-	for _, bds := range dnsHandler.blockedDomainsMap {
-		for _, q := range msg.Question {
-			for _, bd := range bds {
-				if bd.Recursive && strings.HasSuffix(q.Name, bd.Domain) {
-					isBlocked = true
-					break
-				}
-				if q.Name == bd.Domain {
-					isBlocked = true
-					break
-				}
-			}
-		}
-	}
-
-	assert.False(t, isBlocked)
+	_, loaded := dnsHandler.cache.Get(msg)
+	assert.False(t, loaded)
 }
 
-func TestDNS_DomainBlocking_RecursiveNoMatch(t *testing.T) {
+func TestDNS_handleRequest_ServesFromCache(t *testing.T) {
 	dnsHandler := createTestDNS()
+	up := dnsHandler.upstreams.(*testUpstream)
+
+	first := new(dns.Msg)
+	first.SetQuestion("google.com.", dns.TypeA)
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, first)
+	require.NotNil(t, rw.msg)
+	assert.Equal(t, first.Id, rw.msg.Id)
+
+	second := new(dns.Msg)
+	second.SetQuestion("google.com.", dns.TypeA)
+	rw = newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, second)
+	require.NotNil(t, rw.msg)
+	assert.Equal(t, second.Id, rw.msg.Id)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "10.0.0.1", rw.msg.Answer[0].(*dns.A).A.String())
+
+	assert.Equal(t, int32(1), up.hits.Load())
+}
 
-	blockedDomains := []blockeddomains.BlockedDomain{
-		{ID: 1, Domain: ".ads.example.com", Recursive: true},
+func largeTXTResponse(req *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	for i := 0; i < 20; i++ {
+		rr, _ := dns.NewRR(fmt.Sprintf(`large.example.com. 60 IN TXT "%s"`, strings.Repeat("x", 200)))
+		resp.Answer = append(resp.Answer, rr)
 	}
-	dnsHandler.updateBlockedDomainsMap(blockedDomains)
+	return resp
+}
 
-	msg := &dns.Msg{}
-	msg.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA},
-	}
+func TestWriteResponse_TruncatesForUDP(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("large.example.com.", dns.TypeTXT)
+	resp := largeTXTResponse(req)
 
-	isBlocked := false
-	for _, bds := range dnsHandler.blockedDomainsMap {
-		for _, q := range msg.Question {
-			for _, bd := range bds {
-				if bd.Recursive && strings.HasSuffix(q.Name, bd.Domain) {
-					isBlocked = true
-					break
-				}
-				if q.Name == bd.Domain {
-					isBlocked = true
-					break
-				}
-			}
-		}
-	}
+	rw := newUDPResponseWriter()
+	writeResponse(rw, req, resp)
 
-	assert.False(t, isBlocked)
+	require.NotNil(t, rw.msg)
+	assert.True(t, rw.msg.Truncated)
+	assert.LessOrEqual(t, rw.msg.Len(), dns.MinMsgSize)
+	// The original message must be left untouched so it can still be cached.
+	assert.Len(t, resp.Answer, 20)
+	assert.False(t, resp.Truncated)
 }
 
-func TestDNS_Cache_Store_Load(t *testing.T) {
+func TestWriteResponse_HonoursEDNS0BufferSize(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("large.example.com.", dns.TypeTXT)
+	req.SetEdns0(dns.MaxMsgSize, false)
+	resp := largeTXTResponse(req)
+
+	rw := newUDPResponseWriter()
+	writeResponse(rw, req, resp)
+
+	require.NotNil(t, rw.msg)
+	assert.False(t, rw.msg.Truncated)
+	assert.Len(t, rw.msg.Answer, 20)
+}
+
+func TestWriteResponse_DoesNotTruncateForTCP(t *testing.T) {
+	req := new(dns.Msg)
+	req.SetQuestion("large.example.com.", dns.TypeTXT)
+	resp := largeTXTResponse(req)
+
+	rw := newTCPResponseWriter()
+	writeResponse(rw, req, resp)
+
+	require.NotNil(t, rw.msg)
+	assert.False(t, rw.msg.Truncated)
+	assert.Len(t, rw.msg.Answer, 20)
+}
+
+// staleOnlyCache misses every fresh lookup and always has a stale answer.
+type staleOnlyCache struct {
+	cache.Cache
+	stale *dns.Msg
+}
+
+func (c *staleOnlyCache) Get(*dns.Msg) (*dns.Msg, bool) { return nil, false }
+func (c *staleOnlyCache) GetStale(req *dns.Msg) (*dns.Msg, bool) {
+	resp := c.stale.Copy()
+	resp.Id = req.Id
+	return resp, true
+}
+
+func failingUpstream(req *dns.Msg) (*dns.Msg, error) {
+	return nil, fmt.Errorf("upstream unreachable")
+}
+
+func TestDNS_handleRequest_UpstreamFailure_ServesStale(t *testing.T) {
 	dnsHandler := createTestDNS()
+	dnsHandler.upstreams = &testUpstream{handler: failingUpstream}
 
-	msg := &dns.Msg{}
-	msg.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA},
-	}
+	req := new(dns.Msg)
+	req.SetQuestion("google.com.", dns.TypeA)
+	stale, err := answerWithA(30, "10.0.0.9")(req)
+	require.NoError(t, err)
+	dnsHandler.cache = &staleOnlyCache{stale: stale}
 
-	respMsg := &dns.Msg{}
-	respMsg.SetReply(msg)
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
 
-	dnsHandler.cacheMap.Store(msg.String(), respMsg)
+	require.NotNil(t, rw.msg)
+	assert.Equal(t, dns.RcodeSuccess, rw.msg.Rcode)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "10.0.0.9", rw.msg.Answer[0].(*dns.A).A.String())
+}
 
-	cachedResp, loaded := dnsHandler.cacheMap.Load(msg.String())
-	require.True(t, loaded)
-	assert.Equal(t, respMsg, cachedResp.(*dns.Msg))
+func TestDNS_handleRequest_UpstreamFailure_Servfail(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.upstreams = &testUpstream{handler: failingUpstream}
+
+	req := new(dns.Msg)
+	req.SetQuestion("google.com.", dns.TypeA)
+
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	assert.Equal(t, req.Id, rw.msg.Id)
+	assert.Equal(t, dns.RcodeServerFailure, rw.msg.Rcode)
 }
 
-func TestDNS_Cache_NotFound(t *testing.T) {
+func TestDNS_isPopular(t *testing.T) {
 	dnsHandler := createTestDNS()
 
-	msg := &dns.Msg{}
-	msg.Question = []dns.Question{
-		{Name: "google.com.", Qtype: dns.TypeA},
-	}
+	req := new(dns.Msg)
+	req.SetQuestion("Google.com.", dns.TypeA)
+	assert.False(t, dnsHandler.isPopular(req))
 
-	_, loaded := dnsHandler.cacheMap.Load(msg.String())
-	assert.False(t, loaded)
+	popular := map[string]struct{}{"google.com.": {}}
+	dnsHandler.popularDomains.Store(&popular)
+	assert.True(t, dnsHandler.isPopular(req))
+
+	req.SetQuestion("facebook.com.", dns.TypeA)
+	assert.False(t, dnsHandler.isPopular(req))
+}
+
+func TestNewUpstreams(t *testing.T) {
+	cfg := &config.Config{}
+	pool, err := newUpstreams(cfg)
+	require.NoError(t, err)
+	require.Len(t, pool.Stats(), 1)
+	assert.Equal(t, upstream.DefaultServer, pool.Stats()[0].Address)
+
+	cfg.DNS.Recursion.Enabled = true
+	pool, err = newUpstreams(cfg)
+	require.NoError(t, err)
+	assert.Empty(t, pool.Stats())
+
+	cfg.DNS.DNSSEC.Enabled = true
+	cfg.DNS.DNSSEC.TrustAnchors = []string{"example.com. IN A 10.0.0.1"}
+	_, err = newUpstreams(cfg)
+	assert.ErrorIs(t, err, dnssec.ErrInvalidTrustAnchor)
 }
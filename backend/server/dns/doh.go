@@ -0,0 +1,183 @@
+package dns
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultDoHAddr = ":443"
+
+	dohPath        = "/dns-query"
+	dohContentType = "application/dns-message"
+)
+
+var clientIDRegexp = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// dohResponseWriter adapts an HTTP request to dns.ResponseWriter so DoH
+// queries go through the same handler as the other transports. ClientID
+// carries the device identifier taken from the request path.
+type dohResponseWriter struct {
+	local    net.Addr
+	remote   net.Addr
+	clientID string
+	msg      *dns.Msg
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr       { return w.local }
+func (w *dohResponseWriter) RemoteAddr() net.Addr      { return w.remote }
+func (w *dohResponseWriter) ClientID() string          { return w.clientID }
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+func (w *dohResponseWriter) Close() error              { return nil }
+func (w *dohResponseWriter) TsigStatus() error         { return nil }
+func (w *dohResponseWriter) TsigTimersOnly(bool)       {}
+func (w *dohResponseWriter) Hijack()                   {}
+
+func (w *dohResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func newDoHServer(addr string, handler dns.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      newDoHHandler(handler),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+}
+
+// newDoHHandler serves RFC 8484 queries on /dns-query and on
+// /dns-query/{clientID} for per-device identification.
+func newDoHHandler(handler dns.Handler) http.Handler {
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.PathValue("clientID")
+		if clientID != "" && !clientIDRegexp.MatchString(clientID) {
+			http.Error(w, "invalid client id", http.StatusBadRequest)
+			return
+		}
+
+		msg, status, err := readDoHRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		rw := &dohResponseWriter{
+			local:    toNetAddr(r.Context().Value(http.LocalAddrContextKey)),
+			remote:   toNetAddr(r.RemoteAddr),
+			clientID: clientID,
+		}
+		handler.ServeDNS(rw, msg)
+
+		if rw.msg == nil {
+			http.Error(w, "no response", http.StatusBadGateway)
+			return
+		}
+
+		data, err := rw.msg.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", dohContentType)
+		if ttl, ok := minAnswerTTL(rw.msg); ok {
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", ttl))
+		}
+		_, _ = w.Write(data)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+dohPath, serve)
+	mux.HandleFunc("POST "+dohPath, serve)
+	mux.HandleFunc("GET "+dohPath+"/{clientID}", serve)
+	mux.HandleFunc("POST "+dohPath+"/{clientID}", serve)
+	return mux
+}
+
+// readDoHRequest decodes the DNS message of a DoH request, returning the
+// HTTP status to reply with when it is invalid.
+func readDoHRequest(r *http.Request) (*dns.Msg, int, error) {
+	var data []byte
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("missing dns parameter")
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(param)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid dns parameter: %w", err)
+		}
+		data = decoded
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohContentType {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type")
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if len(body) > dns.MaxMsgSize {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("message too large")
+		}
+		data = body
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(data); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid dns message: %w", err)
+	}
+	if len(msg.Question) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("dns message without question")
+	}
+
+	return msg, http.StatusOK, nil
+}
+
+// minAnswerTTL returns the lowest TTL of the answer, used as HTTP freshness
+// lifetime as recommended by RFC 8484.
+func minAnswerTTL(msg *dns.Msg) (uint32, bool) {
+	var ttl uint32
+	found := false
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+
+	return ttl, found
+}
+
+func toNetAddr(v any) net.Addr {
+	switch addr := v.(type) {
+	case net.Addr:
+		return addr
+	case string:
+		if tcpAddr, err := net.ResolveTCPAddr("tcp", addr); err == nil {
+			return tcpAddr
+		}
+	}
+
+	return &net.TCPAddr{}
+}
@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func packedQuery(t *testing.T, name string) []byte {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	data, err := req.Pack()
+	require.NoError(t, err)
+	return data
+}
+
+func unpackDoHResponse(t *testing.T, rr *httptest.ResponseRecorder) *dns.Msg {
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, dohContentType, rr.Header().Get("Content-Type"))
+
+	resp := new(dns.Msg)
+	require.NoError(t, resp.Unpack(rr.Body.Bytes()))
+	return resp
+}
+
+func TestDoH_Get(t *testing.T) {
+	h := newDoHHandler(createTestDNS().handleRequest())
+
+	query := base64.RawURLEncoding.EncodeToString(packedQuery(t, "google.com."))
+	req := httptest.NewRequest(http.MethodGet, "/dns-query?dns="+query, nil)
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	resp := unpackDoHResponse(t, rr)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, "max-age=300", rr.Header().Get("Cache-Control"))
+}
+
+func TestDoH_Post(t *testing.T) {
+	h := newDoHHandler(createTestDNS().handleRequest())
+
+	req := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(packedQuery(t, "google.com.")))
+	req.Header.Set("Content-Type", dohContentType)
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	resp := unpackDoHResponse(t, rr)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+}
+
+func TestDoH_ClientIDPath(t *testing.T) {
+	var gotClientID string
+	h := newDoHHandler(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		gotClientID = w.(*dohResponseWriter).ClientID()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/dns-query/kids-tablet", bytes.NewReader(packedQuery(t, "google.com.")))
+	req.Header.Set("Content-Type", dohContentType)
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	unpackDoHResponse(t, rr)
+	assert.Equal(t, "kids-tablet", gotClientID)
+}
+
+func TestDoH_InvalidRequests(t *testing.T) {
+	h := newDoHHandler(createTestDNS().handleRequest())
+	valid := packedQuery(t, "google.com.")
+
+	testCases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{"Missing dns parameter", http.MethodGet, "/dns-query", "", nil, http.StatusBadRequest},
+		{"Padded base64", http.MethodGet, "/dns-query?dns=" + base64.URLEncoding.EncodeToString(valid) + "==", "",
+			nil, http.StatusBadRequest},
+		{"Garbage message", http.MethodPost, "/dns-query", dohContentType, []byte("garbage"), http.StatusBadRequest},
+		{"Wrong content type", http.MethodPost, "/dns-query", "application/json", valid, http.StatusUnsupportedMediaType},
+		{"Invalid client id", http.MethodPost, "/dns-query/bad_id!", dohContentType, valid, http.StatusBadRequest},
+		{"Unsupported method", http.MethodPut, "/dns-query", dohContentType, valid, http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			h.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.status, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	defaultDoQAddr = ":853"
+
+	// Error codes defined by RFC 9250, section 4.3.
+	doqInternalError quic.ApplicationErrorCode = 0x1
+	doqProtocolError quic.ApplicationErrorCode = 0x2
+
+	doqStreamTimeout = 10 * time.Second
+)
+
+var errDoQProtocol = fmt.Errorf("doq protocol error")
+
+// doqServer serves RFC 9250 DNS-over-QUIC, one query per stream.
+type doqServer struct {
+	addr      string
+	handler   dns.Handler
+	tlsConfig *tls.Config
+
+	listener *quic.Listener
+}
+
+// doqResponseWriter captures the handler response for a single stream.
+type doqResponseWriter struct {
+	local  net.Addr
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (w *doqResponseWriter) LocalAddr() net.Addr       { return w.local }
+func (w *doqResponseWriter) RemoteAddr() net.Addr      { return w.remote }
+func (w *doqResponseWriter) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+func (w *doqResponseWriter) Close() error              { return nil }
+func (w *doqResponseWriter) TsigStatus() error         { return nil }
+func (w *doqResponseWriter) TsigTimersOnly(bool)       {}
+func (w *doqResponseWriter) Hijack()                   {}
+
+func (w *doqResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func newDoQServer(addr string, handler dns.Handler, tlsConfig *tls.Config) *doqServer {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"doq"}
+	tlsConfig.MinVersion = tls.VersionTLS13
+
+	return &doqServer{
+		addr:      addr,
+		handler:   handler,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// listen binds the UDP socket, so errors surface before serving starts.
+func (s *doqServer) listen() error {
+	l, err := quic.ListenAddr(s.addr, s.tlsConfig, &quic.Config{MaxIdleTimeout: 30 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	s.listener = l
+	return nil
+}
+
+func (s *doqServer) serve() error {
+	for {
+		conn, err := s.listener.Accept(context.Background())
+		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *doqServer) Shutdown() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *doqServer) serveConn(conn *quic.Conn) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+
+		go func() {
+			err := s.serveStream(conn, stream)
+			if errors.Is(err, errDoQProtocol) {
+				_ = conn.CloseWithError(doqProtocolError, err.Error())
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to serve doq stream: %s\n", err.Error())
+				stream.CancelWrite(quic.StreamErrorCode(doqInternalError))
+			}
+		}()
+	}
+}
+
+// serveStream reads a single length-prefixed query, passes it to the handler
+// and writes the response back before closing the stream.
+func (s *doqServer) serveStream(conn *quic.Conn, stream *quic.Stream) error {
+	_ = stream.SetDeadline(time.Now().Add(doqStreamTimeout))
+
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		return fmt.Errorf("%w: %w", errDoQProtocol, err)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(stream, data); err != nil {
+		return fmt.Errorf("%w: %w", errDoQProtocol, err)
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(data); err != nil {
+		return fmt.Errorf("%w: %w", errDoQProtocol, err)
+	}
+
+	// RFC 9250 requires the message ID to be zero.
+	if msg.Id != 0 {
+		return fmt.Errorf("%w: non-zero message id", errDoQProtocol)
+	}
+
+	rw := &doqResponseWriter{local: conn.LocalAddr(), remote: conn.RemoteAddr()}
+	s.handler.ServeDNS(rw, msg)
+	if rw.msg == nil {
+		return fmt.Errorf("handler wrote no response")
+	}
+
+	resp, err := rw.msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	out := make([]byte, 2+len(resp))
+	binary.BigEndian.PutUint16(out, uint16(len(resp)))
+	copy(out[2:], resp)
+	if _, err := stream.Write(out); err != nil {
+		return err
+	}
+
+	return stream.Close()
+}
@@ -0,0 +1,131 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startTestDoQServer(t *testing.T, handler dns.Handler) string {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir(), "oriondns")
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	srv := newDoQServer("127.0.0.1:0", handler, r.tlsConfig())
+	require.NoError(t, srv.listen())
+	go func() {
+		_ = srv.serve()
+	}()
+	t.Cleanup(func() {
+		_ = srv.Shutdown()
+	})
+
+	return srv.listener.Addr().String()
+}
+
+func dialTestDoQ(t *testing.T, addr string) *quic.Conn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.CloseWithError(0, "")
+	})
+
+	return conn
+}
+
+func doqExchange(conn *quic.Conn, req *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(out, uint16(len(data)))
+	copy(out[2:], data)
+	if _, err := stream.Write(out); err != nil {
+		return nil, err
+	}
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+
+	var length uint16
+	if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(stream, buf); err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	return resp, resp.Unpack(buf)
+}
+
+func TestDoQ_ServesHandler(t *testing.T) {
+	addr := startTestDoQServer(t, createTestDNS().handleRequest())
+	conn := dialTestDoQ(t, addr)
+
+	for _, name := range []string{"google.com.", "facebook.com."} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		req.Id = 0
+
+		resp, err := doqExchange(conn, req)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(0), resp.Id)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, name, resp.Answer[0].Header().Name)
+	}
+}
+
+func TestDoQ_DoesNotTruncateLargeAnswers(t *testing.T) {
+	addr := startTestDoQServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		writeResponse(w, r, largeTXTResponse(r))
+	}))
+	conn := dialTestDoQ(t, addr)
+
+	req := new(dns.Msg)
+	req.SetQuestion("large.example.com.", dns.TypeTXT)
+	req.Id = 0
+
+	resp, err := doqExchange(conn, req)
+	require.NoError(t, err)
+	assert.False(t, resp.Truncated)
+	assert.Len(t, resp.Answer, 20)
+}
+
+func TestDoQ_NonZeroIDIsProtocolError(t *testing.T) {
+	addr := startTestDoQServer(t, createTestDNS().handleRequest())
+	conn := dialTestDoQ(t, addr)
+
+	req := new(dns.Msg)
+	req.SetQuestion("google.com.", dns.TypeA)
+	req.Id = 1234
+
+	_, err := doqExchange(conn, req)
+	require.Error(t, err)
+
+	var appErr *quic.ApplicationError
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, doqProtocolError, appErr.ErrorCode)
+}
@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/matcher"
+	"github.com/orion-tec/oriondns/internal/rpz"
+)
+
+type action int
+
+const (
+	actionNone action = iota
+	actionAllow
+	actionBlock
+	// actionRPZ applies a response policy zone rewrite.
+	actionRPZ
+)
+
+// decision is the outcome of checking a name against the allow and block
+// rules.
+type decision struct {
+	action action
+	// rule describes the rule that won, for logs.
+	rule string
+	// block is the matching block rule when action is actionBlock.
+	block blockRule
+	// policy is the matching response policy when action is actionRPZ.
+	policy *rpz.Policy
+}
+
+// decide checks a query for name and qtype from a client of g against the
+// allow rules, the response policy zones, the block rules and the blocked
+// categories, in that order. Allow rules take precedence, so an allowed
+// subdomain of a recursively blocked domain resolves normally, and RPZ
+// PASSTHRU policies act as allow rules. Rules scoped to a group only apply
+// to its clients.
+func (d *DNS) decide(g *clientGroup, name string, qtype uint16) decision {
+	if ad, ok := d.allowedBy(g, name); ok {
+		return decision{
+			action: actionAllow,
+			rule:   describeRule("allow", ad.ID, ad.Domain, ad.SubscriptionID, ad.GroupID),
+		}
+	}
+
+	if p, ok := d.rpzMatch(name); ok {
+		dec := decision{
+			action: actionRPZ,
+			rule:   fmt.Sprintf("rpz %s %s in %s", p.Action, p.Trigger, p.Zone),
+			policy: p,
+		}
+		if p.Action == rpz.ActionPassthru {
+			dec.action = actionAllow
+		}
+		return dec
+	}
+
+	if rule, ok := d.blockedBy(g, name, qtype); ok {
+		return decision{
+			action: actionBlock,
+			rule:   describeRule("block", rule.ID, rule.Domain, rule.SubscriptionID, rule.GroupID),
+			block:  rule,
+		}
+	}
+
+	if category, ok := d.blockedCategory(g, name, qtype); ok {
+		dec := decision{
+			action: actionBlock,
+			rule:   "category " + category,
+			block: blockRule{
+				BlockedDomain: blockeddomains.BlockedDomain{Domain: matcher.Normalize(name)},
+				response:      d.blockResponse,
+			},
+		}
+		if category == "" {
+			dec.rule = "uncategorized default"
+		}
+		return dec
+	}
+
+	return decision{}
+}
+
+func describeRule(kind string, id int64, domain string, subscriptionID, groupID *int64) string {
+	desc := fmt.Sprintf("%s rule %d (%s)", kind, id, domain)
+	if subscriptionID != nil {
+		desc += fmt.Sprintf(" from subscription %d", *subscriptionID)
+	}
+	if groupID != nil {
+		desc += fmt.Sprintf(" for group %d", *groupID)
+	}
+
+	return desc
+}
+
+func (d *DNS) updateAllowlist(allowedDomains []alloweddomains.AllowedDomain) {
+	allowlist := matcher.New[[]alloweddomains.AllowedDomain]()
+	for _, ad := range allowedDomains {
+		rules, _ := allowlist.Get(ad.Domain, ad.Recursive)
+		allowlist.Insert(ad.Domain, ad.Recursive, append(rules, ad))
+	}
+
+	d.allowlist.Store(allowlist)
+}
+
+func (d *DNS) updateAllowedDomains() {
+	for {
+		fmt.Println("Updating allowed domains")
+		ads, err := d.allowedDomains.GetAll(context.Background())
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			d.updateAllowlist(ads)
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+// allowedBy returns the most specific rule allowing name for a client of g,
+// if any.
+func (d *DNS) allowedBy(g *clientGroup, name string) (alloweddomains.AllowedDomain, bool) {
+	allowlist := d.allowlist.Load()
+	if allowlist == nil {
+		return alloweddomains.AllowedDomain{}, false
+	}
+
+	group := g.groupID()
+	var res alloweddomains.AllowedDomain
+	var found bool
+	allowlist.Walk(name, func(rules []alloweddomains.AllowedDomain) bool {
+		for _, ad := range rules {
+			if ad.GroupID == nil || *ad.GroupID == group {
+				res, found = ad, true
+				return false
+			}
+		}
+		return true
+	})
+
+	return res, found
+}
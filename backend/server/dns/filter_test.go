@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+)
+
+func TestDNS_decide(t *testing.T) {
+	subscriptionID := int64(3)
+	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "example.com", Recursive: true},
+		{ID: 2, Domain: "tracker.net", Recursive: false},
+	})
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{
+		{ID: 7, Domain: "cdn.example.com", Recursive: true},
+		{ID: 8, Domain: "login.example.com", Recursive: false},
+		{ID: 9, Domain: "tracker.net", Recursive: false},
+		{ID: 10, Domain: "pixel.example.com", Recursive: false, SubscriptionID: &subscriptionID},
+	})
+
+	testCases := []struct {
+		name   string
+		action action
+		rule   string
+	}{
+		{"example.com.", actionBlock, "block rule 1 (example.com)"},
+		{"www.example.com.", actionBlock, "block rule 1 (example.com)"},
+		{"cdn.example.com.", actionAllow, "allow rule 7 (cdn.example.com)"},
+		{"img.cdn.example.com.", actionAllow, "allow rule 7 (cdn.example.com)"},
+		{"login.example.com.", actionAllow, "allow rule 8 (login.example.com)"},
+		{"sso.login.example.com.", actionBlock, "block rule 1 (example.com)"},
+		{"tracker.net.", actionAllow, "allow rule 9 (tracker.net)"},
+		{"pixel.example.com.", actionAllow, "allow rule 10 (pixel.example.com) from subscription 3"},
+		{"google.com.", actionNone, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := dnsHandler.decide(nil, tc.name, dns.TypeA)
+			assert.Equal(t, tc.action, dec.action)
+			assert.Equal(t, tc.rule, dec.rule)
+		})
+	}
+}
+
+func TestDNS_updateAllowlist_ReplacesExisting(t *testing.T) {
+	dnsHandler := createTestDNS()
+
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{{ID: 1, Domain: "old.com"}})
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{{ID: 2, Domain: "new.com"}})
+
+	_, ok := dnsHandler.allowedBy(nil, "new.com.")
+	assert.True(t, ok)
+	_, ok = dnsHandler.allowedBy(nil, "old.com.")
+	assert.False(t, ok)
+}
+
+func TestDNS_handleRequest_AllowOverridesBlock(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "example.com", Recursive: true},
+	})
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{
+		{ID: 1, Domain: "cdn.example.com", Recursive: true},
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("cdn.example.com.", dns.TypeA)
+	rw := newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "10.0.0.1", rw.msg.Answer[0].(*dns.A).A.String())
+
+	req = new(dns.Msg)
+	req.SetQuestion("www.example.com.", dns.TypeA)
+	rw = newUDPResponseWriter()
+	dnsHandler.handleRequest()(rw, req)
+
+	require.NotNil(t, rw.msg)
+	require.Len(t, rw.msg.Answer, 1)
+	assert.Equal(t, "0.0.0.0", rw.msg.Answer[0].(*dns.A).A.String())
+}
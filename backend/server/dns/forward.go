@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/matcher"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+var ErrInvalidForwardRule = fmt.Errorf("invalid forwarding rule")
+
+// forwarders sends the queries under the domains of the conditional
+// forwarding rules to their upstreams.
+type forwarders struct {
+	trie  *matcher.Trie[upstream.Pool]
+	pools []upstream.Pool
+}
+
+// newForwarders returns the configured forwarding rules, or nil when there
+// are none. The private reverse zones go to their servers, when set, unless
+// a rule covers them.
+func newForwarders(cfg *config.Config) (*forwarders, error) {
+	if len(cfg.DNS.Forwarding.Rules) == 0 && len(cfg.DNS.PrivateReverse.Servers) == 0 {
+		return nil, nil
+	}
+
+	f := &forwarders{trie: matcher.New[upstream.Pool]()}
+	if servers := cfg.DNS.PrivateReverse.Servers; len(servers) > 0 {
+		zones := privateReverseZones()
+		pool, err := f.newPool(cfg, servers, cfg.DNS.PrivateReverse.Transport, "", zones[0])
+		if err != nil {
+			return nil, fmt.Errorf("private reverse zones: %w", err)
+		}
+
+		for _, zone := range zones {
+			f.trie.Insert(zone, true, pool)
+		}
+	}
+
+	for _, rule := range cfg.DNS.Forwarding.Rules {
+		if len(rule.Domains) == 0 || len(rule.Servers) == 0 {
+			return nil, fmt.Errorf("%w: %v needs domains and servers", ErrInvalidForwardRule, rule.Domains)
+		}
+
+		var zones []string
+		for _, domain := range rule.Domains {
+			domainZones, err := forwardZones(domain)
+			if err != nil {
+				return nil, err
+			}
+			zones = append(zones, domainZones...)
+		}
+
+		pool, err := f.newPool(cfg, rule.Servers, rule.Transport, rule.Strategy, zones[0])
+		if err != nil {
+			return nil, fmt.Errorf("forwarding %v: %w", rule.Domains, err)
+		}
+
+		for _, zone := range zones {
+			f.trie.Insert(zone, true, pool)
+		}
+	}
+
+	return f, nil
+}
+
+// newPool returns the upstreams of a rule, health checked by asking for the
+// SOA of checkZone, one of the zones of the rule, as forwarders often answer
+// only for their own zones.
+func (f *forwarders) newPool(
+	cfg *config.Config, servers []string, transport, strategy, checkZone string,
+) (upstream.Pool, error) {
+	servers, err := withTransport(servers, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := upstream.New(upstream.Options{
+		Servers:             servers,
+		Strategy:            upstream.Strategy(strategy),
+		Timeout:             cfg.DNS.Upstream.Timeout,
+		HealthCheckInterval: cfg.DNS.Upstream.HealthCheckInterval,
+		HealthCheckZone:     checkZone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.pools = append(f.pools, pool)
+
+	return pool, nil
+}
+
+// withTransport turns the host:port servers into URLs of transport, leaving
+// the servers given as URLs alone.
+func withTransport(servers []string, transport string) ([]string, error) {
+	switch transport {
+	case "":
+		return servers, nil
+	case "udp", "tcp", "tls", "https":
+	default:
+		return nil, fmt.Errorf("%w: unknown transport %s", ErrInvalidForwardRule, transport)
+	}
+
+	res := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if !strings.Contains(server, "://") {
+			server = transport + "://" + server
+		}
+		res = append(res, server)
+	}
+
+	return res, nil
+}
+
+// forwardZones returns the zones a rule domain stands for: itself, without
+// any leading wildcard label, or the reverse zones of a CIDR.
+func forwardZones(domain string) ([]string, error) {
+	if !strings.Contains(domain, "/") {
+		domain = matcher.Normalize(strings.TrimPrefix(strings.TrimSpace(domain), "*."))
+		if domain == "" {
+			return nil, fmt.Errorf("%w: empty domain", ErrInvalidForwardRule)
+		}
+
+		return []string{domain}, nil
+	}
+
+	prefix, err := netip.ParsePrefix(domain)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidForwardRule, err.Error())
+	}
+
+	return reverseZones(prefix), nil
+}
+
+// reverseZones returns the in-addr.arpa or ip6.arpa zones covering prefix.
+// Zones are cut on octets for IPv4 and on nibbles for IPv6, so prefixes in
+// between, like 172.16.0.0/12, span several zones.
+func reverseZones(prefix netip.Prefix) []string {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits = max(bits-96, 0)
+	}
+
+	width, suffix := 8, "in-addr.arpa."
+	if addr.Is6() {
+		width, suffix = 4, "ip6.arpa."
+	}
+
+	labels := (bits + width - 1) / width
+	spare := labels*width - bits
+
+	var units []int
+	for _, b := range addr.AsSlice() {
+		if width == 8 {
+			units = append(units, int(b))
+		} else {
+			units = append(units, int(b>>4), int(b&0xf))
+		}
+	}
+
+	zones := make([]string, 0, 1<<spare)
+	for i := 0; i < 1<<spare; i++ {
+		var sb strings.Builder
+		for j := labels - 1; j >= 0; j-- {
+			unit := units[j]
+			if j == labels-1 {
+				unit |= i
+			}
+
+			if width == 8 {
+				sb.WriteString(strconv.Itoa(unit))
+			} else {
+				sb.WriteString(strconv.FormatInt(int64(unit), 16))
+			}
+			sb.WriteByte('.')
+		}
+		zones = append(zones, sb.String()+suffix)
+	}
+
+	return zones
+}
+
+// match returns the upstreams of the most specific rule covering name.
+func (f *forwarders) match(name string) (upstream.Pool, bool) {
+	if f == nil {
+		return nil, false
+	}
+
+	return f.trie.Match(name)
+}
+
+func (f *forwarders) Start() {
+	for _, pool := range f.pools {
+		pool.Start()
+	}
+}
+
+func (f *forwarders) Stop() {
+	for _, pool := range f.pools {
+		pool.Stop()
+	}
+}
@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/matcher"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+func forwardingConfig(t *testing.T, rules string) *config.Config {
+	t.Helper()
+
+	cfg := &config.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte("dns:\n  forwarding:\n    rules:\n"+rules), cfg))
+	return cfg
+}
+
+func TestReverseZones(t *testing.T) {
+	assert.Equal(t, []string{"10.in-addr.arpa."}, reverseZones(netip.MustParsePrefix("10.0.0.0/8")))
+	assert.Equal(t, []string{"168.192.in-addr.arpa."}, reverseZones(netip.MustParsePrefix("192.168.7.0/16")))
+	assert.Equal(t, []string{"7.168.192.in-addr.arpa."}, reverseZones(netip.MustParsePrefix("192.168.7.0/24")))
+	assert.Equal(t, []string{"in-addr.arpa."}, reverseZones(netip.MustParsePrefix("0.0.0.0/0")))
+
+	zones := reverseZones(netip.MustParsePrefix("172.16.0.0/12"))
+	require.Len(t, zones, 16)
+	assert.Equal(t, "16.172.in-addr.arpa.", zones[0])
+	assert.Equal(t, "31.172.in-addr.arpa.", zones[15])
+
+	assert.Equal(t, []string{"d.f.ip6.arpa."}, reverseZones(netip.MustParsePrefix("fd00::/8")))
+	assert.Equal(t, []string{"c.f.ip6.arpa.", "d.f.ip6.arpa."}, reverseZones(netip.MustParsePrefix("fc00::/7")))
+	assert.Equal(t, []string{"8.b.d.0.1.0.0.2.ip6.arpa."}, reverseZones(netip.MustParsePrefix("2001:db8::/32")))
+}
+
+func TestNewForwarders(t *testing.T) {
+	f, err := newForwarders(&config.Config{})
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	_, ok := f.match("corp.internal.")
+	assert.False(t, ok)
+
+	f, err = newForwarders(forwardingConfig(t, `
+      - domains: [Corp.Internal.]
+        servers: [10.0.0.10, https://dc.corp.internal/dns-query]
+        transport: tls
+      - domains: ["*.consul"]
+        servers: [127.0.0.1:8600]
+        transport: tcp
+      - domains: [10.0.0.0/8, 172.16.0.0/12]
+        servers: [192.168.0.1]
+      - domains: [eu.corp.internal]
+        servers: [10.1.0.10]
+`))
+	require.NoError(t, err)
+
+	addresses := func(name string) []string {
+		pool, ok := f.match(name)
+		if !ok {
+			return nil
+		}
+
+		var res []string
+		for _, s := range pool.Stats() {
+			res = append(res, s.Address)
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"tls://10.0.0.10", "https://dc.corp.internal/dns-query"}, addresses("corp.internal."))
+	assert.Equal(t, []string{"tls://10.0.0.10", "https://dc.corp.internal/dns-query"}, addresses("DC1.corp.internal."))
+	assert.Equal(t, []string{"10.1.0.10"}, addresses("dc.eu.corp.internal."))
+	assert.Equal(t, []string{"tcp://127.0.0.1:8600"}, addresses("web.service.consul."))
+	assert.Equal(t, []string{"192.168.0.1"}, addresses("1.0.0.10.in-addr.arpa."))
+	assert.Equal(t, []string{"192.168.0.1"}, addresses("1.0.20.172.in-addr.arpa."))
+	assert.Nil(t, addresses("1.0.32.172.in-addr.arpa."))
+	assert.Nil(t, addresses("notcorp.internal."))
+
+	for _, rules := range []string{
+		"      - domains: [corp.internal]\n",
+		"      - servers: [10.0.0.10]\n",
+		"      - domains: [corp.internal]\n        servers: [10.0.0.10]\n        transport: quic\n",
+		"      - domains: [10.0.0.0/33]\n        servers: [10.0.0.10]\n",
+		"      - domains: [\"*.\"]\n        servers: [10.0.0.10]\n",
+	} {
+		_, err := newForwarders(forwardingConfig(t, rules))
+		assert.ErrorIs(t, err, ErrInvalidForwardRule, rules)
+	}
+
+	_, err = newForwarders(forwardingConfig(t, `
+      - domains: [corp.internal]
+        servers: [10.0.0.10]
+        strategy: random
+`))
+	assert.ErrorIs(t, err, upstream.ErrUnknownStrategy)
+}
+
+func TestDNS_resolve_Forwarding(t *testing.T) {
+	dnsHandler := createTestDNS()
+	upstreams := dnsHandler.upstreams.(*testUpstream)
+
+	corp := &testUpstream{handler: answerWithA(300, "10.0.0.80")}
+	dnsHandler.forwarders = &forwarders{trie: matcher.New[upstream.Pool]()}
+	dnsHandler.forwarders.trie.Insert("corp.internal", true, corp)
+
+	groupUpstreams := &testUpstream{handler: answerWithA(300, "10.9.9.9")}
+	g := &clientGroup{resolver: &groupResolver{upstreams: groupUpstreams, cache: dnsHandler.cache}}
+
+	req := new(dns.Msg)
+	req.SetQuestion("www.corp.internal.", dns.TypeA)
+	resp := dnsHandler.resolve(g, req)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.80", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(1), corp.hits.Load())
+	assert.Equal(t, int32(0), groupUpstreams.hits.Load())
+
+	req = new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	resp = dnsHandler.resolve(nil, req)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(1), corp.hits.Load())
+	assert.Equal(t, int32(1), upstreams.hits.Load())
+}
@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// hostnameRefresh is how long a client goes without its hostname being
+// looked up again.
+const hostnameRefresh = 1 * time.Hour
+
+// hostnames tracks when the hostnames of clients were last looked up.
+type hostnames struct {
+	mu      sync.Mutex
+	lookups map[netip.Addr]time.Time
+	pruned  time.Time
+}
+
+// due reports whether the hostname of addr should be looked up at now, and
+// if so records the lookup. Lookups older than hostnameRefresh are dropped
+// once per hostnameRefresh, so clients that went away are forgotten.
+func (h *hostnames) due(addr netip.Addr, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Sub(h.pruned) >= hostnameRefresh {
+		for a, last := range h.lookups {
+			if now.Sub(last) >= hostnameRefresh {
+				delete(h.lookups, a)
+			}
+		}
+		h.pruned = now
+	}
+
+	if last, ok := h.lookups[addr]; ok && now.Sub(last) < hostnameRefresh {
+		return false
+	}
+
+	if h.lookups == nil {
+		h.lookups = make(map[netip.Addr]time.Time)
+	}
+	h.lookups[addr] = now
+
+	return true
+}
+
+// discoverHostname labels the client at addr in the stats with the PTR name
+// of its address, looked up at most once per hostnameRefresh.
+func (d *DNS) discoverHostname(addr netip.Addr, now time.Time) {
+	if !d.hostnames.due(addr, now) {
+		return
+	}
+
+	hostname, ok := d.lookupHostname(addr)
+	if !ok {
+		return
+	}
+
+	err := d.stats.SetClientHostname(context.Background(), addr.String(), hostname)
+	if err != nil {
+		log.Printf("Failed to set client hostname: %s", err.Error())
+	}
+}
+
+// lookupHostname returns the PTR name of addr from the local records, the
+// authoritative zones or the forwarding rules. Other addresses are never
+// looked up, so client addresses do not leak to the default upstreams.
+func (d *DNS) lookupHostname(addr netip.Addr) (string, bool) {
+	name, err := dns.ReverseAddr(addr.String())
+	if err != nil {
+		return "", false
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypePTR)
+
+	resp, ok := d.localReply(nil, req)
+	if !ok {
+		resp, ok = d.authoritativeReply(req)
+	}
+	if !ok {
+		if _, forwarded := d.forwarders.match(name); !forwarded {
+			return "", false
+		}
+		resp = d.resolve(nil, req)
+	}
+
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return strings.TrimSuffix(ptr.Ptr, "."), true
+		}
+	}
+
+	return "", false
+}
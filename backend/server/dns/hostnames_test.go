@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/matcher"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+func TestHostnames_due(t *testing.T) {
+	var h hostnames
+	addr := netip.MustParseAddr("192.168.0.10")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, h.due(addr, now))
+	assert.False(t, h.due(addr, now.Add(59*time.Minute)))
+	assert.True(t, h.due(netip.MustParseAddr("192.168.0.11"), now))
+	assert.True(t, h.due(addr, now.Add(time.Hour)))
+
+	// Clients not seen for a while are forgotten.
+	assert.True(t, h.due(netip.MustParseAddr("192.168.0.12"), now.Add(90*time.Minute)))
+	assert.Len(t, h.lookups, 2)
+	assert.True(t, h.due(netip.MustParseAddr("192.168.0.13"), now.Add(135*time.Minute)))
+	assert.Equal(t, map[netip.Addr]time.Time{
+		netip.MustParseAddr("192.168.0.12"): now.Add(90 * time.Minute),
+		netip.MustParseAddr("192.168.0.13"): now.Add(135 * time.Minute),
+	}, h.lookups)
+}
+
+func TestDNS_lookupHostname(t *testing.T) {
+	dnsHandler := createTestDNS()
+	upstreams := dnsHandler.upstreams.(*testUpstream)
+	dnsHandler.updateLocalIndex([]localrecords.Record{
+		{ID: 1, Name: "10.0.168.192.in-addr.arpa", Type: localrecords.TypePTR, Value: "nas.home.lan."},
+	})
+
+	hostname, ok := dnsHandler.lookupHostname(netip.MustParseAddr("192.168.0.10"))
+	require.True(t, ok)
+	assert.Equal(t, "nas.home.lan", hostname)
+
+	// Private addresses without records are answered locally.
+	_, ok = dnsHandler.lookupHostname(netip.MustParseAddr("192.168.0.11"))
+	assert.False(t, ok)
+
+	// Public addresses never reach the default upstreams.
+	_, ok = dnsHandler.lookupHostname(netip.MustParseAddr("203.0.114.1"))
+	assert.False(t, ok)
+	assert.Equal(t, int32(0), upstreams.hits.Load())
+
+	router := &testUpstream{handler: func(req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, err := dns.NewRR(req.Question[0].Name + " 300 IN PTR laptop.home.lan.")
+		resp.Answer = append(resp.Answer, rr)
+		return resp, err
+	}}
+	dnsHandler.forwarders = &forwarders{trie: matcher.New[upstream.Pool]()}
+	dnsHandler.forwarders.trie.Insert("168.192.in-addr.arpa", true, router)
+
+	hostname, ok = dnsHandler.lookupHostname(netip.MustParseAddr("192.168.0.11"))
+	require.True(t, ok)
+	assert.Equal(t, "laptop.home.lan", hostname)
+	assert.Equal(t, int32(1), router.hits.Load())
+}
+
+func TestDNS_handleRequest_ClientStats(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateLocalIndex([]localrecords.Record{
+		{ID: 1, Name: "10.0.168.192.in-addr.arpa", Type: localrecords.TypePTR, Value: "laptop.home.lan."},
+	})
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dnsHandler.now = func() time.Time { return now }
+
+	// The stats are stored in the background, so every call signals.
+	calls := make(chan struct{}, 3)
+	signal := func(mock.Arguments) { calls <- struct{}{} }
+
+	mockStats := &MockStats{}
+	mockStats.On("Insert", mock.Anything, now, "example.com", "A").Return(nil)
+	mockStats.On("InsertClient", mock.Anything, now, "192.168.0.10").Return(nil).Run(signal).Twice()
+	mockStats.On("SetClientHostname", mock.Anything, "192.168.0.10", "laptop.home.lan").Return(nil).Run(signal).Once()
+	dnsHandler.stats = mockStats
+
+	for i := 0; i < 2; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeA)
+		dnsHandler.handleRequest()(newUDPResponseWriter(), req)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-calls:
+		case <-time.After(time.Second):
+			t.Fatal("client stats were not stored")
+		}
+	}
+
+	// The hostname is only looked up once per client.
+	mockStats.AssertExpectations(t)
+}
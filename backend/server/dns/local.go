@@ -0,0 +1,173 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/localrecords"
+)
+
+// maxLocalCNAMEs bounds the CNAME chains followed within local records.
+const maxLocalCNAMEs = 8
+
+// localIndex holds the local records by lower cased owner name. Wildcard
+// records are kept under the name following their "*." label.
+type localIndex struct {
+	names     map[string][]dns.RR
+	wildcards map[string][]dns.RR
+}
+
+// lookup returns the records owned by name or, when there are none, by the
+// closest wildcard covering it. ok is false when no local record applies.
+func (idx *localIndex) lookup(name string) ([]dns.RR, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+	if rrs, ok := idx.names[name]; ok {
+		return rrs, true
+	}
+
+	labels := dns.Split(name)
+	for _, off := range labels[min(1, len(labels)):] {
+		if rrs, ok := idx.wildcards[name[off:]]; ok {
+			return rrs, true
+		}
+	}
+
+	return nil, false
+}
+
+func (d *DNS) updateLocalIndex(records []localrecords.Record) {
+	index := &localIndex{
+		names:     make(map[string][]dns.RR),
+		wildcards: make(map[string][]dns.RR),
+	}
+
+	for _, r := range records {
+		rr, err := r.RR()
+		if err != nil {
+			fmt.Printf("Skipping local record %d: %s\n", r.ID, err)
+			continue
+		}
+
+		name := strings.ToLower(rr.Header().Name)
+		if suffix, ok := strings.CutPrefix(name, "*."); ok {
+			index.wildcards[suffix] = append(index.wildcards[suffix], rr)
+		} else {
+			index.names[name] = append(index.names[name], rr)
+		}
+	}
+
+	d.localIndex.Store(index)
+}
+
+func (d *DNS) updateLocalRecords() {
+	for {
+		fmt.Println("Updating local records")
+		records, err := d.localRecords.GetAll(context.Background())
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			d.updateLocalIndex(records)
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+// servesLocally reports whether name is answered from the local records or
+// the authoritative zones rather than resolved.
+func (d *DNS) servesLocally(name string) bool {
+	if index := d.localIndex.Load(); index != nil {
+		if _, ok := index.lookup(name); ok {
+			return true
+		}
+	}
+
+	return d.authority != nil && d.authority.Serves(name)
+}
+
+// localReply answers req for a client of g from the local records, if any
+// apply to its question. CNAMEs are followed through the local records and
+// then through the upstreams of g; names with records of other types only
+// get NODATA.
+func (d *DNS) localReply(g *clientGroup, req *dns.Msg) (*dns.Msg, bool) {
+	index := d.localIndex.Load()
+	if index == nil || len(req.Question) == 0 {
+		return nil, false
+	}
+
+	q := req.Question[0]
+	rrs, ok := index.lookup(q.Name)
+	if !ok {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	name := q.Name
+	for i := 0; i < maxLocalCNAMEs; i++ {
+		if answer := localAnswer(rrs, name, q.Qtype); len(answer) > 0 {
+			m.Answer = append(m.Answer, answer...)
+			break
+		}
+
+		cnames := localAnswer(rrs, name, dns.TypeCNAME)
+		if len(cnames) == 0 {
+			// NODATA carries a SOA so clients cache it for the default TTL.
+			m.Ns = []dns.RR{localSOA(name)}
+			break
+		}
+
+		cname := cnames[0].(*dns.CNAME)
+		m.Answer = append(m.Answer, cname)
+		name = cname.Target
+
+		if rrs, ok = index.lookup(name); !ok {
+			d.followCNAME(g, req, m, cname)
+			break
+		}
+	}
+
+	return m, true
+}
+
+// localSOA is the SOA of negative answers to name, which local records are
+// not kept in zones for.
+func localSOA(name string) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: localrecords.DefaultTTL},
+		Ns:      "localhost.",
+		Mbox:    "nobody.invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  localrecords.DefaultTTL,
+	}
+}
+
+// localAnswer returns copies of the records of rrs matching qtype, owned by
+// name.
+func localAnswer(rrs []dns.RR, name string, qtype uint16) []dns.RR {
+	var answer []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != qtype && qtype != dns.TypeANY {
+			continue
+		}
+
+		rr = dns.Copy(rr)
+		rr.Header().Name = name
+		answer = append(answer, rr)
+	}
+
+	return answer
+}
@@ -0,0 +1,152 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+)
+
+func createTestDNSWithLocalRecords() *DNS {
+	dnsHandler := createTestDNS()
+	dnsHandler.updateLocalIndex([]localrecords.Record{
+		{ID: 1, Name: "nas.home.lan", Type: localrecords.TypeA, Value: "192.168.0.10"},
+		{ID: 2, Name: "nas.home.lan", Type: localrecords.TypeAAAA, Value: "fd00::10"},
+		{ID: 3, Name: "*.printers.office", Type: localrecords.TypeA, Value: "192.168.1.20", TTL: 60},
+		{ID: 4, Name: "storage.home.lan", Type: localrecords.TypeCNAME, Value: "nas.home.lan."},
+		{ID: 5, Name: "docs.home.lan", Type: localrecords.TypeCNAME, Value: "docs.example.com."},
+		{ID: 6, Name: "home.lan", Type: localrecords.TypeMX, Value: "10 nas.home.lan."},
+		{ID: 7, Name: "home.lan", Type: localrecords.TypeTXT, Value: "v=spf1 -all"},
+		{ID: 8, Name: "10.0.168.192.in-addr.arpa", Type: localrecords.TypePTR, Value: "nas.home.lan."},
+		{ID: 9, Name: "loop1.home.lan", Type: localrecords.TypeCNAME, Value: "loop2.home.lan."},
+		{ID: 10, Name: "loop2.home.lan", Type: localrecords.TypeCNAME, Value: "loop1.home.lan."},
+		{ID: 11, Name: "broken.home.lan", Type: localrecords.TypeA, Value: "not an ip"},
+	})
+
+	return dnsHandler
+}
+
+func TestDNS_localReply(t *testing.T) {
+	dnsHandler := createTestDNSWithLocalRecords()
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		resp, ok := dnsHandler.localReply(nil, req)
+		if !ok {
+			return nil
+		}
+		assert.True(t, resp.Authoritative)
+		return resp
+	}
+
+	resp := query("NAS.home.lan.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "NAS.home.lan.", resp.Answer[0].Header().Name)
+	assert.Equal(t, "192.168.0.10", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("nas.home.lan.", dns.TypeAAAA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "fd00::10", resp.Answer[0].(*dns.AAAA).AAAA.String())
+
+	// Names with records of other types get NODATA.
+	resp = query("nas.home.lan.", dns.TypeTXT)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, "nas.home.lan.", resp.Ns[0].Header().Name)
+	assert.Equal(t, uint32(localrecords.DefaultTTL), resp.Ns[0].(*dns.SOA).Minttl)
+
+	// NODATA at the end of a CNAME chain is for the target.
+	resp = query("storage.home.lan.", dns.TypeTXT)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, "nas.home.lan.", resp.Ns[0].Header().Name)
+
+	resp = query("hp.floor2.printers.office.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "hp.floor2.printers.office.", resp.Answer[0].Header().Name)
+	assert.Equal(t, uint32(60), resp.Answer[0].Header().Ttl)
+	assert.Nil(t, query("printers.office.", dns.TypeA))
+
+	resp = query("storage.home.lan.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "nas.home.lan.", resp.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "192.168.0.10", resp.Answer[1].(*dns.A).A.String())
+
+	resp = query("storage.home.lan.", dns.TypeCNAME)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Empty(t, resp.Ns)
+
+	// Targets outside the local records are resolved upstream.
+	resp = query("docs.home.lan.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "docs.example.com.", resp.Answer[1].Header().Name)
+	assert.Equal(t, "10.0.0.1", resp.Answer[1].(*dns.A).A.String())
+
+	resp = query("home.lan.", dns.TypeMX)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "nas.home.lan.", resp.Answer[0].(*dns.MX).Mx)
+
+	resp = query("home.lan.", dns.TypeTXT)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, []string{"v=spf1 -all"}, resp.Answer[0].(*dns.TXT).Txt)
+
+	resp = query("10.0.168.192.in-addr.arpa.", dns.TypePTR)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "nas.home.lan.", resp.Answer[0].(*dns.PTR).Ptr)
+
+	resp = query("loop1.home.lan.", dns.TypeA)
+	require.NotNil(t, resp)
+	assert.Len(t, resp.Answer, maxLocalCNAMEs)
+
+	assert.Nil(t, query("broken.home.lan.", dns.TypeA))
+	assert.Nil(t, query("example.com.", dns.TypeA))
+}
+
+func TestDNS_handleRequest_LocalRecords(t *testing.T) {
+	dnsHandler := createTestDNSWithLocalRecords()
+	upstreams := &testUpstream{handler: answerWithA(300, "10.0.0.1")}
+	dnsHandler.upstreams = upstreams
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		rw := newUDPResponseWriter()
+		dnsHandler.handleRequest()(rw, req)
+		require.NotNil(t, rw.msg)
+		require.Len(t, rw.msg.Answer, 1)
+		return rw.msg
+	}
+
+	assert.Equal(t, "192.168.0.10", query("nas.home.lan.").Answer[0].(*dns.A).A.String())
+	assert.Equal(t, int32(0), upstreams.hits.Load())
+
+	// Local names are not blocked as uncategorized.
+	dnsHandler.blockUncategorized = true
+	testCategoryIndex(dnsHandler)
+	assert.Equal(t, "192.168.0.10", query("nas.home.lan.").Answer[0].(*dns.A).A.String())
+	assert.Equal(t, "192.168.1.20", query("lab.printers.office.").Answer[0].(*dns.A).A.String())
+	assert.True(t, query("example.com.").Answer[0].(*dns.A).A.Equal(net.IPv4zero))
+	assert.Equal(t, int32(0), upstreams.hits.Load())
+
+	// Blocks still apply to local names.
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{{ID: 1, Domain: "nas.home.lan"}})
+	assert.True(t, query("nas.home.lan.").Answer[0].(*dns.A).A.Equal(net.IPv4zero))
+}
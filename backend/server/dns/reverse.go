@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+// privateReverseTTL is the TTL of the records of the private reverse zones
+// and of the negative answers under them.
+const privateReverseTTL = 10800
+
+// privateReversePrefixes are the ranges whose reverse zones are served
+// locally, as listed by RFC 6303 and RFC 7793, so lookups of private
+// addresses never leak to public resolvers.
+var privateReversePrefixes = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"255.255.255.255/32",
+	"::/128",
+	"::1/128",
+	"fd00::/8",
+	"fe80::/10",
+	"2001:db8::/32",
+}
+
+// privateReverseIndex maps the names under the private reverse zones to
+// their zone.
+var privateReverseIndex = newPrivateReverseIndex()
+
+func newPrivateReverseIndex() *matcher.Trie[string] {
+	index := matcher.New[string]()
+	for _, zone := range privateReverseZones() {
+		index.Insert(zone, true, zone)
+	}
+
+	return index
+}
+
+func privateReverseZones() []string {
+	var zones []string
+	for _, prefix := range privateReversePrefixes {
+		zones = append(zones, reverseZones(netip.MustParsePrefix(prefix))...)
+	}
+
+	return zones
+}
+
+// privateReverseReply answers req when it is within a private reverse zone
+// that no forwarding rule covers. The zones are empty but for their SOA and
+// NS records, as RFC 6303 prescribes, so other names get NXDOMAIN.
+func (d *DNS) privateReverseReply(req *dns.Msg) (*dns.Msg, bool) {
+	if len(req.Question) == 0 {
+		return nil, false
+	}
+
+	q := req.Question[0]
+	zone, ok := privateReverseIndex.Match(q.Name)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := d.forwarders.match(q.Name); ok {
+		return nil, false
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: zone, Rrtype: rrtype, Class: dns.ClassINET, Ttl: privateReverseTTL}
+	}
+	soa := &dns.SOA{
+		Hdr:     hdr(dns.TypeSOA),
+		Ns:      zone,
+		Mbox:    "nobody.invalid.",
+		Serial:  1,
+		Refresh: 604800,
+		Retry:   86400,
+		Expire:  2419200,
+		Minttl:  privateReverseTTL,
+	}
+
+	switch {
+	case !strings.EqualFold(dns.Fqdn(q.Name), zone):
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{soa}
+	case q.Qtype == dns.TypeSOA:
+		m.Answer = []dns.RR{soa}
+	case q.Qtype == dns.TypeNS:
+		m.Answer = []dns.RR{&dns.NS{Hdr: hdr(dns.TypeNS), Ns: zone}}
+	default:
+		m.Ns = []dns.RR{soa}
+	}
+
+	return m, true
+}
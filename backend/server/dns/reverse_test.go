@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/matcher"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+func TestPrivateReverseZones(t *testing.T) {
+	zones := privateReverseZones()
+	assert.Contains(t, zones, "10.in-addr.arpa.")
+	assert.Contains(t, zones, "16.172.in-addr.arpa.")
+	assert.Contains(t, zones, "31.172.in-addr.arpa.")
+	assert.Contains(t, zones, "168.192.in-addr.arpa.")
+	assert.Contains(t, zones, "64.100.in-addr.arpa.")
+	assert.Contains(t, zones, "127.100.in-addr.arpa.")
+	assert.Contains(t, zones, "255.255.255.255.in-addr.arpa.")
+	assert.Contains(t, zones, "d.f.ip6.arpa.")
+	assert.Contains(t, zones, "b.e.f.ip6.arpa.")
+	assert.Contains(t, zones, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.")
+	assert.NotContains(t, zones, "32.172.in-addr.arpa.")
+}
+
+func TestDNS_privateReverseReply(t *testing.T) {
+	dnsHandler := createTestDNS()
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		resp, ok := dnsHandler.privateReverseReply(req)
+		if !ok {
+			return nil
+		}
+		assert.True(t, resp.Authoritative)
+		return resp
+	}
+
+	resp := query("10.0.168.192.in-addr.arpa.", dns.TypePTR)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, "168.192.in-addr.arpa.", resp.Ns[0].Header().Name)
+
+	resp = query("168.192.IN-ADDR.ARPA.", dns.TypeSOA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "nobody.invalid.", resp.Answer[0].(*dns.SOA).Mbox)
+
+	resp = query("168.192.in-addr.arpa.", dns.TypeNS)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "168.192.in-addr.arpa.", resp.Answer[0].(*dns.NS).Ns)
+
+	resp = query("168.192.in-addr.arpa.", dns.TypePTR)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+
+	resp = query("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", dns.TypePTR)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+
+	assert.Nil(t, query("8.8.8.8.in-addr.arpa.", dns.TypePTR))
+	assert.Nil(t, query("1.0.32.172.in-addr.arpa.", dns.TypePTR))
+	assert.Nil(t, query("example.com.", dns.TypeA))
+
+	// Forwarded zones are left to their upstreams.
+	dnsHandler.forwarders = &forwarders{trie: matcher.New[upstream.Pool]()}
+	dnsHandler.forwarders.trie.Insert("0.168.192.in-addr.arpa", true, &testUpstream{})
+	assert.Nil(t, query("10.0.168.192.in-addr.arpa.", dns.TypePTR))
+	assert.NotNil(t, query("10.1.168.192.in-addr.arpa.", dns.TypePTR))
+}
+
+func TestDNS_handleRequest_PrivateReverse(t *testing.T) {
+	dnsHandler := createTestDNS()
+	upstreams := dnsHandler.upstreams.(*testUpstream)
+	upstreams.handler = func(req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		return resp, nil
+	}
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypePTR)
+		rw := newUDPResponseWriter()
+		dnsHandler.handleRequest()(rw, req)
+		require.NotNil(t, rw.msg)
+		return rw.msg
+	}
+
+	assert.Equal(t, dns.RcodeNameError, query("20.0.168.192.in-addr.arpa.").Rcode)
+	assert.Equal(t, int32(0), upstreams.hits.Load())
+
+	// Local records take precedence.
+	dnsHandler.updateLocalIndex([]localrecords.Record{
+		{ID: 1, Name: "20.0.168.192.in-addr.arpa", Type: localrecords.TypePTR, Value: "printer.home.lan."},
+	})
+	resp := query("20.0.168.192.in-addr.arpa.")
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "printer.home.lan.", resp.Answer[0].(*dns.PTR).Ptr)
+
+	query("8.8.8.8.in-addr.arpa.")
+	assert.Equal(t, int32(1), upstreams.hits.Load())
+}
+
+func TestNewForwarders_PrivateReverse(t *testing.T) {
+	cfg := forwardingConfig(t, `
+      - domains: [10.0.0.0/8]
+        servers: [10.0.0.1]
+`)
+	cfg.DNS.PrivateReverse.Servers = []string{"192.168.0.1"}
+	cfg.DNS.PrivateReverse.Transport = "tcp"
+
+	f, err := newForwarders(cfg)
+	require.NoError(t, err)
+
+	pool, ok := f.match("1.0.168.192.in-addr.arpa.")
+	require.True(t, ok)
+	assert.Equal(t, "tcp://192.168.0.1", pool.Stats()[0].Address)
+
+	// Rules take precedence over the private reverse servers.
+	pool, ok = f.match("1.0.0.10.in-addr.arpa.")
+	require.True(t, ok)
+	assert.Equal(t, "10.0.0.1", pool.Stats()[0].Address)
+
+	cfg.DNS.Forwarding.Rules = nil
+	cfg.DNS.PrivateReverse.Transport = "quic"
+	_, err = newForwarders(cfg)
+	assert.ErrorIs(t, err, ErrInvalidForwardRule)
+}
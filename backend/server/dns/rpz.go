@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/config"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/rpz"
+)
+
+// newRPZ returns the configured response policy zones, or nil when there
+// are none.
+func newRPZ(cfg *config.Config) (rpz.RPZ, error) {
+	if len(cfg.DNS.RPZ.Zones) == 0 {
+		return nil, nil
+	}
+
+	var opts rpz.Options
+	for _, z := range cfg.DNS.RPZ.Zones {
+		opts.Zones = append(opts.Zones, rpz.ZoneOptions{
+			Name:       z.Name,
+			Primary:    z.Primary,
+			File:       z.File,
+			Refresh:    z.Refresh,
+			TSIGKey:    z.TSIGKey,
+			TSIGSecret: z.TSIGSecret,
+		})
+	}
+
+	return rpz.New(opts)
+}
+
+// rpzMatch returns the policy for name, if any.
+func (d *DNS) rpzMatch(name string) (*rpz.Policy, bool) {
+	if d.rpz == nil {
+		return nil, false
+	}
+
+	return d.rpz.Match(name)
+}
+
+// applyPolicy answers req from a client of g as prescribed by a response
+// policy. PASSTHRU policies never get here, they are handled like allow
+// rules.
+func (d *DNS) applyPolicy(rw dns.ResponseWriter, req *dns.Msg, g *clientGroup, p *rpz.Policy) {
+	if p.Action == rpz.ActionDrop {
+		return
+	}
+
+	m, cname := policyReply(req, p)
+	if cname != nil {
+		d.followCNAME(g, req, m, cname)
+	}
+
+	writeResponse(rw, req, m)
+}
+
+// policyReply builds the answer to req prescribed by a response policy,
+// along with the CNAME it rewrites req to, if any, whose target is left to
+// the caller. DROP policies get NODATA, for names that cannot go unanswered.
+// Local data answers look like any other answer, without the Blocked
+// extended error of the NXDOMAIN and NODATA policies.
+func policyReply(req *dns.Msg, p *rpz.Policy) (*dns.Msg, *dns.CNAME) {
+	q := req.Question[0]
+	nodata := blockResponse{mode: blockeddomains.ResponseNoData, ttl: p.TTL}
+
+	switch p.Action {
+	case rpz.ActionNXDomain:
+		nxdomain := blockResponse{mode: blockeddomains.ResponseNXDomain, ttl: p.TTL}
+		return nxdomain.reply(req, p.Zone), nil
+	case rpz.ActionNoData, rpz.ActionDrop:
+		return nodata.reply(req, p.Zone), nil
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	answer := p.Answer(q.Name, q.Qtype)
+	if len(answer) == 0 {
+		m.Ns = []dns.RR{nodata.soa(p.Zone)}
+		return m, nil
+	}
+
+	m.Answer = answer
+
+	cname, _ := answer[0].(*dns.CNAME)
+	return m, cname
+}
@@ -0,0 +1,226 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/rpz"
+)
+
+// testRPZ is an rpz.RPZ holding policies by exact query name.
+type testRPZ struct {
+	policies map[string]*rpz.Policy
+	primary  net.IP
+	notified []string
+}
+
+func (r *testRPZ) Match(name string) (*rpz.Policy, bool) {
+	p, ok := r.policies[name]
+	return p, ok
+}
+
+func (r *testRPZ) Notify(zone string, from net.IP) bool {
+	if !from.Equal(r.primary) {
+		return false
+	}
+	r.notified = append(r.notified, zone)
+	return true
+}
+
+func (r *testRPZ) Start() {}
+func (r *testRPZ) Stop()  {}
+
+func newTestRPZ(t *testing.T) *testRPZ {
+	t.Helper()
+
+	policy := func(trigger string, action rpz.Action, records ...string) *rpz.Policy {
+		p := &rpz.Policy{Zone: "rpz.example.", Trigger: trigger, Action: action, TTL: 60}
+		for _, record := range records {
+			rr, err := dns.NewRR(record)
+			require.NoError(t, err)
+			p.Records = append(p.Records, rr)
+		}
+		return p
+	}
+
+	return &testRPZ{
+		primary: net.ParseIP("192.168.0.10"),
+		policies: map[string]*rpz.Policy{
+			"nxdomain.com.": policy("nxdomain.com", rpz.ActionNXDomain),
+			"nodata.com.":   policy("nodata.com", rpz.ActionNoData),
+			"drop.com.":     policy("drop.com", rpz.ActionDrop),
+			"passthru.com.": policy("passthru.com", rpz.ActionPassthru),
+			"local.com.":    policy("local.com", rpz.ActionLocalData, "local.com.rpz.example. 60 A 10.1.1.1"),
+			"rewrite.com.": policy("rewrite.com", rpz.ActionLocalData,
+				"rewrite.com.rpz.example. 60 CNAME walled.garden."),
+			"chain.com.": policy("chain.com", rpz.ActionLocalData,
+				"chain.com.rpz.example. 60 CNAME local.com."),
+			"loop.com.": policy("loop.com", rpz.ActionLocalData,
+				"loop.com.rpz.example. 60 CNAME loop.com."),
+		},
+	}
+}
+
+func TestDNS_decide_RPZ(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.rpz = newTestRPZ(t)
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "passthru.com"},
+		{ID: 2, Domain: "nxdomain.com"},
+	})
+	dnsHandler.updateAllowlist([]alloweddomains.AllowedDomain{
+		{ID: 3, Domain: "drop.com"},
+	})
+
+	testCases := []struct {
+		name   string
+		action action
+		rule   string
+	}{
+		{"passthru.com.", actionAllow, "rpz PASSTHRU passthru.com in rpz.example."},
+		{"nxdomain.com.", actionRPZ, "rpz NXDOMAIN nxdomain.com in rpz.example."},
+		{"drop.com.", actionAllow, "allow rule 3 (drop.com)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := dnsHandler.decide(nil, tc.name, dns.TypeA)
+			assert.Equal(t, tc.action, dec.action)
+			assert.Equal(t, tc.rule, dec.rule)
+		})
+	}
+}
+
+func TestDNS_handleRequest_RPZ(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.rpz = newTestRPZ(t)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		rw := newUDPResponseWriter()
+		dnsHandler.handleRequest()(rw, req)
+		return rw.msg
+	}
+
+	resp := query("nxdomain.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	require.Len(t, resp.Ns, 1)
+	assert.Equal(t, "rpz.example.", resp.Ns[0].Header().Name)
+	assert.Equal(t, uint32(60), resp.Ns[0].Header().Ttl)
+
+	resp = query("nodata.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	assert.Len(t, resp.Ns, 1)
+
+	assert.Nil(t, query("drop.com.", dns.TypeA))
+
+	resp = query("passthru.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("local.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "local.com.", resp.Answer[0].Header().Name)
+	assert.Equal(t, "10.1.1.1", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("local.com.", dns.TypeAAAA)
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Empty(t, resp.Answer)
+	assert.Len(t, resp.Ns, 1)
+
+	resp = query("rewrite.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "rewrite.com.", resp.Answer[0].Header().Name)
+	assert.Equal(t, "walled.garden.", resp.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "walled.garden.", resp.Answer[1].Header().Name)
+	assert.Equal(t, "10.0.0.1", resp.Answer[1].(*dns.A).A.String())
+
+	// Rewrite targets are filtered like queries.
+	resp = query("chain.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "local.com.", resp.Answer[1].Header().Name)
+	assert.Equal(t, "10.1.1.1", resp.Answer[1].(*dns.A).A.String())
+
+	resp = query("loop.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	assert.Len(t, resp.Answer, 1+maxRewrites)
+
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{{ID: 1, Domain: "walled.garden"}})
+	resp = query("rewrite.com.", dns.TypeA)
+	require.NotNil(t, resp)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "walled.garden.", resp.Answer[1].Header().Name)
+	assert.True(t, resp.Answer[1].(*dns.A).A.Equal(net.IPv4zero))
+}
+
+func TestDNS_handleRequest_Notify(t *testing.T) {
+	dnsHandler := createTestDNS()
+
+	notify := func(from string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetNotify("rpz.example.")
+		rw := newUDPResponseWriter()
+		rw.remote = &net.UDPAddr{IP: net.ParseIP(from), Port: 53}
+		dnsHandler.handleRequest()(rw, req)
+		return rw.msg
+	}
+
+	resp := notify("192.168.0.10")
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+
+	r := newTestRPZ(t)
+	dnsHandler.rpz = r
+
+	resp = notify("192.168.0.10")
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.True(t, resp.Authoritative)
+	assert.Equal(t, dns.OpcodeNotify, resp.Opcode)
+	assert.Equal(t, []string{"rpz.example."}, r.notified)
+
+	resp = notify("10.9.9.9")
+	require.NotNil(t, resp)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+}
+
+func TestPolicyReply_EDE(t *testing.T) {
+	policies := newTestRPZ(t).policies
+
+	reply := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		req.SetEdns0(4096, false)
+		m, _ := policyReply(req, policies[name])
+		require.NotNil(t, m.IsEdns0())
+		return m
+	}
+
+	m := reply("nodata.com.")
+	require.Len(t, m.IsEdns0().Option, 1)
+	assert.Equal(t, dns.ExtendedErrorCodeBlocked, m.IsEdns0().Option[0].(*dns.EDNS0_EDE).InfoCode)
+
+	// Rewrites look like any other answer.
+	for _, name := range []string{"local.com.", "rewrite.com."} {
+		m = reply(name)
+		assert.Len(t, m.Answer, 1)
+		assert.Empty(t, m.IsEdns0().Option)
+		assert.True(t, m.RecursionAvailable)
+		assert.False(t, m.Authoritative)
+	}
+}
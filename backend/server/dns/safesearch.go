@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+// safeSearchTTL is the TTL of the synthesized CNAME records.
+const safeSearchTTL = 300
+
+// maxRewrites bounds the CNAME targets followed past a rewrite, which
+// response policies may chain.
+const maxRewrites = 8
+
+const googleSafeSearch = "forcesafesearch.google.com."
+
+// safeSearchHosts maps search and video hosts to the hosts serving their
+// safe search or restricted mode. Google Search country domains are matched
+// by isGoogleSearch instead.
+var safeSearchHosts = map[string]string{
+	"bing.com":     "strict.bing.com.",
+	"www.bing.com": "strict.bing.com.",
+
+	"duckduckgo.com":       "safe.duckduckgo.com.",
+	"www.duckduckgo.com":   "safe.duckduckgo.com.",
+	"start.duckduckgo.com": "safe.duckduckgo.com.",
+
+	"www.youtube.com":          "restrict.youtube.com.",
+	"m.youtube.com":            "restrict.youtube.com.",
+	"youtubei.googleapis.com":  "restrict.youtube.com.",
+	"youtube.googleapis.com":   "restrict.youtube.com.",
+	"www.youtube-nocookie.com": "restrict.youtube.com.",
+}
+
+// isGoogleSearch reports whether name, normalized, is google.<tld> or
+// www.google.<tld> for a Google Search domain like google.de, google.co.uk
+// or google.com.br.
+func isGoogleSearch(name string) bool {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(name, "www."), "google.")
+	if !ok {
+		return false
+	}
+
+	labels := strings.Split(rest, ".")
+	switch len(labels) {
+	case 1:
+		return labels[0] == "com" || len(labels[0]) == 2
+	case 2:
+		return (labels[0] == "com" || labels[0] == "co") && len(labels[1]) == 2
+	}
+
+	return false
+}
+
+// safeSearchTarget returns the safe search host name is rewritten to for a
+// client of g, if safe search is enforced for it.
+func (d *DNS) safeSearchTarget(g *clientGroup, name string) (string, bool) {
+	enabled := d.safeSearch
+	if g != nil && g.safeSearch != nil {
+		enabled = *g.safeSearch
+	}
+	if !enabled {
+		return "", false
+	}
+
+	name = matcher.Normalize(name)
+	if target, ok := safeSearchHosts[name]; ok {
+		return target, true
+	}
+
+	if isGoogleSearch(name) {
+		return googleSafeSearch, true
+	}
+
+	return "", false
+}
+
+// safeSearchReply answers req from a client of g with a CNAME to target,
+// followed by the answer for target.
+func (d *DNS) safeSearchReply(g *clientGroup, req *dns.Msg, target string) *dns.Msg {
+	q := req.Question[0]
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+	if opt := req.IsEdns0(); opt != nil {
+		m.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	cname := &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: safeSearchTTL},
+		Target: target,
+	}
+	m.Answer = []dns.RR{cname}
+	d.followCNAME(g, req, m, cname)
+
+	return m
+}
+
+// followCNAME appends to m the answer for the target of cname for a client
+// of g, unless req asked for the CNAME itself. Targets are filtered like
+// queries, so blocked ones get the block response, and the rewrites of
+// response policies are followed up to maxRewrites times.
+func (d *DNS) followCNAME(g *clientGroup, req, m *dns.Msg, cname *dns.CNAME) {
+	q := req.Question[0]
+	if q.Qtype == dns.TypeCNAME {
+		return
+	}
+
+	for i := 0; i < maxRewrites && cname != nil; i++ {
+		target := new(dns.Msg)
+		target.SetQuestion(cname.Target, q.Qtype)
+		if opt := req.IsEdns0(); opt != nil {
+			target.SetEdns0(opt.UDPSize(), opt.Do())
+		}
+
+		var resp *dns.Msg
+		resp, cname = d.targetReply(g, target)
+		m.Answer = append(m.Answer, resp.Answer...)
+		m.Rcode = resp.Rcode
+	}
+}
+
+// targetReply answers the query for a CNAME target from a client of g, and
+// returns the CNAME a response policy rewrites it to, if any.
+func (d *DNS) targetReply(g *clientGroup, target *dns.Msg) (*dns.Msg, *dns.CNAME) {
+	q := target.Question[0]
+
+	dec := d.decide(g, q.Name, q.Qtype)
+	switch dec.action {
+	case actionBlock:
+		fmt.Println("Blocked domain: ", q.Name, "by", dec.rule)
+		return dec.block.response.reply(target, dec.block.zone(q.Name)), nil
+	case actionRPZ:
+		fmt.Println("Rewritten domain: ", q.Name, "by", dec.rule)
+		return policyReply(target, dec.policy)
+	}
+
+	return d.resolve(g, target), nil
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/clients"
+)
+
+func TestDNS_safeSearchTarget(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.safeSearch = true
+
+	testCases := []struct {
+		name   string
+		target string
+	}{
+		{"www.google.com.", "forcesafesearch.google.com."},
+		{"google.com.", "forcesafesearch.google.com."},
+		{"WWW.Google.DE.", "forcesafesearch.google.com."},
+		{"www.google.co.uk.", "forcesafesearch.google.com."},
+		{"www.google.com.br.", "forcesafesearch.google.com."},
+		{"www.bing.com.", "strict.bing.com."},
+		{"duckduckgo.com.", "safe.duckduckgo.com."},
+		{"www.youtube.com.", "restrict.youtube.com."},
+		{"youtubei.googleapis.com.", "restrict.youtube.com."},
+		{"mail.google.com.", ""},
+		{"google.evil.example.com.", ""},
+		{"notgoogle.com.", ""},
+		{"example.com.", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, ok := dnsHandler.safeSearchTarget(nil, tc.name)
+			assert.Equal(t, tc.target != "", ok)
+			assert.Equal(t, tc.target, target)
+		})
+	}
+}
+
+func TestDNS_safeSearchTarget_Groups(t *testing.T) {
+	dnsHandler := createTestDNS()
+
+	enabled, disabled := true, false
+	dnsHandler.updateClientIndex([]clients.Group{
+		{ID: 1, Name: "kids", SafeSearch: &enabled},
+		{ID: 2, Name: "adults", SafeSearch: &disabled},
+		{ID: 3, Name: "guests"},
+	}, []clients.Client{
+		{GroupID: 1, Kind: clients.KindClientID, Value: "kids"},
+		{GroupID: 2, Kind: clients.KindClientID, Value: "adults"},
+		{GroupID: 3, Kind: clients.KindClientID, Value: "guests"},
+	}, nil)
+	index := dnsHandler.clientIndex.Load()
+	kids, adults, guests := index.ids["kids"], index.ids["adults"], index.ids["guests"]
+
+	check := func(g *clientGroup) bool {
+		_, ok := dnsHandler.safeSearchTarget(g, "www.google.com.")
+		return ok
+	}
+
+	assert.False(t, check(nil))
+	assert.True(t, check(kids))
+	assert.False(t, check(adults))
+	assert.False(t, check(guests))
+
+	dnsHandler.safeSearch = true
+	assert.True(t, check(nil))
+	assert.True(t, check(kids))
+	assert.False(t, check(adults))
+	assert.True(t, check(guests))
+}
+
+func TestDNS_handleRequest_SafeSearch(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.safeSearch = true
+	upstreams := &testUpstream{handler: answerWithA(300, "216.239.38.120")}
+	dnsHandler.upstreams = upstreams
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, qtype)
+		req.SetEdns0(4096, false)
+		rw := newUDPResponseWriter()
+		dnsHandler.handleRequest()(rw, req)
+		require.NotNil(t, rw.msg)
+		return rw.msg
+	}
+
+	resp := query("www.google.com.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "www.google.com.", resp.Answer[0].Header().Name)
+	assert.Equal(t, "forcesafesearch.google.com.", resp.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "forcesafesearch.google.com.", resp.Answer[1].Header().Name)
+	assert.True(t, resp.Answer[1].(*dns.A).A.Equal(net.ParseIP("216.239.38.120")))
+	assert.NotNil(t, resp.IsEdns0())
+
+	// The target is resolved through the cache.
+	query("www.google.com.", dns.TypeA)
+	assert.Equal(t, int32(1), upstreams.hits.Load())
+
+	resp = query("www.youtube.com.", dns.TypeCNAME)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "restrict.youtube.com.", resp.Answer[0].(*dns.CNAME).Target)
+
+	// Blocks take precedence over rewrites.
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{{ID: 1, Domain: "www.bing.com"}})
+	resp = query("www.bing.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 1)
+	assert.True(t, resp.Answer[0].(*dns.A).A.Equal(net.IPv4zero))
+
+	// Blocked targets get the block response.
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{{ID: 2, Domain: "restrict.youtube.com"}})
+	resp = query("www.youtube.com.", dns.TypeA)
+	require.Len(t, resp.Answer, 2)
+	assert.Equal(t, "restrict.youtube.com.", resp.Answer[1].Header().Name)
+	assert.True(t, resp.Answer[1].(*dns.A).A.Equal(net.IPv4zero))
+	assert.Equal(t, int32(1), upstreams.hits.Load())
+}
@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/orion-tec/oriondns/internal/schedules"
+)
+
+// scheduleIndex holds the compiled schedules by ID.
+type scheduleIndex map[int64]*schedules.Compiled
+
+// activeFunc reports whether the schedule with an ID is active, for the
+// rules, category policies and groups attached to it.
+type activeFunc func(scheduleID *int64) bool
+
+func (d *DNS) updateScheduleIndex(ss []schedules.Schedule) {
+	index := make(scheduleIndex, len(ss))
+	for _, s := range ss {
+		compiled, err := schedules.Compile(s)
+		if err != nil {
+			fmt.Printf("Skipping schedule %d: %s\n", s.ID, err)
+			continue
+		}
+		index[s.ID] = compiled
+	}
+
+	d.scheduleIndex.Store(&index)
+}
+
+func (d *DNS) updateSchedules() {
+	for {
+		fmt.Println("Updating schedules")
+		ss, err := d.schedules.GetAll(context.Background())
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			d.updateScheduleIndex(ss)
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+// scheduleActive returns a check of the schedules at the current time.
+// Anything without a schedule always applies, and so does anything whose
+// schedule is not loaded, so a broken schedule never lifts a block. Schedules
+// in use cannot be deleted, but anything still attached to a deleted one
+// applies around the clock as well.
+func (d *DNS) scheduleActive() activeFunc {
+	index := d.scheduleIndex.Load()
+	now := d.now()
+
+	return func(scheduleID *int64) bool {
+		if scheduleID == nil || index == nil {
+			return true
+		}
+
+		compiled, ok := (*index)[*scheduleID]
+		return !ok || compiled.Active(now)
+	}
+}
@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/schedules"
+)
+
+var (
+	schoolScheduleID  = int64(10)
+	brokenScheduleID  = int64(11)
+	missingScheduleID = int64(12)
+
+	// 2025-03-10 is a Monday.
+	schoolTime   = time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+	eveningTime  = time.Date(2025, 3, 10, 19, 0, 0, 0, time.UTC)
+	saturdayTime = time.Date(2025, 3, 15, 9, 30, 0, 0, time.UTC)
+)
+
+// createTestDNSWithSchedules returns a DNS whose clock is read from now.
+func createTestDNSWithSchedules(now *time.Time) *DNS {
+	dnsHandler := createTestDNS()
+	dnsHandler.now = func() time.Time { return *now }
+	dnsHandler.updateScheduleIndex([]schedules.Schedule{
+		{
+			ID:      schoolScheduleID,
+			Days:    []string{"mon", "tue", "wed", "thu", "fri"},
+			Windows: []string{"08:00-15:00"},
+		},
+		{ID: brokenScheduleID, Timezone: "Nowhere/Special"},
+	})
+
+	return dnsHandler
+}
+
+func TestDNS_decide_ScheduledRules(t *testing.T) {
+	now := schoolTime
+	dnsHandler := createTestDNSWithSchedules(&now)
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "games.com", Recursive: true, ScheduleID: &schoolScheduleID},
+		{ID: 2, Domain: "play.games.com", Recursive: true, ScheduleID: &schoolScheduleID},
+		{ID: 3, Domain: "games.com", Recursive: true},
+		{ID: 4, Domain: "broken.com", ScheduleID: &brokenScheduleID},
+		{ID: 5, Domain: "missing.com", ScheduleID: &missingScheduleID},
+		{ID: 6, Domain: "video.com"},
+		{ID: 7, Domain: "www.video.com", ScheduleID: &schoolScheduleID},
+	})
+
+	testCases := []struct {
+		name   string
+		now    time.Time
+		domain string
+		action action
+		rule   string
+	}{
+		{"school hours", schoolTime, "play.games.com.", actionBlock, "block rule 2 (play.games.com)"},
+		{"school hours parent", schoolTime, "games.com.", actionBlock, "block rule 1 (games.com)"},
+		{"evening", eveningTime, "www.video.com.", actionNone, ""},
+		{"evening falls through", eveningTime, "play.games.com.", actionBlock, "block rule 3 (games.com)"},
+		{"weekend", saturdayTime, "www.video.com.", actionNone, ""},
+		{"unscheduled", saturdayTime, "video.com.", actionBlock, "block rule 6 (video.com)"},
+		{"broken schedule", eveningTime, "broken.com.", actionBlock, "block rule 4 (broken.com)"},
+		{"missing schedule", eveningTime, "missing.com.", actionBlock, "block rule 5 (missing.com)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now = tc.now
+			dec := dnsHandler.decide(nil, tc.domain, dns.TypeA)
+			assert.Equal(t, tc.action, dec.action)
+			assert.Equal(t, tc.rule, dec.rule)
+		})
+	}
+}
+
+func TestDNS_blockedCategory_Scheduled(t *testing.T) {
+	now := schoolTime
+	dnsHandler := createTestDNSWithSchedules(&now)
+	dnsHandler.updateCategoryIndex([]categories.DomainCategory{
+		{Domain: "chess.example.com", Category: "games"},
+		{Domain: "chat.example.com", Category: "social_networking"},
+	}, []categories.Policy{
+		{Category: "games", Blocked: true, ScheduleID: &schoolScheduleID},
+	})
+
+	groups := []clients.Group{{
+		ID:                kidsGroupID,
+		Name:              "kids",
+		BlockedCategories: []string{"social_networking"},
+		ScheduleID:        &schoolScheduleID,
+	}}
+	dnsHandler.updateClientIndex(groups, []clients.Client{
+		{GroupID: kidsGroupID, Kind: clients.KindClientID, Value: "tablet"},
+	}, nil)
+	kids := dnsHandler.clientIndex.Load().ids["tablet"]
+	require.NotNil(t, kids)
+
+	category, ok := dnsHandler.blockedCategory(nil, "chess.example.com.", dns.TypeA)
+	assert.True(t, ok)
+	assert.Equal(t, "games", category)
+
+	category, ok = dnsHandler.blockedCategory(kids, "chat.example.com.", dns.TypeA)
+	assert.True(t, ok)
+	assert.Equal(t, "social_networking", category)
+
+	now = eveningTime
+	_, ok = dnsHandler.blockedCategory(nil, "chess.example.com.", dns.TypeA)
+	assert.False(t, ok)
+	_, ok = dnsHandler.blockedCategory(kids, "chat.example.com.", dns.TypeA)
+	assert.False(t, ok)
+
+	// Blocks left attached to a deleted schedule apply around the clock.
+	dnsHandler.updateScheduleIndex(nil)
+	_, ok = dnsHandler.blockedCategory(nil, "chess.example.com.", dns.TypeA)
+	assert.True(t, ok)
+	_, ok = dnsHandler.blockedCategory(kids, "chat.example.com.", dns.TypeA)
+	assert.True(t, ok)
+}
+
+func TestDNS_handleRequest_Scheduled(t *testing.T) {
+	now := schoolTime
+	dnsHandler := createTestDNSWithSchedules(&now)
+	dnsHandler.updateBlocklist([]blockeddomains.BlockedDomain{
+		{ID: 1, Domain: "games.com", ScheduleID: &schoolScheduleID},
+	})
+
+	query := func() *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("games.com.", dns.TypeA)
+		rw := newUDPResponseWriter()
+		dnsHandler.handleRequest()(rw, req)
+		require.NotNil(t, rw.msg)
+		require.Len(t, rw.msg.Answer, 1)
+		return rw.msg
+	}
+
+	assert.True(t, query().Answer[0].(*dns.A).A.Equal(net.IPv4zero))
+
+	now = eveningTime
+	assert.Equal(t, "10.0.0.1", query().Answer[0].(*dns.A).A.String())
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const certReloadInterval = 10 * time.Second
+
+// certReloader serves the certificate from certFile/keyFile and picks up new
+// files when they change on disk, so certificates can be renewed without a
+// restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	stamps []fileStamp
+}
+
+// fileStamp tells versions of a file apart by modification time and size,
+// so files replaced by older copies are noticed too.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.modTime.Equal(o.modTime) && s.size == o.size
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: r.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// watch polls the certificate files until done is closed.
+func (r *certReloader) watch(done <-chan struct{}) {
+	ticker := time.NewTicker(certReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reloadIfChanged()
+		if err != nil {
+			log.Printf("Failed to reload TLS certificate: %s\n", err.Error())
+			continue
+		}
+		if reloaded {
+			log.Printf("Reloaded TLS certificate from %s\n", r.certFile)
+		}
+	}
+}
+
+// reloadIfChanged loads the key pair when either file changed since the one
+// currently served was loaded. On error the current certificate is kept.
+func (r *certReloader) reloadIfChanged() (bool, error) {
+	stamps, err := stampFiles(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && slices.EqualFunc(stamps, r.stamps, fileStamp.equal)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.stamps = stamps
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+func stampFiles(files ...string) ([]fileStamp, error) {
+	stamps := make([]fileStamp, len(files))
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps, nil
+}
@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate for commonName and
+// returns the certificate and key paths.
+func writeTestCertificate(t *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func servedCommonName(t *testing.T, r *certReloader) string {
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, "first")
+
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", servedCommonName(t, r))
+
+	reloaded, err := r.reloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeTestCertificate(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	reloaded, err = r.reloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", servedCommonName(t, r))
+
+	// Files restored with an older time are reloaded too.
+	writeTestCertificate(t, dir, "third")
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(certFile, past, past))
+	require.NoError(t, os.Chtimes(keyFile, past, past))
+
+	reloaded, err = r.reloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "third", servedCommonName(t, r))
+}
+
+func TestCertReloader_KeepsCertificateOnError(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, "first")
+
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	_, err = r.reloadIfChanged()
+	assert.Error(t, err)
+	assert.Equal(t, "first", servedCommonName(t, r))
+}
+
+func TestNewCertReloader_MissingFiles(t *testing.T) {
+	_, err := newCertReloader("/nonexistent/cert.pem", "/nonexistent/key.pem")
+	assert.Error(t, err)
+}
+
+func TestDNS_DoT_ServesHandler(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir(), "oriondns")
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	dnsHandler := createTestDNS()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", r.tlsConfig())
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	srv := &dns.Server{Listener: l, Net: "tcp-tls", Handler: dnsHandler.handleRequest(),
+		NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = srv.Shutdown()
+	})
+
+	c := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+	req := new(dns.Msg)
+	req.SetQuestion("google.com.", dns.TypeA)
+
+	resp, _, err := c.Exchange(req, l.Addr().String())
+	require.NoError(t, err)
+	require.Len(t, resp.Answer, 1)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+}
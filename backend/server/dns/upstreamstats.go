@@ -0,0 +1,69 @@
+package dns
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/orion-tec/oriondns/internal/stats"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+// upstreamStats returns the counters of the default upstreams, of the
+// servers of the forwarding rules and of the upstreams of client groups, for
+// the web interface to show. Groups sharing upstreams share their pool, which
+// is named after all of them.
+func (d *DNS) upstreamStats() []stats.UpstreamStats {
+	var res []stats.UpstreamStats
+	add := func(pool string, upstreams []upstream.Stats) {
+		for _, u := range upstreams {
+			res = append(res, stats.UpstreamStats{
+				Pool:         pool,
+				Address:      u.Address,
+				Healthy:      u.Healthy,
+				Queries:      int64(u.Queries),
+				Errors:       int64(u.Errors),
+				AvgLatencyMs: float64(u.AvgLatency) / float64(time.Millisecond),
+			})
+		}
+	}
+
+	add("default", d.upstreams.Stats())
+	if d.forwarders != nil {
+		for _, pool := range d.forwarders.pools {
+			add("forwarding", pool.Stats())
+		}
+	}
+
+	if index := d.clientIndex.Load(); index != nil {
+		var resolvers []*groupResolver
+		names := make(map[*groupResolver][]string)
+		for _, g := range index.groups {
+			if g.resolver == nil {
+				continue
+			}
+			if _, ok := names[g.resolver]; !ok {
+				resolvers = append(resolvers, g.resolver)
+			}
+			names[g.resolver] = append(names[g.resolver], g.name)
+		}
+
+		for _, r := range resolvers {
+			add("group "+strings.Join(names[r], ", "), r.upstreams.Stats())
+		}
+	}
+
+	return res
+}
+
+func (d *DNS) updateUpstreamStats() {
+	for {
+		err := d.stats.ReplaceUpstreamStats(context.Background(), d.upstreamStats())
+		if err != nil {
+			log.Printf("Failed to store upstream stats: %s", err.Error())
+		}
+
+		time.Sleep(1 * time.Minute)
+	}
+}
@@ -0,0 +1,37 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/stats"
+	"github.com/orion-tec/oriondns/internal/upstream"
+)
+
+func TestDNS_upstreamStats(t *testing.T) {
+	dnsHandler := createTestDNS()
+	dnsHandler.upstreams = &testUpstream{stats: []upstream.Stats{
+		{Address: "8.8.8.8:53", Healthy: true, Queries: 10, Errors: 1, AvgLatency: 1500 * time.Microsecond},
+	}}
+	dnsHandler.forwarders = &forwarders{pools: []upstream.Pool{
+		&testUpstream{stats: []upstream.Stats{{Address: "tcp://10.0.0.1", Queries: 2, Errors: 2}}},
+	}}
+
+	dnsHandler.newGroupUpstreams = func(servers []string) (upstream.Pool, error) {
+		return &testUpstream{stats: []upstream.Stats{{Address: servers[0], Healthy: true, Queries: 3}}}, nil
+	}
+	dnsHandler.updateClientIndex([]clients.Group{
+		{ID: 1, Name: "kids"},
+		{ID: 2, Name: "guests", Upstreams: []string{"9.9.9.9:53"}},
+		{ID: 3, Name: "iot", Upstreams: []string{"9.9.9.9:53"}},
+	}, nil, nil)
+
+	assert.Equal(t, []stats.UpstreamStats{
+		{Pool: "default", Address: "8.8.8.8:53", Healthy: true, Queries: 10, Errors: 1, AvgLatencyMs: 1.5},
+		{Pool: "forwarding", Address: "tcp://10.0.0.1", Queries: 2, Errors: 2},
+		{Pool: "group guests, iot", Address: "9.9.9.9:53", Healthy: true, Queries: 3},
+	}, dnsHandler.upstreamStats())
+}
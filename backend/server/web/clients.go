@@ -0,0 +1,250 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/dto"
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+var ErrInvalidRequest = fmt.Errorf("invalid request")
+
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: bad id %q", ErrInvalidRequest, r.PathValue("id"))
+	}
+
+	return id, nil
+}
+
+// writeClientsError maps the errors of the clients endpoints to a status.
+func writeClientsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, clients.ErrInvalidClient):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, clients.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, clients.ErrNameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logAndWriteError(w, err)
+	}
+}
+
+func readGroup(r *http.Request) (clients.Group, error) {
+	var req dto.GroupRequest
+	if err := readFromJSON(r, &req); err != nil {
+		return clients.Group{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return clients.Group{}, fmt.Errorf("%w: name is required", ErrInvalidRequest)
+	}
+
+	return clients.Group{
+		Name:              req.Name,
+		Upstreams:         req.Upstreams,
+		BlockedCategories: req.BlockedCategories,
+		ScheduleID:        req.ScheduleID,
+		SafeSearch:        req.SafeSearch,
+	}, nil
+}
+
+func (h *HTTP) getGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.clients.GetGroups(context.Background())
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	result := make([]dto.GroupResponse, len(groups))
+	for i, g := range groups {
+		result[i] = dto.GroupResponse{
+			ID:                g.ID,
+			Name:              g.Name,
+			Upstreams:         g.Upstreams,
+			BlockedCategories: g.BlockedCategories,
+			ScheduleID:        g.ScheduleID,
+			SafeSearch:        g.SafeSearch,
+		}
+	}
+
+	responseWithJSON(w, result)
+}
+
+func (h *HTTP) createGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := readGroup(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	id, err := h.clients.InsertGroup(context.Background(), group)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	responseWithJSONStatus(w, http.StatusCreated, dto.IDResponse{ID: id})
+}
+
+func (h *HTTP) updateGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	group, err := readGroup(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+	group.ID = id
+
+	if err := h.clients.UpdateGroup(context.Background(), group); err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTP) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	if err := h.clients.DeleteGroup(context.Background(), id); err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTP) getClients(w http.ResponseWriter, r *http.Request) {
+	cs, err := h.clients.GetClients(context.Background())
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	result := make([]dto.ClientResponse, len(cs))
+	for i, c := range cs {
+		result[i] = dto.ClientResponse{ID: c.ID, GroupID: c.GroupID, Name: c.Name, Kind: c.Kind, Value: c.Value}
+	}
+
+	responseWithJSON(w, result)
+}
+
+func (h *HTTP) createClient(w http.ResponseWriter, r *http.Request) {
+	var req dto.ClientRequest
+	if err := readFromJSON(r, &req); err != nil {
+		writeClientsError(w, fmt.Errorf("%w: %s", ErrInvalidRequest, err))
+		return
+	}
+
+	client := clients.Client{GroupID: req.GroupID, Name: req.Name, Kind: req.Kind, Value: strings.TrimSpace(req.Value)}
+	if err := client.Validate(); err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	id, err := h.clients.InsertClient(context.Background(), client)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	responseWithJSONStatus(w, http.StatusCreated, dto.IDResponse{ID: id})
+}
+
+func (h *HTTP) deleteClient(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	if err := h.clients.DeleteClient(context.Background(), id); err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readGroupRule(r *http.Request) (int64, dto.GroupRuleRequest, error) {
+	var req dto.GroupRuleRequest
+	id, err := pathID(r)
+	if err != nil {
+		return 0, req, err
+	}
+
+	if err := readFromJSON(r, &req); err != nil {
+		return 0, req, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+
+	req.Domain = matcher.Normalize(req.Domain)
+	if req.Domain == "" {
+		return 0, req, fmt.Errorf("%w: domain is required", ErrInvalidRequest)
+	}
+
+	return id, req, nil
+}
+
+// createGroupBlockedDomain blocks a domain for the clients of a group.
+func (h *HTTP) createGroupBlockedDomain(w http.ResponseWriter, r *http.Request) {
+	groupID, req, err := readGroupRule(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	err = h.blockedDomains.InsertRule(context.Background(), blockeddomains.BlockedDomain{
+		Domain:     req.Domain,
+		Recursive:  req.Recursive,
+		GroupID:    &groupID,
+		ScheduleID: req.ScheduleID,
+	})
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// createGroupAllowedDomain allows a domain for the clients of a group.
+func (h *HTTP) createGroupAllowedDomain(w http.ResponseWriter, r *http.Request) {
+	groupID, req, err := readGroupRule(r)
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	err = h.allowedDomains.InsertRule(context.Background(), alloweddomains.AllowedDomain{
+		Domain:    req.Domain,
+		Recursive: req.Recursive,
+		GroupID:   &groupID,
+	})
+	if err != nil {
+		writeClientsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
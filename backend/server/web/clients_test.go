@@ -0,0 +1,268 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/dto"
+)
+
+type MockClientsDB struct {
+	mock.Mock
+}
+
+func (m *MockClientsDB) InsertGroup(ctx context.Context, group clients.Group) (int64, error) {
+	args := m.Called(ctx, group)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockClientsDB) GetGroups(ctx context.Context) ([]clients.Group, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]clients.Group), args.Error(1)
+}
+
+func (m *MockClientsDB) UpdateGroup(ctx context.Context, group clients.Group) error {
+	args := m.Called(ctx, group)
+	return args.Error(0)
+}
+
+func (m *MockClientsDB) DeleteGroup(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockClientsDB) InsertClient(ctx context.Context, client clients.Client) (int64, error) {
+	args := m.Called(ctx, client)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockClientsDB) GetClients(ctx context.Context) ([]clients.Client, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]clients.Client), args.Error(1)
+}
+
+func (m *MockClientsDB) DeleteClient(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockBlockedDomainsDB struct {
+	mock.Mock
+}
+
+func (m *MockBlockedDomainsDB) Insert(ctx context.Context, domain string, recursive bool) error {
+	args := m.Called(ctx, domain, recursive)
+	return args.Error(0)
+}
+
+func (m *MockBlockedDomainsDB) InsertRule(ctx context.Context, rule blockeddomains.BlockedDomain) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *MockBlockedDomainsDB) GetAll(ctx context.Context) ([]blockeddomains.BlockedDomain, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]blockeddomains.BlockedDomain), args.Error(1)
+}
+
+func (m *MockBlockedDomainsDB) SetResponse(
+	ctx context.Context, id int64, response, sinkholeIPv4, sinkholeIPv6 string,
+) error {
+	args := m.Called(ctx, id, response, sinkholeIPv4, sinkholeIPv6)
+	return args.Error(0)
+}
+
+type MockAllowedDomainsDB struct {
+	mock.Mock
+}
+
+func (m *MockAllowedDomainsDB) Insert(ctx context.Context, domain string, recursive bool) error {
+	args := m.Called(ctx, domain, recursive)
+	return args.Error(0)
+}
+
+func (m *MockAllowedDomainsDB) InsertRule(ctx context.Context, rule alloweddomains.AllowedDomain) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *MockAllowedDomainsDB) GetAll(ctx context.Context) ([]alloweddomains.AllowedDomain, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]alloweddomains.AllowedDomain), args.Error(1)
+}
+
+func jsonRequest(t *testing.T, method, target string, body any) *http.Request {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestHTTP_createGroup(t *testing.T) {
+	mockClients := &MockClientsDB{}
+	httpHandler := &HTTP{clients: mockClients}
+
+	group := clients.Group{Name: "kids", Upstreams: []string{"9.9.9.9:53"}, BlockedCategories: []string{"games"}}
+	mockClients.On("InsertGroup", mock.Anything, group).Return(int64(4), nil)
+
+	rr := httptest.NewRecorder()
+	httpHandler.createGroup(rr, jsonRequest(t, "POST", "/api/v1/groups", dto.GroupRequest{
+		Name:              " kids ",
+		Upstreams:         []string{"9.9.9.9:53"},
+		BlockedCategories: []string{"games"},
+	}))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response dto.IDResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, int64(4), response.ID)
+	mockClients.AssertExpectations(t)
+}
+
+func TestHTTP_createGroup_Errors(t *testing.T) {
+	mockClients := &MockClientsDB{}
+	httpHandler := &HTTP{clients: mockClients}
+
+	rr := httptest.NewRecorder()
+	httpHandler.createGroup(rr, jsonRequest(t, "POST", "/api/v1/groups", dto.GroupRequest{}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	mockClients.On("InsertGroup", mock.Anything, mock.Anything).Return(int64(0), clients.ErrNameTaken)
+	rr = httptest.NewRecorder()
+	httpHandler.createGroup(rr, jsonRequest(t, "POST", "/api/v1/groups", dto.GroupRequest{Name: "kids"}))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestHTTP_updateGroup(t *testing.T) {
+	mockClients := &MockClientsDB{}
+	httpHandler := &HTTP{clients: mockClients}
+
+	mockClients.On("UpdateGroup", mock.Anything, clients.Group{ID: 4, Name: "guests"}).Return(nil)
+	mockClients.On("UpdateGroup", mock.Anything, clients.Group{ID: 5, Name: "guests"}).Return(clients.ErrNotFound)
+
+	req := jsonRequest(t, "PUT", "/api/v1/groups/4", dto.GroupRequest{Name: "guests"})
+	req.SetPathValue("id", "4")
+	rr := httptest.NewRecorder()
+	httpHandler.updateGroup(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	req = jsonRequest(t, "PUT", "/api/v1/groups/5", dto.GroupRequest{Name: "guests"})
+	req.SetPathValue("id", "5")
+	rr = httptest.NewRecorder()
+	httpHandler.updateGroup(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req = jsonRequest(t, "PUT", "/api/v1/groups/abc", dto.GroupRequest{Name: "guests"})
+	req.SetPathValue("id", "abc")
+	rr = httptest.NewRecorder()
+	httpHandler.updateGroup(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	mockClients.AssertExpectations(t)
+}
+
+func TestHTTP_getGroups(t *testing.T) {
+	mockClients := &MockClientsDB{}
+	httpHandler := &HTTP{clients: mockClients}
+
+	mockClients.On("GetGroups", mock.Anything).Return([]clients.Group{
+		{ID: 1, Name: "kids", Upstreams: []string{}, BlockedCategories: []string{"games"}},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	httpHandler.getGroups(rr, httptest.NewRequest("GET", "/api/v1/groups", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response []dto.GroupResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, "kids", response[0].Name)
+	assert.Equal(t, []string{"games"}, response[0].BlockedCategories)
+}
+
+func TestHTTP_createClient(t *testing.T) {
+	mockClients := &MockClientsDB{}
+	httpHandler := &HTTP{clients: mockClients}
+
+	client := clients.Client{GroupID: 1, Name: "laptop", Kind: clients.KindCIDR, Value: "192.168.0.0/24"}
+	mockClients.On("InsertClient", mock.Anything, client).Return(int64(2), nil)
+
+	rr := httptest.NewRecorder()
+	httpHandler.createClient(rr, jsonRequest(t, "POST", "/api/v1/clients", dto.ClientRequest{
+		GroupID: 1, Name: "laptop", Kind: clients.KindCIDR, Value: "192.168.0.0/24",
+	}))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = httptest.NewRecorder()
+	httpHandler.createClient(rr, jsonRequest(t, "POST", "/api/v1/clients", dto.ClientRequest{
+		GroupID: 1, Kind: clients.KindIP, Value: "not an ip",
+	}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	mockClients.AssertExpectations(t)
+}
+
+func TestHTTP_deleteClient(t *testing.T) {
+	mockClients := &MockClientsDB{}
+	httpHandler := &HTTP{clients: mockClients}
+
+	mockClients.On("DeleteClient", mock.Anything, int64(3)).Return(nil)
+
+	req := httptest.NewRequest("DELETE", "/api/v1/clients/3", nil)
+	req.SetPathValue("id", "3")
+	rr := httptest.NewRecorder()
+	httpHandler.deleteClient(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockClients.AssertExpectations(t)
+}
+
+func TestHTTP_createGroupRules(t *testing.T) {
+	mockBlocked := &MockBlockedDomainsDB{}
+	mockAllowed := &MockAllowedDomainsDB{}
+	httpHandler := &HTTP{blockedDomains: mockBlocked, allowedDomains: mockAllowed}
+
+	groupID := int64(1)
+	mockBlocked.On("InsertRule", mock.Anything, blockeddomains.BlockedDomain{
+		Domain: "social.com", Recursive: true, GroupID: &groupID,
+	}).Return(nil)
+	mockAllowed.On("InsertRule", mock.Anything, alloweddomains.AllowedDomain{
+		Domain: "school.com", GroupID: &groupID,
+	}).Return(nil)
+
+	req := jsonRequest(t, "POST", "/api/v1/groups/1/blocked-domains",
+		dto.GroupRuleRequest{Domain: "Social.com.", Recursive: true})
+	req.SetPathValue("id", "1")
+	rr := httptest.NewRecorder()
+	httpHandler.createGroupBlockedDomain(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	req = jsonRequest(t, "POST", "/api/v1/groups/1/allowed-domains", dto.GroupRuleRequest{Domain: "school.com"})
+	req.SetPathValue("id", "1")
+	rr = httptest.NewRecorder()
+	httpHandler.createGroupAllowedDomain(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	req = jsonRequest(t, "POST", "/api/v1/groups/1/allowed-domains", dto.GroupRuleRequest{})
+	req.SetPathValue("id", "1")
+	rr = httptest.NewRecorder()
+	httpHandler.createGroupAllowedDomain(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	mockBlocked.AssertExpectations(t)
+	mockAllowed.AssertExpectations(t)
+}
@@ -7,23 +7,47 @@ import (
 
 	"go.uber.org/fx"
 
+	"github.com/orion-tec/oriondns/internal/alloweddomains"
+	"github.com/orion-tec/oriondns/internal/blockeddomains"
+	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/clients"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/schedules"
 	"github.com/orion-tec/oriondns/internal/stats"
 )
 
 type HTTP struct {
-	stats stats.DB
+	stats          stats.DB
+	clients        clients.DB
+	blockedDomains blockeddomains.DB
+	allowedDomains alloweddomains.DB
+	categories     categories.DB
+	schedules      schedules.DB
+	localRecords   localrecords.DB
 
 	s *http.Server
 }
 
 type HttpDeps struct {
 	fx.In
-	Stats stats.DB
+	Stats          stats.DB
+	Clients        clients.DB
+	BlockedDomains blockeddomains.DB
+	AllowedDomains alloweddomains.DB
+	Categories     categories.DB
+	Schedules      schedules.DB
+	LocalRecords   localrecords.DB
 }
 
 func New(lc fx.Lifecycle, deps HttpDeps) *HTTP {
 	httpStruct := HTTP{
-		stats: deps.Stats,
+		stats:          deps.Stats,
+		clients:        deps.Clients,
+		blockedDomains: deps.BlockedDomains,
+		allowedDomains: deps.AllowedDomains,
+		categories:     deps.Categories,
+		schedules:      deps.Schedules,
+		localRecords:   deps.LocalRecords,
 	}
 
 	lc.Append(fx.Hook{
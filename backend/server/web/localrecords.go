@@ -0,0 +1,119 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/orion-tec/oriondns/internal/dto"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+	"github.com/orion-tec/oriondns/internal/matcher"
+)
+
+// writeLocalRecordsError maps the errors of the local records endpoints to
+// a status.
+func writeLocalRecordsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, localrecords.ErrInvalidRecord):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, localrecords.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		logAndWriteError(w, err)
+	}
+}
+
+func readLocalRecord(r *http.Request) (localrecords.Record, error) {
+	var req dto.LocalRecordRequest
+	if err := readFromJSON(r, &req); err != nil {
+		return localrecords.Record{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+
+	record := localrecords.Record{
+		Name:  matcher.Normalize(req.Name),
+		Type:  strings.ToUpper(strings.TrimSpace(req.Type)),
+		Value: strings.TrimSpace(req.Value),
+		TTL:   req.TTL,
+	}
+	if err := record.Validate(); err != nil {
+		return localrecords.Record{}, err
+	}
+
+	return record, nil
+}
+
+func (h *HTTP) getLocalRecords(w http.ResponseWriter, r *http.Request) {
+	records, err := h.localRecords.GetAll(context.Background())
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	result := make([]dto.LocalRecordResponse, len(records))
+	for i, record := range records {
+		result[i] = dto.LocalRecordResponse{
+			ID:    record.ID,
+			Name:  record.Name,
+			Type:  record.Type,
+			Value: record.Value,
+			TTL:   record.TTL,
+		}
+	}
+
+	responseWithJSON(w, result)
+}
+
+func (h *HTTP) createLocalRecord(w http.ResponseWriter, r *http.Request) {
+	record, err := readLocalRecord(r)
+	if err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+
+	id, err := h.localRecords.Insert(context.Background(), record)
+	if err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+
+	responseWithJSONStatus(w, http.StatusCreated, dto.IDResponse{ID: id})
+}
+
+func (h *HTTP) updateLocalRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+
+	record, err := readLocalRecord(r)
+	if err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+	record.ID = id
+
+	if err := h.localRecords.Update(context.Background(), record); err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTP) deleteLocalRecord(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+
+	if err := h.localRecords.Delete(context.Background(), id); err != nil {
+		writeLocalRecordsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/dto"
+	"github.com/orion-tec/oriondns/internal/localrecords"
+)
+
+type MockLocalRecordsDB struct {
+	mock.Mock
+}
+
+func (m *MockLocalRecordsDB) Insert(ctx context.Context, record localrecords.Record) (int64, error) {
+	args := m.Called(ctx, record)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockLocalRecordsDB) GetAll(ctx context.Context) ([]localrecords.Record, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]localrecords.Record), args.Error(1)
+}
+
+func (m *MockLocalRecordsDB) Update(ctx context.Context, record localrecords.Record) error {
+	args := m.Called(ctx, record)
+	return args.Error(0)
+}
+
+func (m *MockLocalRecordsDB) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestHTTP_createLocalRecord(t *testing.T) {
+	mockLocalRecords := &MockLocalRecordsDB{}
+	httpHandler := &HTTP{localRecords: mockLocalRecords}
+
+	record := localrecords.Record{Name: "*.home.lan", Type: localrecords.TypeA, Value: "192.168.0.10"}
+	mockLocalRecords.On("Insert", mock.Anything, record).Return(int64(7), nil)
+
+	rr := httptest.NewRecorder()
+	httpHandler.createLocalRecord(rr, jsonRequest(t, "POST", "/api/v1/local-records", dto.LocalRecordRequest{
+		Name:  "*.Home.LAN.",
+		Type:  "a",
+		Value: " 192.168.0.10 ",
+	}))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response dto.IDResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, int64(7), response.ID)
+
+	rr = httptest.NewRecorder()
+	httpHandler.createLocalRecord(rr, jsonRequest(t, "POST", "/api/v1/local-records", dto.LocalRecordRequest{
+		Name:  "nas.home.lan",
+		Type:  "A",
+		Value: "nas",
+	}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	mockLocalRecords.AssertExpectations(t)
+}
+
+func TestHTTP_updateLocalRecord(t *testing.T) {
+	mockLocalRecords := &MockLocalRecordsDB{}
+	httpHandler := &HTTP{localRecords: mockLocalRecords}
+
+	record := localrecords.Record{ID: 2, Name: "home.lan", Type: localrecords.TypeMX, Value: "10 nas.home.lan.", TTL: 60}
+	mockLocalRecords.On("Update", mock.Anything, record).Return(localrecords.ErrNotFound)
+
+	req := jsonRequest(t, "PUT", "/api/v1/local-records/2", dto.LocalRecordRequest{
+		Name:  "home.lan",
+		Type:  "MX",
+		Value: "10 nas.home.lan.",
+		TTL:   60,
+	})
+	req.SetPathValue("id", "2")
+	rr := httptest.NewRecorder()
+	httpHandler.updateLocalRecord(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	mockLocalRecords.AssertExpectations(t)
+}
+
+func TestHTTP_getLocalRecords(t *testing.T) {
+	mockLocalRecords := &MockLocalRecordsDB{}
+	httpHandler := &HTTP{localRecords: mockLocalRecords}
+
+	mockLocalRecords.On("GetAll", mock.Anything).Return([]localrecords.Record{
+		{ID: 1, Name: "nas.home.lan", Type: localrecords.TypeA, Value: "192.168.0.10", TTL: 300},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	httpHandler.getLocalRecords(rr, httptest.NewRequest("GET", "/api/v1/local-records", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response []dto.LocalRecordResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, dto.LocalRecordResponse{
+		ID: 1, Name: "nas.home.lan", Type: "A", Value: "192.168.0.10", TTL: 300,
+	}, response[0])
+}
+
+func TestHTTP_deleteLocalRecord(t *testing.T) {
+	mockLocalRecords := &MockLocalRecordsDB{}
+	httpHandler := &HTTP{localRecords: mockLocalRecords}
+
+	mockLocalRecords.On("Delete", mock.Anything, int64(4)).Return(nil)
+
+	req := httptest.NewRequest("DELETE", "/api/v1/local-records/4", nil)
+	req.SetPathValue("id", "4")
+	rr := httptest.NewRecorder()
+	httpHandler.deleteLocalRecord(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockLocalRecords.AssertExpectations(t)
+}
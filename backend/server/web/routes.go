@@ -12,4 +12,26 @@ func withCors(handler http.HandlerFunc) http.HandlerFunc {
 func (h *HTTP) setupRoutes() {
 	http.HandleFunc("POST /api/v1/dashboard/most-used-domains", withCors(h.getMostUsedDomainsDashboard))
 	http.HandleFunc("POST /api/v1/dashboard/server-usage-by-time-range", withCors(h.getServerUsageByTimeRangeDashboard))
+	http.HandleFunc("POST /api/v1/dashboard/most-active-clients", withCors(h.getMostActiveClientsDashboard))
+	http.HandleFunc("GET /api/v1/upstreams/stats", withCors(h.getUpstreamStats))
+
+	http.HandleFunc("GET /api/v1/groups", withCors(h.getGroups))
+	http.HandleFunc("POST /api/v1/groups", withCors(h.createGroup))
+	http.HandleFunc("PUT /api/v1/groups/{id}", withCors(h.updateGroup))
+	http.HandleFunc("DELETE /api/v1/groups/{id}", withCors(h.deleteGroup))
+	http.HandleFunc("POST /api/v1/groups/{id}/blocked-domains", withCors(h.createGroupBlockedDomain))
+	http.HandleFunc("POST /api/v1/groups/{id}/allowed-domains", withCors(h.createGroupAllowedDomain))
+	http.HandleFunc("GET /api/v1/clients", withCors(h.getClients))
+	http.HandleFunc("POST /api/v1/clients", withCors(h.createClient))
+	http.HandleFunc("DELETE /api/v1/clients/{id}", withCors(h.deleteClient))
+	http.HandleFunc("GET /api/v1/schedules", withCors(h.getSchedules))
+	http.HandleFunc("POST /api/v1/schedules", withCors(h.createSchedule))
+	http.HandleFunc("PUT /api/v1/schedules/{id}", withCors(h.updateSchedule))
+	http.HandleFunc("DELETE /api/v1/schedules/{id}", withCors(h.deleteSchedule))
+	http.HandleFunc("PUT /api/v1/categories/{category}/policy", withCors(h.setCategoryPolicy))
+	http.HandleFunc("GET /api/v1/local-records", withCors(h.getLocalRecords))
+	http.HandleFunc("POST /api/v1/local-records", withCors(h.createLocalRecord))
+	http.HandleFunc("PUT /api/v1/local-records/{id}", withCors(h.updateLocalRecord))
+	http.HandleFunc("DELETE /api/v1/local-records/{id}", withCors(h.deleteLocalRecord))
+	http.HandleFunc("OPTIONS /api/v1/", withCors(preflight))
 }
@@ -0,0 +1,148 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/orion-tec/oriondns/internal/dto"
+	"github.com/orion-tec/oriondns/internal/schedules"
+)
+
+// writeSchedulesError maps the errors of the schedules endpoints to a
+// status.
+func writeSchedulesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, schedules.ErrInvalidSchedule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, schedules.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, schedules.ErrNameTaken), errors.Is(err, schedules.ErrInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		logAndWriteError(w, err)
+	}
+}
+
+func readSchedule(r *http.Request) (schedules.Schedule, error) {
+	var req dto.ScheduleRequest
+	if err := readFromJSON(r, &req); err != nil {
+		return schedules.Schedule{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return schedules.Schedule{}, fmt.Errorf("%w: name is required", ErrInvalidRequest)
+	}
+
+	schedule := schedules.Schedule{
+		Name:     req.Name,
+		Timezone: strings.TrimSpace(req.Timezone),
+		Days:     req.Days,
+		Windows:  req.Windows,
+	}
+	if err := schedule.Validate(); err != nil {
+		return schedules.Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+func (h *HTTP) getSchedules(w http.ResponseWriter, r *http.Request) {
+	ss, err := h.schedules.GetAll(context.Background())
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	result := make([]dto.ScheduleResponse, len(ss))
+	for i, s := range ss {
+		result[i] = dto.ScheduleResponse{
+			ID:       s.ID,
+			Name:     s.Name,
+			Timezone: s.Timezone,
+			Days:     s.Days,
+			Windows:  s.Windows,
+		}
+	}
+
+	responseWithJSON(w, result)
+}
+
+func (h *HTTP) createSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := readSchedule(r)
+	if err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+
+	id, err := h.schedules.Insert(context.Background(), schedule)
+	if err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+
+	responseWithJSONStatus(w, http.StatusCreated, dto.IDResponse{ID: id})
+}
+
+func (h *HTTP) updateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+
+	schedule, err := readSchedule(r)
+	if err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+	schedule.ID = id
+
+	if err := h.schedules.Update(context.Background(), schedule); err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTP) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+
+	if err := h.schedules.Delete(context.Background(), id); err != nil {
+		writeSchedulesError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setCategoryPolicy blocks or unblocks a category for every client,
+// optionally only while a schedule is active.
+func (h *HTTP) setCategoryPolicy(w http.ResponseWriter, r *http.Request) {
+	category := strings.TrimSpace(r.PathValue("category"))
+	if category == "" {
+		writeSchedulesError(w, fmt.Errorf("%w: category is required", ErrInvalidRequest))
+		return
+	}
+
+	var req dto.CategoryPolicyRequest
+	if err := readFromJSON(r, &req); err != nil {
+		writeSchedulesError(w, fmt.Errorf("%w: %s", ErrInvalidRequest, err))
+		return
+	}
+
+	if err := h.categories.SetPolicy(context.Background(), category, req.Blocked, req.ScheduleID); err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
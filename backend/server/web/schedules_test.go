@@ -0,0 +1,155 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orion-tec/oriondns/internal/categories"
+	"github.com/orion-tec/oriondns/internal/dto"
+	"github.com/orion-tec/oriondns/internal/schedules"
+)
+
+type MockSchedulesDB struct {
+	mock.Mock
+}
+
+func (m *MockSchedulesDB) Insert(ctx context.Context, schedule schedules.Schedule) (int64, error) {
+	args := m.Called(ctx, schedule)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSchedulesDB) GetAll(ctx context.Context) ([]schedules.Schedule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]schedules.Schedule), args.Error(1)
+}
+
+func (m *MockSchedulesDB) Update(ctx context.Context, schedule schedules.Schedule) error {
+	args := m.Called(ctx, schedule)
+	return args.Error(0)
+}
+
+func (m *MockSchedulesDB) Delete(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockCategoriesDB struct {
+	mock.Mock
+}
+
+func (m *MockCategoriesDB) GetAll(ctx context.Context) ([]categories.Category, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]categories.Category), args.Error(1)
+}
+
+func (m *MockCategoriesDB) Insert(ctx context.Context, domain string, cats []string) error {
+	args := m.Called(ctx, domain, cats)
+	return args.Error(0)
+}
+
+func (m *MockCategoriesDB) GetDomainCategories(ctx context.Context) ([]categories.DomainCategory, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]categories.DomainCategory), args.Error(1)
+}
+
+func (m *MockCategoriesDB) GetPolicies(ctx context.Context) ([]categories.Policy, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]categories.Policy), args.Error(1)
+}
+
+func (m *MockCategoriesDB) SetPolicy(ctx context.Context, category string, blocked bool, scheduleID *int64) error {
+	args := m.Called(ctx, category, blocked, scheduleID)
+	return args.Error(0)
+}
+
+func TestHTTP_createSchedule(t *testing.T) {
+	mockSchedules := &MockSchedulesDB{}
+	httpHandler := &HTTP{schedules: mockSchedules}
+
+	schedule := schedules.Schedule{
+		Name:     "school",
+		Timezone: "America/Sao_Paulo",
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Windows:  []string{"08:00-15:00"},
+	}
+	mockSchedules.On("Insert", mock.Anything, schedule).Return(int64(3), nil)
+
+	rr := httptest.NewRecorder()
+	httpHandler.createSchedule(rr, jsonRequest(t, "POST", "/api/v1/schedules", dto.ScheduleRequest{
+		Name:     "school",
+		Timezone: "America/Sao_Paulo",
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Windows:  []string{"08:00-15:00"},
+	}))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response dto.IDResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, int64(3), response.ID)
+	mockSchedules.AssertExpectations(t)
+}
+
+func TestHTTP_createSchedule_Invalid(t *testing.T) {
+	mockSchedules := &MockSchedulesDB{}
+	httpHandler := &HTTP{schedules: mockSchedules}
+
+	for _, req := range []dto.ScheduleRequest{
+		{},
+		{Name: "school", Timezone: "Nowhere/Special"},
+		{Name: "school", Days: []string{"someday"}},
+		{Name: "school", Windows: []string{"morning"}},
+	} {
+		rr := httptest.NewRecorder()
+		httpHandler.createSchedule(rr, jsonRequest(t, "POST", "/api/v1/schedules", req))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "%+v", req)
+	}
+
+	mockSchedules.AssertNotCalled(t, "Insert", mock.Anything, mock.Anything)
+}
+
+func TestHTTP_deleteSchedule(t *testing.T) {
+	mockSchedules := &MockSchedulesDB{}
+	httpHandler := &HTTP{schedules: mockSchedules}
+
+	mockSchedules.On("Delete", mock.Anything, int64(1)).Return(schedules.ErrInUse)
+	mockSchedules.On("Delete", mock.Anything, int64(2)).Return(schedules.ErrNotFound)
+	mockSchedules.On("Delete", mock.Anything, int64(3)).Return(nil)
+
+	for id, status := range map[string]int{
+		"1": http.StatusConflict,
+		"2": http.StatusNotFound,
+		"3": http.StatusNoContent,
+	} {
+		req := httptest.NewRequest("DELETE", "/api/v1/schedules/"+id, nil)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		httpHandler.deleteSchedule(rr, req)
+		assert.Equal(t, status, rr.Code, id)
+	}
+
+	mockSchedules.AssertExpectations(t)
+}
+
+func TestHTTP_setCategoryPolicy(t *testing.T) {
+	mockCategories := &MockCategoriesDB{}
+	httpHandler := &HTTP{categories: mockCategories}
+
+	scheduleID := int64(3)
+	mockCategories.On("SetPolicy", mock.Anything, "games", true, &scheduleID).Return(nil)
+
+	req := jsonRequest(t, "PUT", "/api/v1/categories/games/policy",
+		dto.CategoryPolicyRequest{Blocked: true, ScheduleID: &scheduleID})
+	req.SetPathValue("category", "games")
+	rr := httptest.NewRecorder()
+	httpHandler.setCategoryPolicy(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockCategories.AssertExpectations(t)
+}
@@ -67,3 +67,55 @@ func (h *HTTP) getServerUsageByTimeRangeDashboard(w http.ResponseWriter, r *http
 
 	responseWithJSON(w, transformedResult)
 }
+
+func (h *HTTP) getMostActiveClientsDashboard(w http.ResponseWriter, r *http.Request) {
+	var req dto.GetMostActiveClientsRequest
+	err := readFromJSON(r, &req)
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	from := getTimeFromFE(req.From)
+	to := getTimeFromFE(req.To)
+
+	results, err := h.stats.GetMostActiveClients(context.Background(), from, to, 10)
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	transformedResult := make([]dto.GetMostActiveClientsResponse, len(results))
+	for i, r := range results {
+		transformedResult[i] = dto.GetMostActiveClientsResponse{
+			Client:   r.Client,
+			Hostname: r.Hostname,
+			Count:    r.Count,
+		}
+	}
+
+	responseWithJSON(w, transformedResult)
+}
+
+func (h *HTTP) getUpstreamStats(w http.ResponseWriter, _ *http.Request) {
+	results, err := h.stats.GetUpstreamStats(context.Background())
+	if err != nil {
+		logAndWriteError(w, err)
+		return
+	}
+
+	transformedResult := make([]dto.GetUpstreamStatsResponse, len(results))
+	for i, r := range results {
+		transformedResult[i] = dto.GetUpstreamStatsResponse{
+			Pool:         r.Pool,
+			Address:      r.Address,
+			Healthy:      r.Healthy,
+			Queries:      r.Queries,
+			Errors:       r.Errors,
+			AvgLatencyMs: r.AvgLatencyMs,
+			UpdatedAt:    r.UpdatedAt,
+		}
+	}
+
+	responseWithJSON(w, transformedResult)
+}
@@ -54,6 +54,33 @@ func (m *MockStatsDB) GetServerUsageByTimeRange(
 	return args.Get(0).([]stats.ServerUsageByTimeRangeResponse), args.Error(1)
 }
 
+func (m *MockStatsDB) ReplaceUpstreamStats(ctx context.Context, upstreams []stats.UpstreamStats) error {
+	args := m.Called(ctx, upstreams)
+	return args.Error(0)
+}
+
+func (m *MockStatsDB) GetUpstreamStats(ctx context.Context) ([]stats.UpstreamStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]stats.UpstreamStats), args.Error(1)
+}
+
+func (m *MockStatsDB) InsertClient(ctx context.Context, t time.Time, client string) error {
+	args := m.Called(ctx, t, client)
+	return args.Error(0)
+}
+
+func (m *MockStatsDB) SetClientHostname(ctx context.Context, client, hostname string) error {
+	args := m.Called(ctx, client, hostname)
+	return args.Error(0)
+}
+
+func (m *MockStatsDB) GetMostActiveClients(
+	ctx context.Context, from, to time.Time, limit int,
+) ([]stats.MostActiveClientResponse, error) {
+	args := m.Called(ctx, from, to, limit)
+	return args.Get(0).([]stats.MostActiveClientResponse), args.Error(1)
+}
+
 func TestGetTimeFromFE(t *testing.T) {
 	timestamp := int64(1640995200000)
 	expectedTime := time.Unix(1640995200, 0).UTC()
@@ -216,3 +243,77 @@ func TestHTTP_getServerUsageByTimeRangeDashboard_InvalidJSON(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
+
+func TestHTTP_getMostActiveClientsDashboard(t *testing.T) {
+	mockStats := &MockStatsDB{}
+	httpHandler := &HTTP{
+		stats: mockStats,
+	}
+
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	expectedResponse := []stats.MostActiveClientResponse{
+		{Client: "192.168.0.10", Hostname: "laptop.home.lan", Count: 120},
+		{Client: "192.168.0.11", Count: 30},
+	}
+
+	mockStats.On("GetMostActiveClients", mock.Anything, from, to, 10).Return(expectedResponse, nil)
+
+	reqBody := dto.GetMostActiveClientsRequest{
+		From: from.Unix() * 1000,
+		To:   to.Unix() * 1000,
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	req := httptest.NewRequest("POST", "/api/v1/dashboard/most-active-clients", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+
+	httpHandler.getMostActiveClientsDashboard(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response []dto.GetMostActiveClientsResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+
+	require.Len(t, response, 2)
+	assert.Equal(t, dto.GetMostActiveClientsResponse{
+		Client: "192.168.0.10", Hostname: "laptop.home.lan", Count: 120,
+	}, response[0])
+	assert.Equal(t, "", response[1].Hostname)
+
+	mockStats.AssertExpectations(t)
+}
+
+func TestHTTP_getUpstreamStats(t *testing.T) {
+	mockStats := &MockStatsDB{}
+	httpHandler := &HTTP{
+		stats: mockStats,
+	}
+
+	updatedAt := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockStats.On("GetUpstreamStats", mock.Anything).Return([]stats.UpstreamStats{
+		{Pool: "default", Address: "8.8.8.8:53", Healthy: true, Queries: 10, Errors: 1, AvgLatencyMs: 12.5,
+			UpdatedAt: updatedAt},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/api/v1/upstreams/stats", nil)
+	rr := httptest.NewRecorder()
+
+	httpHandler.getUpstreamStats(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response []dto.GetUpstreamStatsResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+
+	assert.Equal(t, []dto.GetUpstreamStatsResponse{
+		{Pool: "default", Address: "8.8.8.8:53", Healthy: true, Queries: 10, Errors: 1, AvgLatencyMs: 12.5,
+			UpdatedAt: updatedAt},
+	}, response)
+	mockStats.AssertExpectations(t)
+}
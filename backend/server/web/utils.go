@@ -20,6 +20,15 @@ func responseWithJSON(w http.ResponseWriter, data any) {
 	}
 }
 
+func responseWithJSONStatus(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
 func readFromJSON(r *http.Request, v any) error {
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -21,3 +21,29 @@ export interface GetServerUsageByTimeRangeResponse {
   timeRange: string /* RFC3339 */;
   count: number /* int */;
 }
+export interface GetMostActiveClientsRequest {
+  from: number /* int64 */;
+  to: number /* int64 */;
+}
+export interface GetMostActiveClientsResponse {
+  client: string;
+  /**
+   * Hostname is the PTR name of the client, empty when unknown.
+   */
+  hostname: string;
+  count: number /* int64 */;
+}
+export interface GetUpstreamStatsResponse {
+  /**
+   * Pool is "default" for the upstream servers, "forwarding" for the
+   * servers of the forwarding rules and the private reverse zones, or
+   * "group " followed by the names of the client groups using the servers.
+   */
+  pool: string;
+  address: string;
+  healthy: boolean;
+  queries: number /* int64 */;
+  errors: number /* int64 */;
+  avgLatencyMs: number /* float64 */;
+  updatedAt: string /* RFC3339 */;
+}
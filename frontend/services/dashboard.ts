@@ -1,8 +1,11 @@
 import type {
+  GetMostActiveClientsRequest,
+  GetMostActiveClientsResponse,
   GetMostUsedDomainsRequest,
   GetMostUsedDomainsResponse,
   GetServerUsageByTimeRangeRequest,
   GetServerUsageByTimeRangeResponse,
+  GetUpstreamStatsResponse,
 } from "~/@types/types";
 
 export const getMostUsedDomains = async (
@@ -32,3 +35,23 @@ export const getServerUsageByTimeRange = async (
 
   return await resp.json();
 };
+
+export const getMostActiveClients = async (
+  request: GetMostActiveClientsRequest,
+): Promise<GetMostActiveClientsResponse[]> => {
+  const resp = await fetch(`/api/v1/dashboard/most-active-clients`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(request),
+  });
+
+  return await resp.json();
+};
+
+export const getUpstreamStats = async (): Promise<GetUpstreamStatsResponse[]> => {
+  const resp = await fetch(`/api/v1/upstreams/stats`);
+
+  return await resp.json();
+};